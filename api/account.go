@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"net/url"
 )
 
@@ -32,27 +31,67 @@ func (n *Network) AuthenticateAPIKey(apikey string) (*Account, error) {
 	return n.authenticate(url.Values{"api_key": {apikey}})
 }
 
-func (n *Network) authenticate(authValues url.Values) (*Account, error) {
-	type favResult struct {
+// memberResult is the member information as returned by the AudioAddict servers.
+type memberResult struct {
+	Confirmed bool   `json:"confirmed"`
+	ID        int    `json:"id"`
+	APIKey    string `json:"api_key"`
+	ListenKey string `json:"listen_key"`
+	Firstname string `json:"first_name"`
+	Lastname  string `json:"last_name"`
+	Favorites []struct {
 		ChannelID int `json:"channel_id"`
+	} `json:"network_favorite_channels"`
+	Subscriptions []subscriptionResult `json:"subscriptions"`
+}
+
+// subscriptionResult is a subscription as returned by the AudioAddict servers.
+type subscriptionResult struct {
+	Status   string `json:"status"`
+	Services []struct {
+		Key string `json:"key"`
+	} `json:"services"`
+}
+
+// account converts the member information to an Account on network n.
+func (m *memberResult) account(n *Network) *Account {
+	a := &Account{
+		ID:        m.ID,
+		APIKey:    m.APIKey,
+		ListenKey: m.ListenKey,
+		Firstname: m.Firstname,
+		Lastname:  m.Lastname,
+	}
+	for _, favRes := range m.Favorites {
+		a.Favorites = append(a.Favorites, favRes.ChannelID)
 	}
-	type subResult struct {
-		Status string `json:"status"`
+	for _, subRes := range m.Subscriptions {
+		if subRes.Status == "active" && subRes.coversNetwork(n) {
+			a.Premium = true
+			break
+		}
+	}
+	return a
+}
+
+// coversNetwork returns whether the subscription includes the premium service for network n.
+// Subscriptions without a list of services are assumed to cover all networks.
+func (s *subscriptionResult) coversNetwork(n *Network) bool {
+	if len(s.Services) == 0 {
+		return true
 	}
-	var authResult struct {
-		Confirmed     bool        `json:"confirmed"`
-		ID            int         `json:"id"`
-		APIKey        string      `json:"api_key"`
-		ListenKey     string      `json:"listen_key"`
-		Firstname     string      `json:"first_name"`
-		Lastname      string      `json:"last_name"`
-		Favorites     []favResult `json:"network_favorite_channels"`
-		Subscriptions []subResult `json:"subscriptions"`
+	for _, service := range s.Services {
+		if service.Key == n.Key+"-premium" {
+			return true
+		}
 	}
+	return false
+}
 
+func (n *Network) authenticate(authValues url.Values) (*Account, error) {
 	apiURL := fmt.Sprintf(`%s/%s/members/authenticate`, APIBaseURL, n.Key)
 
-	resp, err := http.PostForm(apiURL, authValues)
+	resp, err := httpClient.PostForm(apiURL, authValues)
 	if err != nil {
 		return nil, err
 	}
@@ -67,30 +106,13 @@ func (n *Network) authenticate(authValues url.Values) (*Account, error) {
 		fmt.Printf("%s\n", string(bts))
 		return nil, ErrCantAuthenticate
 	}
+	var authResult memberResult
 	err = json.NewDecoder(resp.Body).Decode(&authResult)
 	if err != nil {
 		return nil, err
 	}
 
-	a := &Account{
-		ID:        authResult.ID,
-		APIKey:    authResult.APIKey,
-		ListenKey: authResult.ListenKey,
-		Firstname: authResult.Firstname,
-		Lastname:  authResult.Lastname,
-	}
-	for _, favRes := range authResult.Favorites {
-		a.Favorites = append(a.Favorites, favRes.ChannelID)
-	}
-	for _, subRes := range authResult.Subscriptions {
-		// TODO: the checks here should probably be more thourough.. i.e.: what services have status active!?
-		if subRes.Status == "active" {
-			a.Premium = true
-			break
-		}
-	}
-
-	return a, nil
+	return authResult.account(n), nil
 }
 
 // IsFavoriteChannel returns whether the channel (provided by id) is favorited in the account.
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 )
 
 var (
@@ -13,6 +12,9 @@ var (
 
 	// ErrNoTracklist is returned when the API returns a valid result, but the tracklist is empty (or only contains ads)
 	ErrNoTracklist = errors.New("no tracklist found")
+
+	// ErrNoTrackMatch is returned by (*Channel).TrackForTitle() when no track in the history has the stream title.
+	ErrNoTrackMatch = errors.New("no track matches the stream title")
 )
 
 // Channel contains information about a AudioAddict channel
@@ -40,7 +42,7 @@ func (c *Channel) StreamURLs(acc *Account) ([]string, error) {
 	if acc != nil {
 		url += `?` + acc.ListenKey
 	}
-	resp, err := http.Get(url)
+	resp, err := httpClient.Get(url)
 	if err != nil {
 		return nil, err
 	}
@@ -57,7 +59,7 @@ type Tracklist []*Track
 
 func (c *Channel) tracklist() (Tracklist, error) {
 	url := fmt.Sprintf(`%s/%s/track_history/channel/%d`, APIBaseURL, c.Network.Key, c.ID)
-	resp, err := http.Get(url)
+	resp, err := httpClient.Get(url)
 	if err != nil {
 		return nil, err
 	}
@@ -92,3 +94,17 @@ func (c *Channel) CurrentTrack() (*Track, error) {
 	}
 	return nil, ErrNoTracklist
 }
+
+// TrackForTitle returns the track from the track history with the stream title that was read from the stream metadata.
+// The history may be updated a little later than the stream, ErrNoTrackMatch is returned when it has no match yet.
+func (c *Channel) TrackForTitle(streamTitle string) (*Track, error) {
+	tracklist, err := c.tracklist()
+	if err != nil {
+		return nil, err
+	}
+	track := tracklist.Match(streamTitle)
+	if track == nil {
+		return nil, ErrNoTrackMatch
+	}
+	return track, nil
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// requestTimeout is how long a request to the AudioAddict servers may take, including reading the response.
+const requestTimeout = 15 * time.Second
+
+// httpClient is used for all requests to the AudioAddict servers.
+var httpClient = &http.Client{
+	Transport: &observingTransport{base: http.DefaultTransport},
+	Timeout:   requestTimeout,
+}
+
+// ServerTimeObserver is called with the Date header of every response from the AudioAddict servers,
+// together with the local times at which the request was sent and the response was received.
+type ServerTimeObserver func(serverTime, sent, received time.Time)
+
+var (
+	serverTimeObserverLock sync.RWMutex
+	serverTimeObserver     ServerTimeObserver
+)
+
+// SetServerTimeObserver sets the function that observes the server time on every response.
+// This can be used to keep a clock in sync with the servers without doing extra requests.
+// Use nil to stop observing.
+func SetServerTimeObserver(observer ServerTimeObserver) {
+	serverTimeObserverLock.Lock()
+	defer serverTimeObserverLock.Unlock()
+	serverTimeObserver = observer
+}
+
+// observingTransport passes the Date header and request timing of each response to the ServerTimeObserver.
+type observingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *observingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	sent := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	received := time.Now()
+
+	serverTimeObserverLock.RLock()
+	observer := serverTimeObserver
+	serverTimeObserverLock.RUnlock()
+	if observer == nil {
+		return resp, nil
+	}
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		// no or invalid Date header, nothing to observe
+		return resp, nil
+	}
+	observer(serverTime, sent, received)
+	return resp, nil
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// observation is a call of the ServerTimeObserver.
+type observation struct {
+	serverTime, sent, received time.Time
+}
+
+// observe sets a ServerTimeObserver that records its calls, until the end of the test.
+func observe(t *testing.T) *[]observation {
+	var observations []observation
+	SetServerTimeObserver(func(serverTime, sent, received time.Time) {
+		observations = append(observations, observation{serverTime, sent, received})
+	})
+	t.Cleanup(func() { SetServerTimeObserver(nil) })
+	return &observations
+}
+
+// get does a request with the observing transport to a server that responds with given Date headers.
+// A nil date removes the Date header that the server adds by default.
+func get(t *testing.T, date []string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["Date"] = date
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &observingTransport{base: http.DefaultTransport}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestObservingTransport(t *testing.T) {
+	observations := observe(t)
+	before := time.Now()
+	get(t, []string{"Mon, 19 Oct 2026 07:30:00 GMT"})
+	after := time.Now()
+
+	if len(*observations) != 1 {
+		t.Fatalf("%d observations, want 1", len(*observations))
+	}
+	o := (*observations)[0]
+	if want := time.Date(2026, 10, 19, 7, 30, 0, 0, time.UTC); !o.serverTime.Equal(want) {
+		t.Errorf("server time %v, want %v", o.serverTime, want)
+	}
+	if o.sent.Before(before) || o.received.Before(o.sent) || o.received.After(after) {
+		t.Errorf("sent at %v and received at %v, want in order between %v and %v", o.sent, o.received, before, after)
+	}
+}
+
+func TestObservingTransportWithoutDate(t *testing.T) {
+	for name, date := range map[string][]string{
+		"missing": nil,
+		"invalid": {"yesterday"},
+		"empty":   {""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			observations := observe(t)
+			get(t, date)
+			if len(*observations) != 0 {
+				t.Fatalf("observed %v for a %s Date header", *observations, name)
+			}
+		})
+	}
+}
+
+func TestObservingTransportWithoutObserver(t *testing.T) {
+	SetServerTimeObserver(nil)
+	get(t, []string{"Mon, 19 Oct 2026 07:30:00 GMT"})
+}
+
+func TestObservingTransportError(t *testing.T) {
+	observations := observe(t)
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	client := &http.Client{Transport: &observingTransport{base: http.DefaultTransport}}
+	_, err := client.Get(server.URL)
+	if err == nil {
+		t.Fatal("no error from a closed server")
+	}
+	if len(*observations) != 0 {
+		t.Fatalf("observed %v without a response", *observations)
+	}
+}
+
+func TestHTTPClientTimeout(t *testing.T) {
+	if httpClient.Timeout <= 0 {
+		t.Fatal("the client for the AudioAddict servers has no timeout")
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// favoritesStreamlistKey is the streamlist used to read favorites with a listen key.
+// Both di.fm and RadioTunes provide it, and it doesn't require a premium account.
+const favoritesStreamlistKey = "public3"
+
+// FavoritesByListenKey returns the favorite channels for the account that owns given listen key, in the order that
+// they were favorited. This doesn't require an api key or username and password, but only works when the channels
+// for the network are already known. The favorites are looked up in channels, favorites that can't be found are skipped.
+func (n *Network) FavoritesByListenKey(listenKey string, channels []*Channel) ([]*Channel, error) {
+	entries, err := n.favoritesPlaylist(listenKey)
+	if err != nil {
+		return nil, err
+	}
+
+	channelsByKey := make(map[string]*Channel)
+	channelsByName := make(map[string]*Channel)
+	for _, ch := range channels {
+		channelsByKey[ch.Key] = ch
+		channelsByName[strings.ToLower(ch.Name)] = ch
+	}
+
+	var favorites []*Channel
+	for _, entry := range entries {
+		ch := channelsByKey[entry.channelKey(n)]
+		if ch == nil {
+			ch = channelsByName[strings.ToLower(entry.channelName())]
+		}
+		if ch == nil {
+			continue
+		}
+		favorites = append(favorites, ch)
+	}
+	return favorites, nil
+}
+
+// favoritesPlaylist fetches and parses the favorites playlist for given listen key.
+// ErrInvalidListenKey is returned when the server refuses the listen key.
+func (n *Network) favoritesPlaylist(listenKey string) ([]*playlistEntry, error) {
+	playlistURL := fmt.Sprintf("%s/%s/favorites.pls?%s", n.ListenURLBase, favoritesStreamlistKey, listenKey) // e.g.: http://listen.di.fm/public3/favorites.pls?25*censor*cf51
+	resp, err := httpClient.Get(playlistURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 401 || resp.StatusCode == 403 {
+		return nil, ErrInvalidListenKey
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected response for favorites playlist: %s", resp.Status)
+	}
+	return parsePlaylist(resp.Body)
+}
+
+// maxPlaylistEntries protects parsePlaylist against bogus entry numbers
+const maxPlaylistEntries = 1000
+
+// playlistEntry is a single entry in a .pls playlist
+type playlistEntry struct {
+	File  string
+	Title string
+}
+
+// channelKey guesses the channel key from the stream URL in the entry.
+// e.g.: http://pub1.di.fm:80/di_trance?25*censor*cf51 gives "trance"
+func (e *playlistEntry) channelKey(n *Network) string {
+	u, err := url.Parse(e.File)
+	if err != nil {
+		return ""
+	}
+	key := path.Base(u.Path)
+	key = strings.TrimPrefix(key, n.Key+"_")
+	key = strings.TrimSuffix(key, "_hi")
+	key = strings.TrimSuffix(key, "_aac")
+	return key
+}
+
+// channelName returns the channel name from the entry title.
+// e.g.: "Digitally Imported - Trance" gives "Trance"
+func (e *playlistEntry) channelName() string {
+	if i := strings.LastIndex(e.Title, " - "); i >= 0 {
+		return e.Title[i+3:]
+	}
+	return e.Title
+}
+
+// parsePlaylist parses a .pls playlist, the entries are returned in playlist order.
+func parsePlaylist(r io.Reader) ([]*playlistEntry, error) {
+	var entries []*playlistEntry
+	entry := func(num int) *playlistEntry {
+		for len(entries) < num {
+			entries = append(entries, &playlistEntry{})
+		}
+		return entries[num-1]
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			continue // section header or empty line
+		}
+		key, value := line[:eq], line[eq+1:]
+		var field string
+		switch {
+		case strings.HasPrefix(key, "File"):
+			field = "File"
+		case strings.HasPrefix(key, "Title"):
+			field = "Title"
+		default:
+			continue // NumberOfEntries, Length, Version
+		}
+		num, err := strconv.Atoi(key[len(field):])
+		if err != nil || num < 1 || num > maxPlaylistEntries {
+			continue
+		}
+		if field == "File" {
+			entry(num).File = value
+		} else {
+			entry(num).Title = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePlaylist(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		want     []*playlistEntry
+	}{
+		{
+			name: "in order",
+			playlist: "[playlist]\nNumberOfEntries=2\n" +
+				"File1=http://pub1.di.fm:80/di_trance?key\nTitle1=Digitally Imported - Trance\nLength1=-1\n" +
+				"File2=http://pub2.di.fm:80/di_dub_hi?key\nTitle2=Digitally Imported - Dub\nLength2=-1\n" +
+				"Version=2\n",
+			want: []*playlistEntry{
+				{File: "http://pub1.di.fm:80/di_trance?key", Title: "Digitally Imported - Trance"},
+				{File: "http://pub2.di.fm:80/di_dub_hi?key", Title: "Digitally Imported - Dub"},
+			},
+		},
+		{
+			name:     "out of order",
+			playlist: "[playlist]\nFile2=b\nTitle1=A\nFile1=a\nTitle2=B\n",
+			want:     []*playlistEntry{{File: "a", Title: "A"}, {File: "b", Title: "B"}},
+		},
+		{
+			name:     "gap",
+			playlist: "[playlist]\nFile1=a\nFile3=c\n",
+			want:     []*playlistEntry{{File: "a"}, {}, {File: "c"}},
+		},
+		{
+			name:     "bogus numbers",
+			playlist: "[playlist]\nFile0=zero\nFile1001=far\nFilex=x\nFile-1=minus\nFile1=a\n",
+			want:     []*playlistEntry{{File: "a"}},
+		},
+		{
+			name:     "crlf and spaces",
+			playlist: "[playlist]\r\n\r\n  File1=a?b=c\r\nTitle1=A = B\r\n",
+			want:     []*playlistEntry{{File: "a?b=c", Title: "A = B"}},
+		},
+		{
+			name:     "empty",
+			playlist: "[playlist]\nNumberOfEntries=0\n",
+			want:     nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parsePlaylist(strings.NewReader(test.playlist))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("entries %s, want %s", entriesString(got), entriesString(test.want))
+			}
+		})
+	}
+}
+
+func entriesString(entries []*playlistEntry) string {
+	var s []string
+	for _, e := range entries {
+		s = append(s, fmt.Sprintf("%+v", *e))
+	}
+	return "[" + strings.Join(s, " ") + "]"
+}
+
+func TestPlaylistEntryChannelKey(t *testing.T) {
+	n := &Network{Key: "di"}
+	for file, want := range map[string]string{
+		"http://pub1.di.fm:80/di_trance?25cf51":     "trance",
+		"http://pub1.di.fm:80/di_trance_hi?25cf51":  "trance",
+		"http://pub1.di.fm:80/di_trance_aac?25cf51": "trance",
+		"http://pub1.di.fm/di_vocaltrance":          "vocaltrance",
+		"http://pub1.di.fm/rr_trance":               "rr_trance",
+		"%zz":                                       "",
+	} {
+		e := &playlistEntry{File: file}
+		if got := e.channelKey(n); got != want {
+			t.Errorf("channel key %q for %q, want %q", got, file, want)
+		}
+	}
+}
+
+func TestPlaylistEntryChannelName(t *testing.T) {
+	for title, want := range map[string]string{
+		"Digitally Imported - Trance":      "Trance",
+		"RadioTunes - Jazz - Smooth Jazz":  "Smooth Jazz",
+		"Trance":                           "Trance",
+		"Digitally Imported - Drum-n-Bass": "Drum-n-Bass",
+		"":                                 "",
+	} {
+		e := &playlistEntry{Title: title}
+		if got := e.channelName(); got != want {
+			t.Errorf("channel name %q for %q, want %q", got, title, want)
+		}
+	}
+}
+
+func TestFavoritesByListenKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/public3/favorites.pls" || r.URL.RawQuery != "secret" {
+			t.Errorf("request for %s", r.URL)
+		}
+		fmt.Fprint(w, "[playlist]\n"+
+			"File3=http://pub1.di.fm/di_gone?secret\nTitle3=Digitally Imported - Gone\n"+
+			"File1=http://pub1.di.fm/di_dub_hi?secret\nTitle1=Digitally Imported - Dub\n"+
+			"File2=http://pub1.di.fm/di_renamed?secret\nTitle2=Digitally Imported - Vocal Trance\n")
+	}))
+	defer srv.Close()
+
+	n := &Network{Key: "di", ListenURLBase: srv.URL}
+	dub := &Channel{Key: "dub", Name: "Dub"}
+	vocalTrance := &Channel{Key: "vocaltrance", Name: "Vocal Trance"}
+	trance := &Channel{Key: "trance", Name: "Trance"}
+	favorites, err := n.FavoritesByListenKey("secret", []*Channel{trance, vocalTrance, dub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the renamed channel is found by its name, the channel that is gone is skipped
+	if want := []*Channel{dub, vocalTrance}; !reflect.DeepEqual(favorites, want) {
+		t.Fatalf("favorites %v, want %v", favorites, want)
+	}
+}
+
+func TestFavoritesByListenKeyStatus(t *testing.T) {
+	for status, invalid := range map[int]bool{
+		http.StatusUnauthorized:        true,
+		http.StatusForbidden:           true,
+		http.StatusNotFound:            false,
+		http.StatusInternalServerError: false,
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		n := &Network{Key: "di", ListenURLBase: srv.URL}
+		_, err := n.FavoritesByListenKey("secret", nil)
+		srv.Close()
+		if err == nil {
+			t.Errorf("no error for status %d", status)
+			continue
+		}
+		if (err == ErrInvalidListenKey) != invalid {
+			t.Errorf("error %v for status %d, invalid listen key is %v", err, status, invalid)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+var (
+	// ErrInvalidListenKey is returned when a listen key is not accepted by the AudioAddict servers.
+	ErrInvalidListenKey = errors.New("invalid or expired listen key")
+)
+
+// ValidateListenKey checks if the listen key is valid on the network, and whether it unlocks premium streams.
+// There is no API method for this, so it is done as described in the API documentation:
+// download the favorites playlist to check the key is valid, then connect to a premium stream to check for premium.
+// When the listen key is not valid, ErrInvalidListenKey is returned.
+func (n *Network) ValidateListenKey(listenKey string) (premium bool, err error) {
+	_, err = n.favoritesPlaylist(listenKey)
+	if err != nil {
+		return false, err
+	}
+
+	sl := n.BestStreamlist(true)
+	if sl == nil {
+		// network has no premium streams
+		return false, nil
+	}
+	channels, err := sl.Channels()
+	if err != nil {
+		return false, err
+	}
+	if len(channels) == 0 {
+		return false, nil
+	}
+	streamURLs, err := channels[0].StreamURLs(&Account{ListenKey: listenKey, Premium: true})
+	if err != nil {
+		return false, err
+	}
+	if len(streamURLs) == 0 {
+		return false, nil
+	}
+
+	// connect to the stream and hang up as soon as the headers tell if we're allowed in
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURLs[0], nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	cancel()
+	resp.Body.Close()
+	return resp.StatusCode == 200, nil
+}
+
+// AuthenticateListenKey validates the listen key and returns an Account for it.
+// Only the ListenKey and Premium fields are set, favorites can be obtained with (*Network).FavoritesByListenKey().
+func (n *Network) AuthenticateListenKey(listenKey string) (*Account, error) {
+	premium, err := n.ValidateListenKey(listenKey)
+	if err != nil {
+		return nil, err
+	}
+	a := &Account{
+		ListenKey: listenKey,
+		Premium:   premium,
+	}
+	return a, nil
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newListenKeyNetwork returns a network whose server accepts the listen keys in valid, and the premium ones for its
+// premium stream. The stream doesn't end, like a real one.
+func newListenKeyNetwork(t *testing.T, valid map[string]bool) *Network {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		premium, ok := valid[r.URL.RawQuery]
+		switch r.URL.Path {
+		case "/public3/favorites.pls":
+			if !ok {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, "[playlist]\nNumberOfEntries=0\n")
+		case "/premium_high":
+			fmt.Fprint(w, `[{"id":1,"key":"trance","name":"Trance"}]`)
+		case "/premium_high/trance":
+			fmt.Fprintf(w, "[%q]", srv.URL+"/di_trance_hi?"+r.URL.RawQuery)
+		case "/di_trance_hi":
+			if !premium {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			t.Errorf("request for %s", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	n := &Network{Key: "di", ListenURLBase: srv.URL}
+	n.addStreamlist(&Streamlist{Key: "public3", Bitrate: 64, Encoding: EncodingAAC})
+	n.addStreamlist(&Streamlist{Key: "premium_high", Premium: true, Bitrate: 320, Encoding: EncodingMP3})
+	return n
+}
+
+func TestValidateListenKey(t *testing.T) {
+	n := newListenKeyNetwork(t, map[string]bool{"free": false, "premium": true})
+	tests := []struct {
+		listenKey string
+		premium   bool
+		err       error
+	}{
+		{"free", false, nil},
+		{"premium", true, nil},
+		{"expired", false, ErrInvalidListenKey},
+	}
+	for _, test := range tests {
+		start := time.Now()
+		premium, err := n.ValidateListenKey(test.listenKey)
+		if err != test.err || premium != test.premium {
+			t.Errorf("validated %q as premium %v with error %v, want premium %v with error %v",
+				test.listenKey, premium, err, test.premium, test.err)
+		}
+		if elapsed := time.Since(start); elapsed > requestTimeout/2 {
+			t.Errorf("validating %q took %v, the premium stream wasn't hung up", test.listenKey, elapsed)
+		}
+	}
+}
+
+func TestValidateListenKeyWithoutPremium(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/public3/favorites.pls" {
+			t.Errorf("request for %s on a network without premium streams", r.URL)
+		}
+		fmt.Fprint(w, "[playlist]\n")
+	}))
+	defer srv.Close()
+	n := &Network{Key: "di", ListenURLBase: srv.URL}
+	n.addStreamlist(&Streamlist{Key: "public3", Bitrate: 64, Encoding: EncodingAAC})
+
+	premium, err := n.ValidateListenKey("free")
+	if err != nil || premium {
+		t.Fatalf("premium %v with error %v, want a valid free listen key", premium, err)
+	}
+}
+
+func TestAuthenticateListenKey(t *testing.T) {
+	n := newListenKeyNetwork(t, map[string]bool{"premium": true})
+	a, err := n.AuthenticateListenKey("premium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ListenKey != "premium" || !a.Premium {
+		t.Fatalf("account %+v, want the premium listen key", a)
+	}
+	_, err = n.AuthenticateListenKey("expired")
+	if err != ErrInvalidListenKey {
+		t.Fatalf("error %v for an expired listen key", err)
+	}
+}
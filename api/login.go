@@ -0,0 +1,81 @@
+package api
+
+import (
+	"sync"
+)
+
+// Login is an authenticated AudioAddict account.
+// An AudioAddict account and its subscriptions span all networks, Login provides the Account view for each network
+// without asking the user for credentials again.
+type Login struct {
+	apiKey string
+
+	accountsLock sync.Mutex
+	accounts     map[*Network]*Account
+}
+
+// LoginUserPass authenticates with username and password on network n.
+func LoginUserPass(n *Network, username, password string) (*Login, error) {
+	a, err := n.AuthenticateUserPass(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return newLogin(n, a), nil
+}
+
+// LoginAPIKey authenticates with an api key on network n.
+func LoginAPIKey(n *Network, apikey string) (*Login, error) {
+	a, err := n.AuthenticateAPIKey(apikey)
+	if err != nil {
+		return nil, err
+	}
+	return newLogin(n, a), nil
+}
+
+func newLogin(n *Network, a *Account) *Login {
+	l := &Login{
+		apiKey:   a.APIKey,
+		accounts: map[*Network]*Account{n: a},
+	}
+	return l
+}
+
+// APIKey returns the api key for the login, which is the same on all networks.
+func (l *Login) APIKey() string {
+	return l.apiKey
+}
+
+// Account returns the Account view for network n.
+// Each network has its own favorites and premium status, these are fetched from the server on the first call for a network.
+func (l *Login) Account(n *Network) (*Account, error) {
+	l.accountsLock.Lock()
+	defer l.accountsLock.Unlock()
+
+	if a, ok := l.accounts[n]; ok {
+		return a, nil
+	}
+	a, err := n.AuthenticateAPIKey(l.apiKey)
+	if err != nil {
+		return nil, err
+	}
+	l.accounts[n] = a
+	return a, nil
+}
+
+// Accounts returns the Account view for every network in NetworkList. A network that fails doesn't stop the others,
+// its error is returned in errs instead. errs is nil when all accounts were returned.
+func (l *Login) Accounts() (accounts map[*Network]*Account, errs map[*Network]error) {
+	accounts = make(map[*Network]*Account)
+	for _, n := range NetworkList {
+		a, err := l.Account(n)
+		if err != nil {
+			if errs == nil {
+				errs = make(map[*Network]error)
+			}
+			errs[n] = err
+			continue
+		}
+		accounts[n] = a
+	}
+	return accounts, errs
+}
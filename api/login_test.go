@@ -0,0 +1,54 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoginAccounts(t *testing.T) {
+	aa, bb, cc := &Network{Key: "aa"}, &Network{Key: "bb"}, &Network{Key: "cc"}
+	networks := NetworkList
+	NetworkList = []*Network{aa, bb, cc}
+	defer func() { NetworkList = networks }()
+
+	// the members of cc don't know the api key
+	var authenticated []string
+	serveAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/"), "/members/authenticate")
+		authenticated = append(authenticated, key)
+		if r.PostFormValue("api_key") != "apikey" || key == "cc" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, `{"api_key":"apikey","listen_key":"listen-%s"}`, key)
+	})
+
+	login, err := LoginAPIKey(aa, "apikey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login.APIKey() != "apikey" {
+		t.Fatalf("api key %q", login.APIKey())
+	}
+	a, err := login.Account(aa)
+	if err != nil || a.ListenKey != "listen-aa" {
+		t.Fatalf("account %+v with error %v on the network of the login", a, err)
+	}
+
+	accounts, errs := login.Accounts()
+	if len(accounts) != 2 || accounts[aa] != a || accounts[bb].ListenKey != "listen-bb" {
+		t.Fatalf("accounts %v, want those of aa and bb", accounts)
+	}
+	if len(errs) != 1 || errs[cc] != ErrInvalidCredentials {
+		t.Fatalf("errors %v, want invalid credentials on cc", errs)
+	}
+
+	// accounts are fetched once, failed networks are tried again
+	login.Accounts()
+	if want := []string{"aa", "bb", "cc", "cc"}; !reflect.DeepEqual(authenticated, want) {
+		t.Fatalf("authenticated on %q, want %q", authenticated, want)
+	}
+}
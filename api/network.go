@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 )
 
 var (
@@ -22,6 +21,9 @@ type Network struct {
 	//++ TODO: unexport?
 	ListenURLBase string
 
+	// WebsiteURL is the base URL for the network website, used for web-session login.
+	WebsiteURL string
+
 	// Key is to be used with certain API calls
 	//++ TODO: unexport?
 	Key string
@@ -69,7 +71,7 @@ func (n *Network) StreamlistByKey(key string) (*Streamlist, error) {
 
 func (n *Network) TrackHistory() (map[string]*Track, error) {
 	url := fmt.Sprintf("%s/%s/track_history", APIBaseURL, n.Key)
-	resp, err := http.Get(url)
+	resp, err := httpClient.Get(url)
 	if err != nil {
 		return nil, err
 	}
@@ -7,14 +7,33 @@ var (
 	// NetworkRadioTunes contains the network parameters for RadioTunes.com radio.
 	NetworkRadioTunes *Network
 
+	// NetworkJazzRadio contains the network parameters for JazzRadio.com radio.
+	NetworkJazzRadio *Network
+
+	// NetworkRockRadio contains the network parameters for RockRadio.com radio.
+	NetworkRockRadio *Network
+
 	// NetworkList contains all networks defined by this package, it is possible to add/remove items from this list.
-	NetworkList = []*Network{NetworkDI, NetworkRadioTunes}
+	// The list is filled in init(), since the networks are not available before that.
+	NetworkList []*Network
 )
 
+// NetworkByKey looks up the network with given key in NetworkList.
+// When none is found, nil is returned.
+func NetworkByKey(key string) *Network {
+	for _, n := range NetworkList {
+		if n.Key == key {
+			return n
+		}
+	}
+	return nil
+}
+
 func init() {
 	NetworkDI = &Network{
 		Name:          "di.fm",
 		ListenURLBase: "http://listen.di.fm",
+		WebsiteURL:    "https://www.di.fm",
 		Key:           "di",
 	}
 	NetworkDI.addStreamlist(&Streamlist{
@@ -60,6 +79,7 @@ func init() {
 	NetworkRadioTunes = &Network{
 		Name:          "RadioTunes",
 		ListenURLBase: "http://listen.radiotunes.com",
+		WebsiteURL:    "https://www.radiotunes.com",
 		Key:           "radiotunes",
 		// Streamlists:   make(map[string]*Streamlist),
 	}
@@ -102,4 +122,77 @@ func init() {
 		Bitrate:  256,
 		Encoding: EncodingMP3,
 	})
+
+	NetworkJazzRadio = &Network{
+		Name:          "JazzRadio",
+		ListenURLBase: "http://listen.jazzradio.com",
+		WebsiteURL:    "https://www.jazzradio.com",
+		Key:           "jazzradio",
+	}
+	NetworkJazzRadio.addStreamlist(&Streamlist{
+		Key:      "public1",
+		Bitrate:  40,
+		Encoding: EncodingAAC,
+	})
+	NetworkJazzRadio.addStreamlist(&Streamlist{
+		Key:      "public3",
+		Bitrate:  64,
+		Encoding: EncodingMP3,
+	})
+	NetworkJazzRadio.addStreamlist(&Streamlist{
+		Key:      "premium_low",
+		Premium:  true,
+		Bitrate:  40,
+		Encoding: EncodingAAC,
+	})
+	NetworkJazzRadio.addStreamlist(&Streamlist{
+		Key:      "premium_medium",
+		Premium:  true,
+		Bitrate:  64,
+		Encoding: EncodingAAC,
+	})
+	NetworkJazzRadio.addStreamlist(&Streamlist{
+		Key:      "premium",
+		Premium:  true,
+		Bitrate:  128,
+		Encoding: EncodingAAC,
+	})
+	NetworkJazzRadio.addStreamlist(&Streamlist{
+		Key:      "premium_high",
+		Premium:  true,
+		Bitrate:  256,
+		Encoding: EncodingMP3,
+	})
+
+	NetworkRockRadio = &Network{
+		Name:          "RockRadio",
+		ListenURLBase: "http://listen.rockradio.com",
+		WebsiteURL:    "https://www.rockradio.com",
+		Key:           "rockradio",
+	}
+	NetworkRockRadio.addStreamlist(&Streamlist{
+		Key:      "public3",
+		Bitrate:  96,
+		Encoding: EncodingMP3,
+	})
+	NetworkRockRadio.addStreamlist(&Streamlist{
+		Key:      "android_premium_medium",
+		Premium:  true,
+		Bitrate:  64,
+		Encoding: EncodingAAC,
+	})
+	NetworkRockRadio.addStreamlist(&Streamlist{
+		Key:      "android_premium",
+		Premium:  true,
+		Bitrate:  128,
+		Encoding: EncodingAAC,
+	})
+	NetworkRockRadio.addStreamlist(&Streamlist{
+		Key:      "android_premium_high",
+		Premium:  true,
+		Bitrate:  256,
+		Encoding: EncodingMP3,
+	})
+
+	NetworkList = []*Network{NetworkDI, NetworkRadioTunes, NetworkJazzRadio, NetworkRockRadio}
 }
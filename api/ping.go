@@ -2,24 +2,42 @@ package api
 
 import (
 	"encoding/json"
-	"net/http"
+	"errors"
 	"time"
 )
 
+// pingTimeResolution is the resolution of the server time in a ping response.
+const pingTimeResolution = 1 * time.Second
+
 // PingInfo holds the information that is sent back by the audioaddict api server on a ping request.
 type PingInfo struct {
 	APIVersion float64
 	Time       time.Time // NOTE: server time is converted to a time.Time value in the UTC timezone.
 	IP         string
 	Country    string
+
+	// RoundTrip is the time it took to send the ping request and receive the response.
+	RoundTrip time.Duration
+
+	// Offset is the estimated difference between server time and local time (server minus local).
+	// It assumes the server time was taken halfway the round trip.
+	Offset time.Duration
+}
+
+// Uncertainty returns the maximum error of Offset.
+// The server could have taken its time anywhere during the round trip, and only sends whole seconds.
+func (pi *PingInfo) Uncertainty() time.Duration {
+	return pi.RoundTrip/2 + pingTimeResolution/2
 }
 
 // Ping pings the server, this returns some information about the location of this client, and provides the client with the current servertime.
 func Ping() (*PingInfo, error) {
-	resp, err := http.Get(`http://api.audioaddict.com/v1/ping`)
+	sent := time.Now()
+	resp, err := httpClient.Get(APIBaseURL + `/ping`)
 	if err != nil {
 		return nil, err
 	}
+	roundTrip := time.Since(sent)
 	defer resp.Body.Close()
 	var apiInfo struct {
 		APIVersion float64 `json:"api_version"`
@@ -35,11 +53,41 @@ func Ping() (*PingInfo, error) {
 	if err != nil {
 		return nil, err
 	}
+	// server time is truncated to whole seconds, so the middle of that second is the best guess
+	serverTime := t.Add(pingTimeResolution / 2)
+	localTime := sent.Add(roundTrip / 2)
 	pi := &PingInfo{
 		APIVersion: apiInfo.APIVersion,
 		Time:       t.In(time.UTC),
 		IP:         apiInfo.IP,
 		Country:    apiInfo.Country,
+		RoundTrip:  roundTrip,
+		Offset:     serverTime.Sub(localTime),
 	}
 	return pi, nil
 }
+
+// EstimateOffset pings the server multiple times and returns the PingInfo with the lowest round trip time.
+// Like NTP, this assumes the fastest sample has the least asymmetric delay and thus the most accurate Offset.
+// Failed pings are ignored, an error is only returned when all pings fail.
+func EstimateOffset(samples int) (*PingInfo, error) {
+	if samples < 1 {
+		return nil, errors.New("need at least one sample to estimate offset")
+	}
+	var best *PingInfo
+	var lastErr error
+	for i := 0; i < samples; i++ {
+		pi, err := Ping()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if best == nil || pi.RoundTrip < best.RoundTrip {
+			best = pi
+		}
+	}
+	if best == nil {
+		return nil, lastErr
+	}
+	return best, nil
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// redirectTransport sends all requests to a test server.
+type redirectTransport struct {
+	server *url.URL
+}
+
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.server.Scheme
+	req.URL.Host = t.server.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// serveAPI sends the requests to the AudioAddict api to handler, until the end of the test.
+func serveAPI(t *testing.T, handler http.HandlerFunc) {
+	srv := httptest.NewServer(handler)
+	serverURL, _ := url.Parse(srv.URL)
+	client := httpClient
+	httpClient = &http.Client{Transport: &redirectTransport{server: serverURL}, Timeout: client.Timeout}
+	t.Cleanup(func() {
+		httpClient = client
+		srv.Close()
+	})
+}
+
+// pong is the response to a ping, sent after delay. A pong without time fails.
+type pong struct {
+	delay time.Duration
+	time  string
+}
+
+// servePongs responds to the pings with the pongs in turn.
+func servePongs(t *testing.T, pongs []pong) {
+	i := 0
+	serveAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/ping" {
+			t.Errorf("request for %s", r.URL)
+		}
+		p := pongs[i%len(pongs)]
+		i++
+		time.Sleep(p.delay)
+		if p.time == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, `{"api_version":1.1,"time":%q,"ip":"192.0.2.1","country":"NL"}`, p.time)
+	})
+}
+
+func TestPing(t *testing.T) {
+	servePongs(t, []pong{{0, "Mon, 19 Oct 2026 09:30:00 +0200"}})
+	pi, err := Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 10, 19, 7, 30, 0, 0, time.UTC); pi.Time != want {
+		t.Errorf("time %v, want %v", pi.Time, want)
+	}
+	if pi.APIVersion != 1.1 || pi.IP != "192.0.2.1" || pi.Country != "NL" {
+		t.Errorf("ping info %+v", pi)
+	}
+	if pi.RoundTrip <= 0 || pi.Uncertainty() != pi.RoundTrip/2+pingTimeResolution/2 {
+		t.Errorf("round trip %v with uncertainty %v", pi.RoundTrip, pi.Uncertainty())
+	}
+}
+
+func TestEstimateOffset(t *testing.T) {
+	// the fastest ping has the 09:30:02 time
+	servePongs(t, []pong{
+		{60 * time.Millisecond, "Mon, 19 Oct 2026 09:30:00 +0000"},
+		{0, ""},
+		{0, "Mon, 19 Oct 2026 09:30:02 +0000"},
+		{40 * time.Millisecond, "Mon, 19 Oct 2026 09:30:03 +0000"},
+	})
+	pi, err := EstimateOffset(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.Time.Second() != 2 {
+		t.Fatalf("sample of %v with round trip %v, want the fastest", pi.Time, pi.RoundTrip)
+	}
+	if pi.RoundTrip >= 40*time.Millisecond {
+		t.Fatalf("round trip %v of the fastest sample", pi.RoundTrip)
+	}
+}
+
+func TestEstimateOffsetFailing(t *testing.T) {
+	servePongs(t, []pong{{0, ""}})
+	if _, err := EstimateOffset(3); err == nil {
+		t.Fatal("no error when all pings failed")
+	}
+	if _, err := EstimateOffset(0); err == nil {
+		t.Fatal("no error without samples")
+	}
+}
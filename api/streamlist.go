@@ -3,7 +3,6 @@ package api
 import (
 	"encoding/json"
 	"fmt"
-	"net/http"
 )
 
 // Streamlist defines
@@ -37,7 +36,7 @@ func (sl *Streamlist) Name() string {
 func (sl *Streamlist) Channels() ([]*Channel, error) {
 	// fetch channels from server
 	url := fmt.Sprintf("%s/%s", sl.Network.ListenURLBase, sl.Key)
-	resp, err := http.Get(url)
+	resp, err := httpClient.Get(url)
 	if err != nil {
 		return nil, err
 	}
@@ -1,5 +1,9 @@
 package api
 
+import (
+	"strings"
+)
+
 type Track struct {
 	Name          string            `json:"track"`
 	Type          string            `json:"type"`
@@ -21,3 +25,34 @@ type Track struct {
 func (t *Track) ArtURLHTTPS() string {
 	return "https:" + t.ArtURL
 }
+
+// MatchesStreamTitle returns true when the stream title, as sent in the stream metadata, is this track.
+// Streams send "Artist - Title", which is usually the track name, but may differ in case and spacing.
+func (t *Track) MatchesStreamTitle(streamTitle string) bool {
+	if t.Type != "track" {
+		return false
+	}
+	title := normalizeTitle(streamTitle)
+	if title == "" {
+		return false
+	}
+	if title == normalizeTitle(t.Name) {
+		return true
+	}
+	return title == normalizeTitle(t.DisplayArtist+" - "+t.DisplayTitle) || title == normalizeTitle(t.Artist+" - "+t.Title)
+}
+
+// normalizeTitle lowercases a title and collapses its whitespace.
+func normalizeTitle(title string) string {
+	return strings.Join(strings.Fields(strings.ToLower(title)), " ")
+}
+
+// Match returns the most recent track that matches the stream title, or nil when there is none.
+func (t Tracklist) Match(streamTitle string) *Track {
+	for _, track := range t {
+		if track.MatchesStreamTitle(streamTitle) {
+			return track
+		}
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrNoWebsite is returned when a web-session is requested for a network without WebsiteURL.
+	ErrNoWebsite = errors.New("network has no website for web-session login")
+)
+
+// WebSession is a logged in session on the network website, as used by the webplayer.
+// It is an alternative to the members/authenticate API, which can be used when that API is not available.
+type WebSession struct {
+	// Network on which the session was created
+	Network *Network
+
+	client  *http.Client
+	siteURL *url.URL
+}
+
+// newWebSession creates a WebSession with an empty cookie jar.
+func (n *Network) newWebSession() (*WebSession, error) {
+	if n.WebsiteURL == "" {
+		return nil, ErrNoWebsite
+	}
+	siteURL, err := url.Parse(n.WebsiteURL)
+	if err != nil {
+		return nil, err
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	s := &WebSession{
+		Network: n,
+		client:  &http.Client{Jar: jar, Transport: httpClient.Transport, Timeout: httpClient.Timeout},
+		siteURL: siteURL,
+	}
+	return s, nil
+}
+
+// LoginWebSession logs in on the network website with username and password.
+// The session cookie can be saved with (*WebSession).Cookie() and restored with (*Network).RestoreWebSession().
+func (n *Network) LoginWebSession(username, password string) (*WebSession, error) {
+	s, err := n.newWebSession()
+	if err != nil {
+		return nil, err
+	}
+
+	loginURL := n.WebsiteURL + `/login`
+	resp, err := s.client.PostForm(loginURL, url.Values{
+		"member_session[username]":    {username},
+		"member_session[password]":    {password},
+		"member_session[remember_me]": {"1"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == 401 || resp.StatusCode == 403 || resp.StatusCode == 422:
+		return nil, ErrInvalidCredentials
+	case resp.StatusCode >= 400:
+		return nil, ErrCantAuthenticate
+	}
+	if len(s.client.Jar.Cookies(s.siteURL)) == 0 {
+		return nil, ErrCantAuthenticate
+	}
+	return s, nil
+}
+
+// RestoreWebSession restores a WebSession from a cookie previously obtained with (*WebSession).Cookie().
+func (n *Network) RestoreWebSession(cookie string) (*WebSession, error) {
+	s, err := n.newWebSession()
+	if err != nil {
+		return nil, err
+	}
+	// let net/http do the cookie header parsing
+	req := &http.Request{Header: http.Header{"Cookie": {cookie}}}
+	s.client.Jar.SetCookies(s.siteURL, req.Cookies())
+	return s, nil
+}
+
+// Cookie returns the session cookie so it can be persisted and restored later.
+func (s *WebSession) Cookie() string {
+	var pairs []string
+	for _, c := range s.client.Jar.Cookies(s.siteURL) {
+		pairs = append(pairs, c.Name+"="+c.Value)
+	}
+	return strings.Join(pairs, "; ")
+}
+
+// WebplayerConfig fetches the webplayer configuration for this session.
+// When the session is no longer logged in, ErrInvalidCredentials is returned.
+func (s *WebSession) WebplayerConfig() (*WebplayerConfig, error) {
+	configURL := s.Network.WebsiteURL + `/webplayer3/config`
+	resp, err := s.client.Get(configURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected response for webplayer config: %s", resp.Status)
+	}
+
+	var configResult struct {
+		API struct {
+			Config webplayerConfigResult `json:"Config"`
+		} `json:"API"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&configResult)
+	if err != nil {
+		return nil, err
+	}
+	if configResult.API.Config.Member == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	wc := &WebplayerConfig{
+		network: s.Network,
+		config:  &configResult.API.Config,
+	}
+	return wc, nil
+}
+
+// webplayerConfigResult is the part of the webplayer configuration that is used by this package.
+// It is one big blob, see the bottom of this file for the relevant parts.
+type webplayerConfigResult struct {
+	Channels []struct {
+		ID   int    `json:"id"`
+		Key  string `json:"key"`
+		Name string `json:"name"`
+	} `json:"channels"`
+	Member      *memberResult `json:"member"`
+	Streamlists map[string]struct {
+		Bitrate int    `json:"bitrate"`
+		Codec   string `json:"codec"`
+		Premium bool   `json:"premium"`
+	} `json:"streamlists"`
+}
+
+// WebplayerConfig holds the channels, streamlists and account information from the webplayer configuration.
+type WebplayerConfig struct {
+	network *Network
+	config  *webplayerConfigResult
+}
+
+// Account returns the account for the logged in member.
+func (wc *WebplayerConfig) Account() *Account {
+	return wc.config.Member.account(wc.network)
+}
+
+// Streamlists returns the streamlists in the webplayer configuration, sorted by key.
+// Streamlists that are known by the network are re-used, others are created with a reference to the network.
+func (wc *WebplayerConfig) Streamlists() []*Streamlist {
+	var keys []string
+	for key := range wc.config.Streamlists {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var streamlists []*Streamlist
+	for _, key := range keys {
+		sl, err := wc.network.StreamlistByKey(key)
+		if err == nil {
+			streamlists = append(streamlists, sl)
+			continue
+		}
+		slResult := wc.config.Streamlists[key]
+		streamlists = append(streamlists, &Streamlist{
+			Network:  wc.network,
+			Key:      key,
+			Premium:  slResult.Premium,
+			Bitrate:  slResult.Bitrate,
+			Encoding: Encoding(strings.ToUpper(slResult.Codec)),
+		})
+	}
+	return streamlists
+}
+
+// Channels returns the channels in the webplayer configuration for given Streamlist.
+// This is the same list as returned by (*Streamlist).Channels(), without doing another request.
+func (wc *WebplayerConfig) Channels(sl *Streamlist) []*Channel {
+	channels := make([]*Channel, 0, len(wc.config.Channels))
+	for _, chResult := range wc.config.Channels {
+		channels = append(channels, &Channel{
+			Network:    wc.network,
+			Streamlist: sl,
+			ID:         chResult.ID,
+			Key:        chResult.Key,
+			Name:       chResult.Name,
+			Playlist:   fmt.Sprintf("%s/%s/%s.pls", wc.network.ListenURLBase, sl.Key, chResult.Key),
+		})
+	}
+	return channels
+}
+
+// Webplayer config structure (shortened):
+// {
+// 	"API":{
+// 		"Config":{
+// 			"channels":[
+// 				{
+// 					"id":1,
+// 					"key":"trance",
+// 					"name":"Trance",
+// 					...
+// 				},
+// 				...
+// 			],
+// 			"member":{
+// 				"api_key":"<your api key>",
+// 				"id":66910,
+// 				"listen_key":"<your listen key>",
+// 				"network_favorite_channels":[...],
+// 				"subscriptions":[...],
+// 				...
+// 			},
+// 			"streamlists":{
+// 				"premium_high":{
+// 					"bitrate":256,
+// 					"codec":"mp3",
+// 					"premium":true
+// 				},
+// 				...
+// 			},
+// 			...
+// 		}
+// 	}
+// }
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// webplayerConfigJSON is a shortened webplayer config, with member filled in when logged in.
+const webplayerConfigJSON = `{"API":{"Config":{
+	"channels":[{"id":1,"key":"trance","name":"Trance"},{"id":2,"key":"dub","name":"Dub"}],
+	"member":%s,
+	"streamlists":{
+		"premium_high":{"bitrate":320,"codec":"mp3","premium":true},
+		"public1":{"bitrate":64,"codec":"aac","premium":false},
+		"webplayer":{"bitrate":128,"codec":"aac","premium":false}
+	}
+}}}`
+
+const memberJSON = `{"api_key":"apikey","id":66910,"listen_key":"listenkey","first_name":"Jo","last_name":"Doe",
+	"network_favorite_channels":[{"channel_id":2},{"channel_id":1}],
+	"subscriptions":[
+		{"status":"expired","services":[{"key":"di-premium"}]},
+		{"status":"active","services":[{"key":"radiotunes-premium"},{"key":"di-premium"}]}
+	]}`
+
+// newWebsite returns a network whose website logs in jo with secret, and serves the webplayer config.
+func newWebsite(t *testing.T) *Network {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			if r.PostFormValue("member_session[username]") != "jo" || r.PostFormValue("member_session[password]") != "secret" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "_session", Value: "s3ss10n", Path: "/"})
+		case "/webplayer3/config":
+			member := "null"
+			if c, err := r.Cookie("_session"); err == nil && c.Value == "s3ss10n" {
+				member = memberJSON
+			}
+			fmt.Fprintf(w, webplayerConfigJSON, member)
+		default:
+			t.Errorf("request for %s", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	n := &Network{Key: "di", ListenURLBase: "http://listen.di.fm", WebsiteURL: srv.URL}
+	n.addStreamlist(&Streamlist{Key: "premium_high", Premium: true, Bitrate: 320, Encoding: EncodingMP3})
+	return n
+}
+
+func TestWebSession(t *testing.T) {
+	n := newWebsite(t)
+	s, err := n.LoginWebSession("jo", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wc, err := s.WebplayerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Account{
+		ID:        66910,
+		APIKey:    "apikey",
+		ListenKey: "listenkey",
+		Firstname: "Jo",
+		Lastname:  "Doe",
+		Favorites: []int{2, 1},
+		Premium:   true,
+	}
+	if a := wc.Account(); !reflect.DeepEqual(a, want) {
+		t.Fatalf("account %+v, want %+v", a, want)
+	}
+
+	// the known streamlist is re-used, the others come from the config
+	streamlists := wc.Streamlists()
+	if len(streamlists) != 3 {
+		t.Fatalf("%d streamlists, want 3", len(streamlists))
+	}
+	if streamlists[0] != n.Streamlists[0] {
+		t.Errorf("streamlist %+v, want the one of the network", streamlists[0])
+	}
+	wantPublic := Streamlist{Network: n, Key: "public1", Bitrate: 64, Encoding: EncodingAAC}
+	if *streamlists[1] != wantPublic {
+		t.Errorf("streamlist %+v, want %+v", *streamlists[1], wantPublic)
+	}
+	if streamlists[2].Key != "webplayer" {
+		t.Errorf("streamlist %q, want them sorted by key", streamlists[2].Key)
+	}
+
+	channels := wc.Channels(streamlists[1])
+	wantChannels := []*Channel{
+		{Network: n, Streamlist: streamlists[1], ID: 1, Key: "trance", Name: "Trance", Playlist: "http://listen.di.fm/public1/trance.pls"},
+		{Network: n, Streamlist: streamlists[1], ID: 2, Key: "dub", Name: "Dub", Playlist: "http://listen.di.fm/public1/dub.pls"},
+	}
+	if !reflect.DeepEqual(channels, wantChannels) {
+		t.Fatalf("channels %+v, want %+v", channels, wantChannels)
+	}
+}
+
+func TestWebSessionWithoutPremium(t *testing.T) {
+	n := newWebsite(t)
+	n.Key = "classicalradio"
+	s, err := n.LoginWebSession("jo", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wc, err := s.WebplayerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wc.Account().Premium {
+		t.Fatal("premium on a network that isn't in the subscription")
+	}
+}
+
+func TestWebSessionRestore(t *testing.T) {
+	n := newWebsite(t)
+	s, err := n.LoginWebSession("jo", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie := s.Cookie()
+	if cookie != "_session=s3ss10n" {
+		t.Fatalf("cookie %q", cookie)
+	}
+
+	restored, err := n.RestoreWebSession(cookie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wc, err := restored.WebplayerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wc.Account().APIKey != "apikey" {
+		t.Fatalf("account %+v from the restored session", wc.Account())
+	}
+
+	// an expired session gets a config without member
+	expired, err := n.RestoreWebSession("_session=expired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = expired.WebplayerConfig()
+	if err != ErrInvalidCredentials {
+		t.Fatalf("error %v for an expired session, want invalid credentials", err)
+	}
+}
+
+func TestLoginWebSessionInvalid(t *testing.T) {
+	n := newWebsite(t)
+	_, err := n.LoginWebSession("jo", "wrong")
+	if err != ErrInvalidCredentials {
+		t.Fatalf("error %v for a wrong password, want invalid credentials", err)
+	}
+
+	n.WebsiteURL = ""
+	_, err = n.LoginWebSession("jo", "secret")
+	if err != ErrNoWebsite {
+		t.Fatalf("error %v without website, want ErrNoWebsite", err)
+	}
+}
@@ -1,6 +1,7 @@
 package clock
 
 import (
+	"sync"
 	"time"
 )
 
@@ -8,44 +9,217 @@ import (
 // Most users won't run ntpd or some thing simliar.
 // Since the AudioAddict servers' time might not be in sync with the client machine,
 // we need a custom clock to stay in sync with the server time.
-// TODO: Go 1.8(?) introduced monotonic clock in time.Time.
-// Use the walltime from server together with a local monotonic time and apply the diff based on local monotonic time.
+// The clock stores the server time at the last sync, and advances it with the local monotonic time,
+// so it isn't affected by changes to the local walltime or by scheduling lag.
 type Clock struct {
-	t time.Time
+	base Interface
 
-	chGet chan chan time.Time
+	lock        sync.RWMutex
+	syncLocal   time.Time // local time at last sync, carries a monotonic clock reading
+	syncServer  time.Time // server time at last sync
+	offset      time.Duration
+	uncertainty time.Duration
+	outliers    []sample // consecutive observations that disagree with the clock
+
+	chClose chan struct{}
+	closed  bool
+}
+
+const (
+	// dateResolution is the resolution of the HTTP Date header.
+	dateResolution = 1 * time.Second
+
+	// driftDivisor sets how fast the uncertainty grows after a sync, as a fraction of the elapsed time (500ppm).
+	driftDivisor = 2000
+
+	// maxOutliers is the number of consecutive, mutually agreeing outliers after which the clock jumps to them.
+	// This happens when the local clock was changed, or after the machine resumed from sleep.
+	maxOutliers = 3
+
+	// minUncertainty keeps observations from making the clock look exact, zero uncertainty means unknown.
+	minUncertainty = 1 * time.Millisecond
+)
+
+// sample is an observed offset, with its maximum error.
+type sample struct {
+	offset      time.Duration
+	uncertainty time.Duration
+}
+
+func (s sample) min() time.Duration { return s.offset - s.uncertainty }
+func (s sample) max() time.Duration { return s.offset + s.uncertainty }
+
+// SyncFunc obtains the difference between server time and local time (server minus local),
+// and the maximum error of that offset.
+type SyncFunc func() (offset, uncertainty time.Duration, err error)
+
+// New creates a new Clock, offset is the difference between server time and local time (server minus local).
+// The uncertainty is the maximum error of offset, use zero when unknown so the first observation is taken as is.
+func New(offset, uncertainty time.Duration) *Clock {
+	return NewWithBase(Real, offset, uncertainty)
 }
 
-// New creates a new Clock and assume t is the current time.
-func New(t time.Time) *Clock {
+// NewWithBase creates a new Clock that runs on the local time provided by base.
+func NewWithBase(base Interface, offset, uncertainty time.Duration) *Clock {
 	c := &Clock{
-		t:     t,
-		chGet: make(chan chan time.Time),
+		base:    base,
+		chClose: make(chan struct{}),
 	}
-	go c.run()
+	c.Sync(offset, uncertainty)
 	return c
 }
 
-func (c *Clock) run() {
-	sec := 1 * time.Second
-	ticker := time.NewTicker(sec)
-	for {
-		select {
-		case <-ticker.C:
-			// TODO: this probably needs buffering for more accuracy? time.Ticker does not accomodate for read-lag larger than the interval duration (1 sec).
-			// https://play.golang.org/p/Ixmx_yvb35
-			// Or don't use a Ticker like this, but calculate offset with machine time.
-			c.t = c.t.Add(sec)
-		case retCh := <-c.chGet:
-			retCh <- c.t
+var _ Interface = (*Clock)(nil)
+
+// Sync resets the clock to a new offset between server time and local time.
+func (c *Clock) Sync(offset, uncertainty time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.syncLocked(offset, uncertainty)
+}
+
+// syncLocked resets the clock, c.lock must be held.
+func (c *Clock) syncLocked(offset, uncertainty time.Duration) {
+	now := c.base.Now()
+	c.syncLocal = now
+	c.syncServer = now.Add(offset).Round(0) // strip monotonic reading, this is a server walltime
+	c.offset = offset
+	c.uncertainty = uncertainty
+	c.outliers = nil
+}
+
+// Observe refines the clock with a server time that was received between the local times sent and received,
+// such as the Date header of an HTTP response. The observation is intersected with the current offset, which
+// narrows the uncertainty over time. Observations that don't agree with the clock are rejected as outliers,
+// unless several consecutive outliers agree with each other.
+func (c *Clock) Observe(serverTime, sent, received time.Time) {
+	roundTrip := received.Sub(sent)
+	if roundTrip < 0 {
+		return
+	}
+	// the server time is truncated, so the middle of that second is the best guess, taken halfway the round trip
+	obs := sample{
+		offset:      serverTime.Add(dateResolution / 2).Sub(sent.Add(roundTrip / 2)),
+		uncertainty: roundTrip/2 + dateResolution/2,
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.uncertainty == 0 {
+		// offset was unknown, anything is better
+		c.syncLocked(obs.offset, obs.uncertainty)
+		return
+	}
+
+	localNow := c.base.Now()
+	elapsed := localNow.Sub(c.syncLocal)
+	cur := sample{
+		offset:      c.syncServer.Add(elapsed).Sub(localNow),
+		uncertainty: c.uncertainty + elapsed/driftDivisor,
+	}
+	if merged, ok := intersect(cur, obs); ok {
+		c.syncLocked(merged.offset, merged.uncertainty)
+		return
+	}
+
+	c.outliers = append(c.outliers, obs)
+	if len(c.outliers) < maxOutliers {
+		return
+	}
+	merged := c.outliers[0]
+	for _, other := range c.outliers[1:] {
+		var ok bool
+		merged, ok = intersect(merged, other)
+		if !ok {
+			// outliers don't agree with each other, keep the most recent ones
+			c.outliers = c.outliers[1:]
+			return
 		}
 	}
+	c.syncLocked(merged.offset, merged.uncertainty)
+}
+
+// intersect returns the overlap of two samples, ok is false when they don't overlap.
+func intersect(a, b sample) (merged sample, ok bool) {
+	lo, hi := a.min(), a.max()
+	if b.min() > lo {
+		lo = b.min()
+	}
+	if b.max() < hi {
+		hi = b.max()
+	}
+	if lo > hi {
+		return sample{}, false
+	}
+	merged = sample{
+		offset:      (lo + hi) / 2,
+		uncertainty: (hi - lo) / 2,
+	}
+	if merged.uncertainty < minUncertainty {
+		merged.uncertainty = minUncertainty
+	}
+	return merged, true
+}
+
+// SyncEvery calls fn every interval and syncs the clock with its result, until the clock is closed.
+// Failed syncs are ignored, the clock keeps running on the last successful sync.
+func (c *Clock) SyncEvery(interval time.Duration, fn SyncFunc) {
+	go func() {
+		ticker := c.base.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.chClose:
+				return
+			case <-ticker.C():
+				offset, uncertainty, err := fn()
+				if err != nil {
+					continue
+				}
+				c.Sync(offset, uncertainty)
+			}
+		}
+	}()
 }
 
 // Now returns the current time according to clock
 func (c *Clock) Now() time.Time {
-	retCh := make(chan time.Time)
-	c.chGet <- retCh
-	t := <-retCh
-	return t
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.syncServer.Add(c.base.Now().Sub(c.syncLocal))
+}
+
+// After waits for the duration to elapse on the local clock and then sends the current server time on the returned channel.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	go func() {
+		<-c.base.After(d)
+		ch <- c.Now()
+	}()
+	return ch
+}
+
+// NewTicker returns a Ticker on the local clock. Ticks carry the local time, use Now for the server time.
+func (c *Clock) NewTicker(d time.Duration) Ticker {
+	return c.base.NewTicker(d)
+}
+
+// Offset returns the difference between server time and local time (server minus local) at the last sync,
+// and the maximum error of that offset.
+func (c *Clock) Offset() (offset, uncertainty time.Duration) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.offset, c.uncertainty
+}
+
+// Close stops syncing the clock. Now keeps working on the last sync.
+func (c *Clock) Close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.chClose)
 }
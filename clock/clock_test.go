@@ -0,0 +1,100 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GeertJohan/tune/clock"
+	"github.com/GeertJohan/tune/clock/clocktest"
+)
+
+var start = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// observe observes a server time that is offset from the local time of base, with a round trip of zero.
+func observe(c *clock.Clock, base *clocktest.Fake, offset time.Duration) {
+	now := base.Now()
+	c.Observe(now.Add(offset), now, now)
+}
+
+func checkOffset(t *testing.T, c *clock.Clock, offset, uncertainty time.Duration) {
+	t.Helper()
+	gotOffset, gotUncertainty := c.Offset()
+	if gotOffset != offset || gotUncertainty != uncertainty {
+		t.Fatalf("offset %v ±%v, want %v ±%v", gotOffset, gotUncertainty, offset, uncertainty)
+	}
+}
+
+func TestObserveUnknown(t *testing.T) {
+	base := clocktest.NewFake(start)
+	c := clock.NewWithBase(base, 0, 0)
+
+	// the Date header is truncated to the second, the middle of the round trip is taken
+	c.Observe(start.Add(10*time.Second), start, start.Add(200*time.Millisecond))
+	checkOffset(t, c, 10400*time.Millisecond, 600*time.Millisecond)
+	if want := start.Add(10400 * time.Millisecond); !c.Now().Equal(want) {
+		t.Fatalf("now %v, want %v", c.Now(), want)
+	}
+
+	base.Advance(time.Minute)
+	if want := start.Add(time.Minute + 10400*time.Millisecond); !c.Now().Equal(want) {
+		t.Fatalf("now %v, want %v", c.Now(), want)
+	}
+}
+
+func TestObserveIntersect(t *testing.T) {
+	base := clocktest.NewFake(start)
+	c := clock.NewWithBase(base, 10400*time.Millisecond, 600*time.Millisecond) // 9.8s to 11s
+
+	// 10s to 11s overlaps completely
+	observe(c, base, 10*time.Second)
+	checkOffset(t, c, 10500*time.Millisecond, 500*time.Millisecond)
+
+	// 10.5s to 11.5s narrows it down to 10.5s to 11s
+	observe(c, base, 10500*time.Millisecond)
+	checkOffset(t, c, 10750*time.Millisecond, 250*time.Millisecond)
+
+	// 11s to 12s only touches, the uncertainty doesn't go below the minimum
+	observe(c, base, 11*time.Second)
+	checkOffset(t, c, 11*time.Second, time.Millisecond)
+}
+
+func TestObserveDrift(t *testing.T) {
+	base := clocktest.NewFake(start)
+	c := clock.NewWithBase(base, 10400*time.Millisecond, 600*time.Millisecond) // 9.8s to 11s
+
+	// after 2000s the uncertainty has grown by 1s to 8.8s to 12s, so 11.5s ±0.5s is no outlier
+	base.Advance(2000 * time.Second)
+	observe(c, base, 11*time.Second)
+	checkOffset(t, c, 11500*time.Millisecond, 500*time.Millisecond)
+}
+
+func TestObserveOutliers(t *testing.T) {
+	base := clocktest.NewFake(start)
+	c := clock.NewWithBase(base, 10400*time.Millisecond, 600*time.Millisecond)
+
+	// outliers that disagree with each other are ignored
+	observe(c, base, time.Minute)
+	observe(c, base, 2*time.Minute)
+	observe(c, base, time.Minute)
+	checkOffset(t, c, 10400*time.Millisecond, 600*time.Millisecond)
+	observe(c, base, time.Minute)
+	checkOffset(t, c, 10400*time.Millisecond, 600*time.Millisecond)
+
+	// the third agreeing outlier in a row resyncs the clock, e.g. after the local time was changed
+	observe(c, base, time.Minute)
+	checkOffset(t, c, time.Minute+500*time.Millisecond, 500*time.Millisecond)
+
+	// an observation that agrees with the clock resets the outliers
+	observe(c, base, 5*time.Minute)
+	observe(c, base, 5*time.Minute)
+	observe(c, base, time.Minute)
+	observe(c, base, 5*time.Minute)
+	checkOffset(t, c, time.Minute+500*time.Millisecond, 500*time.Millisecond)
+}
+
+func TestObserveNegativeRoundTrip(t *testing.T) {
+	base := clocktest.NewFake(start)
+	c := clock.NewWithBase(base, 0, 0)
+	c.Observe(start.Add(time.Hour), start, start.Add(-time.Second))
+	checkOffset(t, c, 0, 0)
+}
@@ -0,0 +1,165 @@
+// Package clocktest provides a manually advanced clock.Interface implementation for tests.
+package clocktest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GeertJohan/tune/clock"
+)
+
+// Fake is a clock.Interface that only moves when Advance or Set is called.
+// Timers and tickers fire synchronously from within Advance, so tests don't have to sleep.
+type Fake struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*waiter
+}
+
+// waiter is a pending After channel or Ticker.
+type waiter struct {
+	at       time.Time
+	interval time.Duration // zero for After
+	ch       chan time.Time
+}
+
+var _ clock.Interface = (*Fake)(nil)
+
+// NewFake creates a new Fake clock set at now.
+func NewFake(now time.Time) *Fake {
+	f := &Fake{
+		now: now,
+	}
+	f.cond = sync.NewCond(&f.lock)
+	return f
+}
+
+// Now returns the current fake time.
+func (f *Fake) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+// After returns a channel that receives the fake time once the clock has been advanced by d.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	w := &waiter{
+		at: f.now.Add(d),
+		ch: make(chan time.Time, 1),
+	}
+	if d <= 0 {
+		w.ch <- f.now
+		return w.ch
+	}
+	f.addWaiter(w)
+	return w.ch
+}
+
+// NewTicker returns a Ticker that ticks every d of fake time.
+// Like time.Ticker, ticks are dropped when the receiver doesn't keep up.
+func (f *Fake) NewTicker(d time.Duration) clock.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	w := &waiter{
+		at:       f.now.Add(d),
+		interval: d,
+		ch:       make(chan time.Time, 1),
+	}
+	f.addWaiter(w)
+	return &fakeTicker{fake: f, w: w}
+}
+
+// addWaiter registers w, f.lock must be held.
+func (f *Fake) addWaiter(w *waiter) {
+	f.waiters = append(f.waiters, w)
+	f.cond.Broadcast()
+}
+
+// removeWaiter unregisters w, f.lock must be held.
+func (f *Fake) removeWaiter(w *waiter) {
+	for i, other := range f.waiters {
+		if other == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// Advance moves the fake time forward by d, firing all timers and tickers that become due on the way, in order.
+func (f *Fake) Advance(d time.Duration) {
+	f.lock.Lock()
+	f.setLocked(f.now.Add(d))
+	f.lock.Unlock()
+}
+
+// Set moves the fake time to t. Timers fire as with Advance, setting a time in the past fires nothing.
+func (f *Fake) Set(t time.Time) {
+	f.lock.Lock()
+	f.setLocked(t)
+	f.lock.Unlock()
+}
+
+func (f *Fake) setLocked(t time.Time) {
+	for {
+		sort.SliceStable(f.waiters, func(i, j int) bool {
+			return f.waiters[i].at.Before(f.waiters[j].at)
+		})
+		if len(f.waiters) == 0 || f.waiters[0].at.After(t) {
+			break
+		}
+		w := f.waiters[0]
+		f.now = w.at
+		select {
+		case w.ch <- f.now:
+		default:
+			// receiver is behind, drop the tick
+		}
+		if w.interval > 0 {
+			w.at = w.at.Add(w.interval)
+		} else {
+			f.waiters = f.waiters[1:]
+		}
+	}
+	if t.After(f.now) {
+		f.now = t
+	}
+}
+
+// Waiters returns the number of pending timers and tickers.
+func (f *Fake) Waiters() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil blocks until at least n timers and tickers are pending.
+// This lets tests wait until the code under test is waiting on the clock, before calling Advance.
+func (f *Fake) BlockUntil(n int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+type fakeTicker struct {
+	fake *Fake
+	w    *waiter
+}
+
+func (ft *fakeTicker) C() <-chan time.Time {
+	return ft.w.ch
+}
+
+func (ft *fakeTicker) Stop() {
+	ft.fake.lock.Lock()
+	defer ft.fake.lock.Unlock()
+	ft.fake.removeWaiter(ft.w)
+}
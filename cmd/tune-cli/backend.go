@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	tuneplayer "github.com/GeertJohan/tune/player"
+	"github.com/GeertJohan/tune/player/otooutput"
+	tunesettings "github.com/GeertJohan/tune/settings"
+)
+
+// newBackend creates the audio backend that is selected in the settings.
+// A nil backend means libvlc, which the player loads itself.
+func newBackend(settings *tunesettings.Settings) (tuneplayer.AudioBackend, error) {
+	switch settings.Player.Backend {
+	case tunesettings.BackendVLC, "":
+		return nil, nil
+	case tunesettings.BackendMPV:
+		if settings.Player.MPVSocket != "" {
+			b, err := tuneplayer.AttachMPVBackend(settings.Player.MPVSocket)
+			if err != nil {
+				return nil, err
+			}
+			return b, nil
+		}
+		b, err := tuneplayer.NewMPVBackend(settings.Player.MPVPath, settings.Player.MPVArgs...)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	case tunesettings.BackendGo:
+		return tuneplayer.NewGoBackend(otooutput.New()), nil
+	default:
+		return nil, fmt.Errorf("unknown audio backend %q", settings.Player.Backend)
+	}
+}
+
+// fades returns the fades from the settings, with a second backend for crossfades when the selected backend can have
+// another instance. An attached mpv is the only one there is, and the go backend has the only audio output.
+func fades(settings *tunesettings.Settings) tuneplayer.Fades {
+	fades := tuneplayer.Fades{
+		In:    time.Duration(settings.Player.FadeInMs) * time.Millisecond,
+		Out:   time.Duration(settings.Player.FadeOutMs) * time.Millisecond,
+		Cross: time.Duration(settings.Player.CrossfadeMs) * time.Millisecond,
+	}
+	switch settings.Player.Backend {
+	case tunesettings.BackendVLC, "":
+		fades.NewBackend = tuneplayer.NewDefaultBackend
+	case tunesettings.BackendMPV:
+		if settings.Player.MPVSocket == "" {
+			path, args := settings.Player.MPVPath, settings.Player.MPVArgs
+			fades.NewBackend = func() (tuneplayer.AudioBackend, error) {
+				b, err := tuneplayer.NewMPVBackend(path, args...)
+				if err != nil {
+					return nil, err
+				}
+				return b, nil
+			}
+		}
+	}
+	return fades
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/foize/go.fifo"
 	"github.com/nsf/termbox-go"
+
+	"github.com/GeertJohan/tune/clock"
 )
 
 const (
@@ -26,9 +28,12 @@ const (
 )
 
 type Display struct {
+	clk clock.Interface
+
 	volume int
 
 	title               string // window title
+	help                string // key help
 	channelKey          string // channel key
 	channelName         string // channel name
 	playing             bool   // indicates if player is currently playing
@@ -39,6 +44,7 @@ type Display struct {
 	channelList         []*channelInfo
 	channelListSelected int
 	channelListStart    int
+	sleepAt             time.Time // when the sleep timer stops playback, zero without sleep timer
 
 	chStop   chan struct{}
 	chLock   chan struct{}
@@ -57,7 +63,7 @@ type channelInfo struct {
 	trackTitle  string
 }
 
-func NewDisplay() (*Display, error) {
+func NewDisplay(clk clock.Interface) (*Display, error) {
 	// init display
 	err := termbox.Init()
 	if err != nil {
@@ -70,6 +76,8 @@ func NewDisplay() (*Display, error) {
 	}
 	termbox.SetOutputMode(termbox.Output256)
 	d := &Display{
+		clk: clk,
+
 		chStop:   make(chan struct{}),
 		chLock:   make(chan struct{}),
 		chUnlock: make(chan struct{}),
@@ -94,20 +102,31 @@ func (d *Display) SetTitle(title string) {
 	d.drawBasics()
 }
 
+// SetHelp sets the key help that is shown at the bottom.
+func (d *Display) SetHelp(help string) {
+	d.lock()
+	defer d.unlock()
+	d.help = help
+	d.drawBasics()
+	termbox.Flush()
+}
+
 func (d *Display) run() {
 	sec := 1 * time.Second
-	ticker := time.NewTicker(sec)
+	ticker := d.clk.NewTicker(sec)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-d.chStop:
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			if d.playing {
 				d.trackPassed += sec
 				d.drawTime()
-				termbox.Flush()
 			}
+			d.drawSleep()
+			termbox.Flush()
 		case <-d.chLock:
 			<-d.chUnlock
 		}
@@ -156,7 +175,7 @@ func (d *Display) notificationManager() {
 		d.unlock()
 
 		// wait before showing next item, until then queue all notifications
-		notificationTimeout := time.After(150 * time.Millisecond)
+		notificationTimeout := d.clk.After(150 * time.Millisecond)
 	waitLoop:
 		for {
 			select {
@@ -175,10 +194,8 @@ func (d *Display) drawBasics() {
 	d.writeText(d.title+` - `, 0, d.size.y-2, colorDefaultForeground, colorBlack)
 
 	// display key help
-	helpmessage := `q: quit  up/down: select channel  space: play/stop  +/-: volume`
-	for i, c := range helpmessage {
-		termbox.SetCell(i, d.size.y-1, c, colorHelpForeground, colorBlack)
-	}
+	x := d.writeText(d.help, 0, d.size.y-1, colorHelpForeground, colorBlack)
+	d.clearRow(x, d.size.y-1, colorBlack)
 }
 func (d *Display) drawChannel() {
 	x := len(d.title) + 3
@@ -189,6 +206,18 @@ func (d *Display) drawTrackTitle() {
 	x := 5
 	x = d.writeText(d.trackTitle, x, 1, colorTrackTitleBackground, colorBlack)
 	d.clearRow(x, 1, colorBlack)
+	d.drawSleep()
+}
+func (d *Display) drawSleep() {
+	if d.sleepAt.IsZero() {
+		return
+	}
+	left := d.sleepAt.Sub(d.clk.Now()).Round(time.Second)
+	if left < 0 {
+		left = 0
+	}
+	sleepStr := fmt.Sprintf(`sleep %02d:%02d`, int(left.Minutes()), int(left.Seconds())%60)
+	d.writeText(sleepStr, d.size.x-len(sleepStr), 1, colorDefaultForeground, colorBlack)
 }
 func (d *Display) drawPlaying() {
 	if d.playing {
@@ -364,6 +393,15 @@ func (d *Display) SetTrackDuration(duration, passed time.Duration) {
 	termbox.Flush()
 }
 
+// SetSleep shows the time that is left until at, the zero time hides it.
+func (d *Display) SetSleep(at time.Time) {
+	d.lock()
+	defer d.unlock()
+	d.sleepAt = at
+	d.drawTrackTitle()
+	termbox.Flush()
+}
+
 func (d *Display) SetVolume(volume int) {
 	d.lock()
 	defer d.unlock()
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+
+	tunesettings "github.com/GeertJohan/tune/settings"
+)
+
+// action is something the user can do with a key
+type action int
+
+const (
+	actionNone action = iota
+	actionQuit
+	actionPlayStop
+	actionUp
+	actionDown
+	actionVolumeUp
+	actionVolumeDown
+	actionNextProfile
+	actionRecord
+	actionSeekBack
+	actionSeekForward
+	actionLive
+	actionSleep
+	actionSchedule
+)
+
+// keyNames holds the names of the special keys that can be used in keybindings.
+var keyNames = map[termbox.Key]string{
+	termbox.KeySpace:      "space",
+	termbox.KeyEnter:      "enter",
+	termbox.KeyTab:        "tab",
+	termbox.KeyBackspace2: "backspace",
+	termbox.KeyArrowUp:    "up",
+	termbox.KeyArrowDown:  "down",
+	termbox.KeyArrowLeft:  "left",
+	termbox.KeyArrowRight: "right",
+	termbox.KeyPgup:       "pgup",
+	termbox.KeyPgdn:       "pgdn",
+	termbox.KeyHome:       "home",
+	termbox.KeyEnd:        "end",
+}
+
+// keymap maps key names to actions.
+type keymap map[string]action
+
+// newKeymap creates a keymap from the keybindings in the settings.
+func newKeymap(kb tunesettings.Keybindings) keymap {
+	km := make(keymap)
+	for _, binding := range []struct {
+		keys   string
+		action action
+	}{
+		{kb.Quit, actionQuit},
+		{kb.PlayStop, actionPlayStop},
+		{kb.Up, actionUp},
+		{kb.Down, actionDown},
+		{kb.VolumeUp, actionVolumeUp},
+		{kb.VolumeDown, actionVolumeDown},
+		{kb.NextProfile, actionNextProfile},
+		{kb.Record, actionRecord},
+		{kb.SeekBack, actionSeekBack},
+		{kb.SeekForward, actionSeekForward},
+		{kb.Live, actionLive},
+		{kb.Sleep, actionSleep},
+		{kb.Schedule, actionSchedule},
+	} {
+		for _, key := range strings.Fields(binding.keys) {
+			km[key] = binding.action
+		}
+	}
+	return km
+}
+
+// action returns the action for a key event.
+func (km keymap) action(event termbox.Event) action {
+	if event.Ch != 0 {
+		return km[string(event.Ch)]
+	}
+	return km[keyNames[event.Key]]
+}
+
+// keyHelp returns the help message for the keybindings, with the first key for each action.
+func keyHelp(kb tunesettings.Keybindings) string {
+	first := func(keys string) string {
+		fields := strings.Fields(keys)
+		if len(fields) == 0 {
+			return "none"
+		}
+		return fields[0]
+	}
+	return fmt.Sprintf("%s: quit  %s/%s: select channel  %s: play/pause  %s/%s: volume  %s/%s/%s: rewind/forward/live  %s: profile  %s: record  %s: sleep  %s: schedule",
+		first(kb.Quit), first(kb.Up), first(kb.Down), first(kb.PlayStop),
+		first(kb.VolumeUp), first(kb.VolumeDown), first(kb.SeekBack), first(kb.SeekForward), first(kb.Live),
+		first(kb.NextProfile), first(kb.Record), first(kb.Sleep), first(kb.Schedule))
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/GeertJohan/go.linenoise"
@@ -14,11 +16,21 @@ import (
 	"github.com/GeertJohan/tune/api"
 	"github.com/GeertJohan/tune/clock"
 	tuneplayer "github.com/GeertJohan/tune/player"
+	"github.com/GeertJohan/tune/scheduler"
 	tunesettings "github.com/GeertJohan/tune/settings"
 )
 
 func main() {
-	exitStatus, err := panicwrap.BasicWrap(panicToFile)
+	overrides := tunesettings.NewOverrides(flag.CommandLine)
+	profileFlag := flag.String("profile", "", "name of the profile to use, defaults to the last used profile")
+	sleepFlag := flag.String("sleep", "", "stop playback after a duration like 45m, or at the end of the current track with \"track\"")
+	flag.Parse()
+
+	// panics are written to the log folder
+	dirs, _ := overrides.Dirs()
+	exitStatus, err := panicwrap.BasicWrap(func(output string) {
+		panicToFile(dirs.Log, output)
+	})
 	if err != nil {
 		panic(err)
 	}
@@ -26,181 +38,167 @@ func main() {
 		os.Exit(exitStatus)
 	}
 
-	settings, err := tunesettings.Load()
+	settings, err := overrides.Load()
 	if err != nil {
 		fmt.Printf("error loading or creating settings file: %v\n", err)
 		os.Exit(1)
 	}
 
-	// hardcode di.fm network for now
-	network := api.NetworkDI
-
-	// authenticate account
-	var account *api.Account
-	if settings.Account.APIKey != "" {
-		account, err = network.AuthenticateAPIKey(settings.Account.APIKey)
-		if err == api.ErrInvalidCredentials {
-			fmt.Println("Could not authenticate with saved API key.")
-		} else if err != nil {
-			fmt.Printf("error authenticating with API key: %v\n", err)
-			os.Exit(1)
-		}
+	profileName := *profileFlag
+	if profileName == "" {
+		profileName = settings.Settings.LastProfile
 	}
-	if account == nil {
-		fmt.Println("Please enter your AudioAddict username and password.")
-		for {
-			username := mustReadLine("username: ")
-			password := mustReadLine("password: ")
-			account, err = network.AuthenticateUserPass(username, password)
-			if err == api.ErrInvalidCredentials {
-				fmt.Println("Invalid username and/or password, please try again.")
-				continue
-			} else if err != nil {
-				fmt.Printf("error authenticating with username/password: %v\n", err)
-				os.Exit(1)
-			}
-			settings.Account.APIKey = account.APIKey
-			settings.Save()
-			break
-		}
+	if profileName == "" {
+		profileName = tunesettings.DefaultProfileName
 	}
 
-	var sl *api.Streamlist
-	if settings.Settings.StreamlistKey != "" {
-		sl, err = network.StreamlistByKey(settings.Settings.StreamlistKey)
+	var sleep sleepRequest
+	if *sleepFlag != "" {
+		sleep, err = parseSleep(*sleepFlag)
 		if err != nil {
-			fmt.Println("Could not use saved stream quality, selecting best quality.")
-			linenoise.Line("Press enter to continue")
+			fmt.Println(err)
+			os.Exit(1)
 		}
 	}
-	if sl == nil {
-		sl = network.BestStreamlist(account.Premium)
-		settings.Settings.StreamlistKey = sl.Key
-		settings.Save()
+
+	switch flag.Arg(0) {
+	case "logout":
+		// delete from all stores, the store that is selected now might not be the one the credentials were saved to
+		err := settings.DeleteCredentials(profileName)
+		if err != nil {
+			fmt.Printf("error deleting stored credentials: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Logged out of profile %q, stored credentials have been removed.\n", profileName)
+		return
+	case "config":
+		printConfig(settings, overrides, profileName)
+		return
+	case "record":
+		runRecord(settings, overrides, profileName, flag.Args()[1:])
+		return
+	case "schedule":
+		runSchedule(settings, profileName, flag.Args()[1:])
+		return
 	}
 
-	// get all channels
-	channels, err := sl.Channels()
+	sess, err := openSession(settings, overrides, profileName, true)
 	if err != nil {
-		fmt.Printf("error getting channels: %v\n", err)
+		fmt.Println(err)
 		os.Exit(1)
 	}
-	channelsByKey := make(map[string]*api.Channel)
-	channelsByID := make(map[int]*api.Channel)
-	for _, channel := range channels {
-		channelsByKey[channel.Key] = channel
-		channelsByID[channel.ID] = channel
-	}
+	settings.Settings.LastProfile = profileName
+	settings.Save()
 
 	// create a clock
 	var clk *clock.Clock
 	{
-		ping, err := api.Ping()
+		ping, err := api.EstimateOffset(3)
 		if err != nil {
 			fmt.Printf("error pinging audioaddict server: %v\n", err)
 			os.Exit(1)
 		}
-		clk = clock.New(ping.Time)
+		clk = clock.New(ping.Offset, ping.Uncertainty())
 	}
+	clk.SyncEvery(15*time.Minute, func() (time.Duration, time.Duration, error) {
+		ping, err := api.EstimateOffset(3)
+		if err != nil {
+			return 0, 0, err
+		}
+		return ping.Offset, ping.Uncertainty(), nil
+	})
+	defer clk.Close()
+	// refine the clock with every response from the servers
+	api.SetServerTimeObserver(clk.Observe)
 
 	// create display
-	display, err := NewDisplay()
+	display, err := NewDisplay(clk)
 	if err != nil {
 		fmt.Printf("error setting up display: %v\n", err)
 		os.Exit(1)
 	}
 	defer display.Close()
-	display.SetTitle(network.Name)
 
-	// setup tracklist on display
-	go func() {
-		// create a list of channels that we want to display
-		var displayedChannels []*api.Channel
-		// add favorites to the start of the list (if logged in)
-		if account != nil {
-			for _, favoriteID := range account.Favorites {
-				displayedChannels = append(displayedChannels, channelsByID[favoriteID])
-			}
-		}
-		// add the rest of the (non-favorite) channels
-		for _, ch := range channels {
-			if account != nil && account.IsFavoriteChannel(ch.ID) {
-				continue
-			}
-			displayedChannels = append(displayedChannels, ch)
+	// the player and the goroutines updating the display belong to the session, chStop stops them on a profile switch
+	var player *tuneplayer.Player
+	var chStop chan struct{}
+	// sleep timers are handed to the player events goroutine, which knows when the current track ends.
+	// It may be busy polling the track, so the latest request waits in the buffer.
+	chSleep := make(chan sleepRequest, 1)
+	requestSleep := func(req sleepRequest) {
+		select {
+		case <-chSleep: // replaced by req
+		default:
 		}
+		chSleep <- req
+	}
+	startSession := func() {
+		chStop = make(chan struct{})
+		display.SetTitle(fmt.Sprintf("%s (%s)", sess.network.Name, sess.name))
+		go runChannelList(display, clk, sess, chStop)
+		player = newPlayer(settings, dirs, display, clk, sess, chSleep)
 
-		for {
-			// fetch the latest track history from the servers
-			trackHistory, err := network.TrackHistory()
-			if err != nil {
-				fmt.Printf("error getting track history: %v\n", err)
-				os.Exit(1)
+		// start channel that was previously being played
+		if sess.profile.LastPlayedChannel != "" {
+			channel := sess.channelsByKey[sess.profile.LastPlayedChannel]
+			if channel != nil {
+				player.SetChannel(channel)
+				display.SetChannel(channel.Name, channel.Key)
 			}
-			// create a new list with displaydata for the channels
-			channelList := make([]*channelInfo, 0, len(displayedChannels))
-
-			// iterate over all channels we want to display and augment them with the latest track history
-			for _, ch := range displayedChannels {
-				ci := &channelInfo{
-					channelKey:  ch.Key,
-					channelName: ch.Name,
-				}
+		}
+	}
+	stopSession := func() {
+		close(chStop)
+		player.Close()
+		display.SetPlaying(false)
+		display.SetTrackTitle("N/A")
+	}
+	startSession()
+	defer func() { stopSession() }()
+	if sleep != (sleepRequest{}) {
+		requestSleep(sleep)
+	}
 
-				trackInfo := trackHistory[strconv.Itoa(ch.ID)]
-				if trackInfo != nil {
-					ci.trackTitle = trackInfo.Name
-				}
-				channelList = append(channelList, ci)
+	// the schedule of the profile changes the channel and the volume, it follows profile switches
+	sched := scheduler.New(clk, nil)
+	defer sched.Close()
+	setSchedule := func() {
+		entries, errs := scheduleEntries(sess.profile)
+		for _, err := range errs {
+			display.Notify(err.Error())
+		}
+		sched.SetEntries(entries)
+	}
+	setSchedule()
+	runScheduled := func(action scheduler.Action) {
+		if action.Channel != "" {
+			ch := sess.channelsByKey[action.Channel]
+			switch {
+			case ch == nil:
+				display.Notify(fmt.Sprintf("schedule %s: unknown channel %q", action.Entry, action.Channel))
+			case player.Channel() != ch || player.State() != tuneplayer.StatePlaying:
+				player.SetChannel(ch)
+				display.SetChannel(ch.Name, ch.Key)
+				sess.profile.LastPlayedChannel = ch.Key
 			}
-			display.SetChannelList(channelList)
-			time.Sleep(1 * time.Minute)
 		}
-	}()
-
-	// create player
-	player := tuneplayer.NewPlayer(account)
-	player.SetVolume(settings.Player.Volume)
-	defer player.Close()
-
-	var updateTrack func()
-	updateTrack = func() {
-		track, err := player.Channel().CurrentTrack()
+		if action.Volume > 0 {
+			sess.volume = action.Volume
+			player.SetVolume(sess.volume)
+		}
+		if action.Run.IsZero() {
+			return // a step of a volume ramp
+		}
+		// the last run is saved, so a run that is missed during a restart is made up for
+		if se := sess.profile.Schedule[action.Entry]; se != nil {
+			display.Notify(fmt.Sprintf("schedule %s: %s", action.Entry, describeScheduleEntry(se)))
+			se.LastRun = action.Run
+		}
+		err := settings.Save()
 		if err != nil {
-			display.Notify(fmt.Sprintf("error getting title: %v", err))
-		} else {
-			display.SetTrackTitle(track.Name)
+			display.Notify(fmt.Sprintf("error saving last run of schedule %s: %v", action.Entry, err))
 		}
-		duration := time.Duration(track.Duration) * time.Second
-		started := time.Unix(int64(track.Started), 0)
-		now := clk.Now()
-		passed := now.Sub(started)
-		display.SetTrackDuration(duration, passed)
-		go func() {
-			left := duration - passed
-			if left < 2*time.Second {
-				// avoid infinite loop when information provided by api is incorrect
-				left = 2 * time.Second
-			}
-			<-time.After(left)
-			updateTrack()
-		}()
 	}
-	player.SetPlayerStoppedHandler(func() {
-		display.Notify("playback stopped")
-		display.SetPlaying(false)
-		display.SetTrackTitle("N/A")
-	})
-	player.SetPlayerPlayingHandler(func() {
-		display.Notify("playback started")
-		display.SetPlaying(true)
-
-		updateTrack()
-	})
-	player.SetPlayerTitleChangedHandler(updateTrack)
-	player.SetErrorHandler(func(err error) {
-		display.Notify(fmt.Sprintf("error: %v", err))
-	})
 
 	// convert blocking call termbox.PollEvent() to channel send
 	eventChan := make(chan termbox.Event)
@@ -216,27 +214,133 @@ func main() {
 	signal.Notify(sigChan, os.Interrupt)
 	signal.Notify(sigChan, os.Kill)
 
-	// start channel that was previously being played
-	if settings.Player.LastPlayedChannel != "" {
-		channel := channelsByKey[settings.Player.LastPlayedChannel]
-		if channel != nil {
-			player.SetChannel(channel)
-			display.SetChannel(channel.Name, channel.Key)
+	changeVolume := func(change int) {
+		sched.StopRamp()
+		sess.volume += change
+		if sess.volume < 0 {
+			sess.volume = 0
 		}
+		if sess.volume > 100 {
+			sess.volume = 100
+		}
+		// first set volume (fast audio feedback to user), afterwards save conf to disk
+		player.SetVolume(sess.volume)
+		display.Notify(fmt.Sprintf("volume set to %02d%%", sess.volume))
+		sess.profile.Volume = sess.volume
+		settings.Save()
 	}
 
-	changeVolume := func(change int) {
-		settings.Player.Volume += change
-		if settings.Player.Volume < 0 {
-			settings.Player.Volume = 0
+	// openProfile connects a new session for the named profile in the background, the event loop swaps it in with
+	// swapSession. Opening another profile supersedes it.
+	chOpened := make(chan openedSession)
+	opening := 0
+	openProfile := func(name string) {
+		next, err := loadSession(settings, overrides, name, false)
+		if err != nil {
+			display.Notify(fmt.Sprintf("error opening profile %s: %v", name, err))
+			return
 		}
-		if settings.Player.Volume > 100 {
-			settings.Player.Volume = 100
+		opening++
+		attempt := opening
+		go func() {
+			err := next.connect(false)
+			chOpened <- openedSession{attempt: attempt, sess: next, err: err}
+		}()
+	}
+	swapSession := func(opened openedSession) {
+		if opened.attempt != opening {
+			return // another profile was opened since
 		}
-		// first set volume (fast audio feedback to user), afterwards save conf to disk
-		player.SetVolume(settings.Player.Volume)
-		display.Notify(fmt.Sprintf("volume set to %02d%%", settings.Player.Volume))
+		if opened.err != nil {
+			display.Notify(fmt.Sprintf("error opening profile %s: %v", opened.sess.name, opened.err))
+			return
+		}
+		stopSession()
+		sess = opened.sess
+		sess.setDefaults()
+		settings.Settings.LastProfile = sess.name
 		settings.Save()
+		startSession()
+		setSchedule()
+	}
+
+	switchProfile := func() {
+		name := settings.NextProfileName(sess.name)
+		if name == sess.name {
+			display.Notify("no other profiles, start tune-cli with --profile to create one")
+			return
+		}
+		display.Notify(fmt.Sprintf("switching to profile %s", name))
+		openProfile(name)
+	}
+
+	seek := func(offset time.Duration) {
+		behind, err := player.Seek(offset)
+		if err != nil {
+			display.Notify(fmt.Sprintf("error: %v", err))
+			return
+		}
+		if behind == 0 {
+			display.Notify("playing live")
+			return
+		}
+		display.Notify(fmt.Sprintf("playing %s behind live", formatBehind(behind)))
+	}
+
+	// the recording started with the record key, it keeps running when the profile is switched
+	var rec recording
+	defer rec.stop()
+
+	keys := newKeymap(settings.Keybindings)
+	display.SetHelp(keyHelp(settings.Keybindings))
+
+	// apply changes to the settings file by an editor or another tune instance
+	var chSettingsChanged <-chan struct{}
+	var chSettingsError <-chan error
+	watcher, err := settings.Watch()
+	if err != nil {
+		display.Notify(fmt.Sprintf("not watching settings file: %v", err))
+	} else {
+		defer watcher.Close()
+		chSettingsChanged = watcher.Events()
+		chSettingsError = watcher.Errors()
+	}
+	reloadSettings := func() {
+		changed, err := settings.Reload()
+		if err != nil {
+			display.Notify(fmt.Sprintf("error reloading settings: %v", err))
+			return
+		}
+		profilePrefix := "Profiles." + sess.name + "."
+		reopen := false
+		reschedule := false
+		for _, key := range changed {
+			switch {
+			case strings.HasPrefix(key, "Player.Timeshift"):
+				player.SetTimeshift(timeshiftConfig(settings, dirs))
+			case strings.HasPrefix(key, "Player.Fade"), key == "Player.CrossfadeMs":
+				player.SetFades(fades(settings))
+			case strings.HasPrefix(key, "Keybindings."):
+				keys = newKeymap(settings.Keybindings)
+				display.SetHelp(keyHelp(settings.Keybindings))
+			case key == profilePrefix+"Volume" && !sess.config.Overridden(tunesettings.KeyVolume):
+				sess.volume = sess.profile.Volume
+				player.SetVolume(sess.volume)
+				display.Notify(fmt.Sprintf("volume set to %02d%% by settings file", sess.volume))
+			case key == profilePrefix+"StreamlistKey" && !sess.config.Overridden(tunesettings.KeyStreamlist),
+				key == profilePrefix+"NetworkKey" && !sess.config.Overridden(tunesettings.KeyNetwork):
+				reopen = true
+			case strings.HasPrefix(key, profilePrefix+"Schedule"):
+				reschedule = true
+			}
+		}
+		if reschedule && !reopen {
+			setSchedule()
+		}
+		if reopen {
+			display.Notify("stream settings changed, reopening profile")
+			openProfile(sess.name)
+		}
 	}
 
 eventloop:
@@ -249,30 +353,50 @@ eventloop:
 				switch event.Key {
 				case termbox.KeyCtrlZ, termbox.KeyCtrlC, termbox.KeyEsc:
 					break eventloop
-				case termbox.KeySpace:
+				}
+
+				switch keys.action(event) {
+				case actionQuit:
+					break eventloop
+				case actionPlayStop:
 					channelKey := display.GetChannelSelection()
 					if player.Channel() != nil && player.Channel().Key == channelKey {
 						player.PlayStop()
 					} else {
-						ch := channelsByKey[channelKey]
+						ch := sess.channelsByKey[channelKey]
 						player.SetChannel(ch)
 						display.SetChannel(ch.Name, ch.Key)
-						settings.Player.LastPlayedChannel = ch.Key
+						sess.profile.LastPlayedChannel = ch.Key
 						settings.Save()
 					}
-				case termbox.KeyArrowUp:
+				case actionUp:
 					display.MoveChannelListSelection(-1)
-				case termbox.KeyArrowDown:
+				case actionDown:
 					display.MoveChannelListSelection(1)
-				}
-
-				switch event.Ch {
-				case 'q':
-					break eventloop
-				case '-', '_':
+				case actionNextProfile:
+					switchProfile()
+				case actionVolumeDown:
 					changeVolume(-5)
-				case '+', '=':
+				case actionVolumeUp:
 					changeVolume(5)
+				case actionSeekBack:
+					seek(-seekStep)
+				case actionSeekForward:
+					seek(seekStep)
+				case actionLive:
+					err := player.JumpToLive()
+					if err != nil {
+						display.Notify(fmt.Sprintf("error: %v", err))
+						break
+					}
+					display.Notify("playing live")
+				case actionRecord:
+					rec.toggle(settings, display, sess, player, display.GetChannelSelection())
+				case actionSleep:
+					sleep = nextSleep(sleep)
+					requestSleep(sleep)
+				case actionSchedule:
+					display.Notify(nextScheduled(sess.profile, clk.Now()))
 				}
 
 			case termbox.EventResize:
@@ -282,12 +406,217 @@ eventloop:
 				// fmt.Printf("quitting because of termbox error: %v", event.Err)
 				break eventloop
 			}
+		case opened := <-chOpened:
+			swapSession(opened)
+		case <-rec.done():
+			rec.ended(display)
+		case action := <-sched.Actions():
+			runScheduled(action)
+		case <-chSettingsChanged:
+			reloadSettings()
+		case err := <-chSettingsError:
+			display.Notify(fmt.Sprintf("error watching settings file: %v", err))
 		case _ = <-sigChan:
 			break eventloop
 		}
 	}
 }
 
+// runChannelList keeps the channel list on the display up to date with the latest track history, until chStop is closed.
+func runChannelList(display *Display, clk clock.Interface, sess *session, chStop chan struct{}) {
+	// create a list of channels that we want to display
+	displayedChannels := sess.displayedChannels()
+
+	for {
+		// fetch the latest track history from the servers
+		trackHistory, err := sess.network.TrackHistory()
+		if err != nil {
+			display.Notify(fmt.Sprintf("error getting track history: %v", err))
+		} else {
+			// create a new list with displaydata for the channels
+			channelList := make([]*channelInfo, 0, len(displayedChannels))
+
+			// iterate over all channels we want to display and augment them with the latest track history
+			for _, ch := range displayedChannels {
+				ci := &channelInfo{
+					channelKey:  ch.Key,
+					channelName: ch.Name,
+				}
+
+				trackInfo := trackHistory[strconv.Itoa(ch.ID)]
+				if trackInfo != nil {
+					ci.trackTitle = trackInfo.Name
+				}
+				channelList = append(channelList, ci)
+			}
+			display.SetChannelList(channelList)
+		}
+		select {
+		case <-clk.After(1 * time.Minute):
+		case <-chStop:
+			return
+		}
+	}
+}
+
+// newPlayer creates a player for the session's account with the audio backend from the settings.
+// It updates the display from the player events until the player is closed, and sets the sleep timers from chSleep.
+func newPlayer(settings *tunesettings.Settings, dirs tunesettings.Dirs, display *Display, clk clock.Interface, sess *session, chSleep <-chan sleepRequest) *tuneplayer.Player {
+	var player *tuneplayer.Player
+	backend, err := newBackend(settings)
+	switch {
+	case err != nil:
+		display.Notify(fmt.Sprintf("error starting %s audio backend: %v", settings.Player.Backend, err))
+		player = tuneplayer.NewPlayerWithBackend(sess.account, nil)
+	case backend == nil:
+		player = tuneplayer.NewPlayer(sess.account)
+	default:
+		player = tuneplayer.NewPlayerWithBackend(sess.account, backend)
+	}
+	player.SetVolume(sess.volume)
+	player.SetTimeshift(timeshiftConfig(settings, dirs))
+	player.SetFades(fades(settings))
+	player.SetClock(clk)
+
+	events := player.Subscribe()
+	go func() {
+		// the track history is polled for the current track, until the stream reports its titles
+		var channel *api.Channel
+		var chPoll <-chan time.Time
+		streamTitles := false
+		// the end of the track is relative to the live stream, playback is behind it with timeshift
+		var track *api.Track
+		var behind time.Duration
+		sleepAtTrackEnd := false
+		setSleep := func(req sleepRequest) {
+			sleepAtTrackEnd = false
+			switch {
+			case req.trackEnd && track == nil:
+				sleepAtTrackEnd = true // when the track is known
+			case req.trackEnd:
+				duration, passed := trackProgress(clk, track)
+				left := duration - passed + behind
+				if left < 0 {
+					left = 0 // the track information is late, the track has ended
+				}
+				fadeOver := trackEndFade
+				if fadeOver > left {
+					fadeOver = left
+				}
+				player.SetSleepTimer(clk.Now().Add(left), fadeOver)
+			case req.after > 0:
+				fadeOver := sleepFade(settings)
+				if fadeOver > req.after {
+					fadeOver = req.after
+				}
+				player.SetSleepTimer(clk.Now().Add(req.after), fadeOver)
+			default:
+				player.SetSleepTimer(time.Time{}, 0)
+			}
+		}
+		showTrack := func(t *api.Track) {
+			track = t
+			display.SetTrackTitle(track.Name)
+			duration, passed := trackProgress(clk, track)
+			display.SetTrackDuration(duration, passed)
+			if !streamTitles {
+				chPoll = clk.After(nextTrackUpdate(duration, passed))
+			}
+			if sleepAtTrackEnd {
+				setSleep(sleepRequest{trackEnd: true})
+			}
+		}
+		pollTrack := func() {
+			chPoll = nil
+			t, err := channel.CurrentTrack()
+			if err != nil {
+				display.Notify(fmt.Sprintf("error getting title: %v", err))
+				return
+			}
+			showTrack(t)
+		}
+
+		for {
+			select {
+			case ev, ok := <-events.Events():
+				if !ok {
+					return // the subscription ends when the player is closed
+				}
+				channel = ev.Channel
+				behind = ev.Behind
+				switch ev.Type {
+				case tuneplayer.EventStateChanged:
+					switch ev.State {
+					case tuneplayer.StateConnecting:
+						display.Notify("connecting")
+						track = nil
+					case tuneplayer.StateReconnecting:
+						display.Notify("reconnecting")
+					case tuneplayer.StatePlaying:
+						display.Notify("playback started")
+						display.SetPlaying(true)
+						streamTitles = false
+						pollTrack()
+					case tuneplayer.StatePaused:
+						display.Notify("playback paused")
+						display.SetPlaying(false)
+						chPoll = nil
+					case tuneplayer.StateStopped, tuneplayer.StateError:
+						display.Notify("playback " + ev.State.String())
+						display.SetPlaying(false)
+						display.SetTrackTitle("N/A")
+						chPoll = nil
+						track = nil
+					}
+				case tuneplayer.EventTitleChanged:
+					if ev.Title == "" {
+						pollTrack()
+						break
+					}
+					streamTitles = true
+					chPoll = nil
+					track = nil
+					display.SetTrackTitle(ev.Title)
+				case tuneplayer.EventTrackChanged:
+					showTrack(ev.Track)
+				case tuneplayer.EventSleepChanged:
+					display.SetSleep(ev.SleepAt)
+				case tuneplayer.EventError:
+					display.Notify(fmt.Sprintf("error: %v", ev.Err))
+				}
+			case <-chPoll:
+				pollTrack()
+			case req := <-chSleep:
+				display.Notify(req.String())
+				setSleep(req)
+			}
+		}
+	}()
+	return player
+}
+
+// printConfig prints the effective configuration for a profile, and where each value came from.
+func printConfig(settings *tunesettings.Settings, overrides *tunesettings.Overrides, profileName string) {
+	credStore, err := settings.OpenCredentialStore(profileName, func() (string, error) {
+		return mustReadLine("credentials passphrase: "), nil
+	})
+	if err != nil {
+		fmt.Printf("error opening credential store: %v\n", err)
+		os.Exit(1)
+	}
+	creds, err := credStore.Load()
+	if err != nil && err != tunesettings.ErrNoCredentials {
+		fmt.Printf("error loading stored credentials: %v\n", err)
+		os.Exit(1)
+	}
+	cfg, err := overrides.Resolve(settings, profileName, creds)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Effective configuration for profile %q:\n%s", profileName, cfg)
+}
+
 func mustReadLine(prompt string) string {
 	for {
 		line, err := linenoise.Line(prompt)
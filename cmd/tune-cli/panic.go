@@ -3,16 +3,18 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 )
 
 // TODO: this whole panic to file was usefull for development, but should be removed and just print to stdout.
-func panicToFile(output string) {
-	panicFile, err := os.Create(fmt.Sprintf("tune-panic-%d", time.Now().Unix()))
+func panicToFile(logDir, output string) {
+	os.MkdirAll(logDir, 0700)
+	panicFile, err := os.Create(filepath.Join(logDir, fmt.Sprintf("tune-panic-%d", time.Now().Unix())))
 	if err != nil {
 		panic(output + `\n` + err.Error()) // seriously!? :p
 	}
 	defer panicFile.Close()
 	panicFile.WriteString(output)
-	fmt.Println("PANIC TO FILE!")
+	fmt.Printf("PANIC TO FILE! %s\n", panicFile.Name())
 }
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/GeertJohan/go.linenoise"
+
+	"github.com/GeertJohan/tune/api"
+	tunesettings "github.com/GeertJohan/tune/settings"
+)
+
+// errNotInteractive is returned when a profile can't be opened without asking the user for input.
+var errNotInteractive = errors.New("profile needs input, start tune-cli with --profile to log in")
+
+// logins keeps the Login for each api key, so the sessions of profiles that share an account re-use it and its
+// accounts on the other networks.
+var (
+	loginsLock sync.Mutex
+	logins     = make(map[string]*api.Login)
+)
+
+// loginAPIKey returns the Login for an api key, it authenticates on network n when there is none yet.
+func loginAPIKey(n *api.Network, apiKey string) (*api.Login, error) {
+	loginsLock.Lock()
+	defer loginsLock.Unlock()
+	if login, ok := logins[apiKey]; ok {
+		return login, nil
+	}
+	login, err := api.LoginAPIKey(n, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	logins[apiKey] = login
+	return login, nil
+}
+
+// rememberLogin keeps a Login that was made with username and password for other sessions.
+func rememberLogin(login *api.Login) {
+	loginsLock.Lock()
+	defer loginsLock.Unlock()
+	logins[login.APIKey()] = login
+}
+
+// session is an opened profile: the authenticated account and the channels on the profile's network.
+type session struct {
+	name    string
+	profile *tunesettings.Profile
+	config  *tunesettings.Config
+	network *api.Network
+	account *api.Account
+	volume  int
+
+	channels      []*api.Channel
+	channelsByKey map[string]*api.Channel
+	channelsByID  map[int]*api.Channel
+
+	// the stored credentials, which connect authenticates with
+	credStore tunesettings.CredentialStore
+	creds     *tunesettings.Credentials
+
+	// the network and streamlist that connect chose because the profile had none that works,
+	// they are set on the profile by setDefaults
+	defaultNetworkKey    string
+	defaultStreamlistKey string
+}
+
+// openedSession is the result of connecting a session in the background.
+type openedSession struct {
+	attempt int // tells a superseded attempt from the latest one
+	sess    *session
+	err     error
+}
+
+// openSession authenticates the account for a profile and fetches its channels.
+// Values from the overrides are used for the session, but not saved to the profile.
+// When interactive is true the user is asked for a passphrase or credentials when needed,
+// otherwise errNotInteractive is returned.
+func openSession(settings *tunesettings.Settings, overrides *tunesettings.Overrides, name string, interactive bool) (*session, error) {
+	s, err := loadSession(settings, overrides, name, interactive)
+	if err != nil {
+		return nil, err
+	}
+	err = s.connect(interactive)
+	if err != nil {
+		return nil, err
+	}
+	if s.setDefaults() {
+		settings.Save()
+	}
+	return s, nil
+}
+
+// loadSession reads the configuration and credentials for a profile from the settings.
+// The session isn't usable until it is connected, connect doesn't use the settings so it can run alongside
+// other users of the settings.
+func loadSession(settings *tunesettings.Settings, overrides *tunesettings.Overrides, name string, interactive bool) (*session, error) {
+	s := &session{
+		name: name,
+	}
+
+	credStore, err := settings.OpenCredentialStore(name, func() (string, error) {
+		if !interactive {
+			return "", errNotInteractive
+		}
+		return mustReadLine("credentials passphrase: "), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error opening credential store: %v", err)
+	}
+	creds, err := credStore.Load()
+	if err == tunesettings.ErrNoCredentials {
+		creds, err = &tunesettings.Credentials{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading stored credentials: %v", err)
+	}
+	cfg, err := overrides.Resolve(settings, name, creds)
+	if err != nil {
+		return nil, err
+	}
+	s.config = cfg
+	s.profile = settings.Profile(name)
+	s.volume = cfg.Volume
+	creds.APIKey = cfg.APIKey
+	s.credStore = credStore
+	s.creds = creds
+	return s, nil
+}
+
+// connect authenticates the account and fetches the channels of a loaded session.
+func (s *session) connect(interactive bool) error {
+	cfg, creds := s.config, s.creds
+	var err error
+
+	s.network = api.NetworkByKey(cfg.NetworkKey)
+	if s.network == nil {
+		if cfg.NetworkKey != "" && interactive {
+			fmt.Printf("Unknown network %q from %s, using %s.\n", cfg.NetworkKey, cfg.Source(tunesettings.KeyNetwork), api.NetworkDI.Name)
+		}
+		s.network = api.NetworkDI
+		if !cfg.Overridden(tunesettings.KeyNetwork) {
+			s.defaultNetworkKey = s.network.Key
+		}
+	}
+	network := s.network
+
+	// authenticate account, a login is valid on all networks
+	var login *api.Login
+	var account *api.Account
+	// checkListenKey is set when the account didn't come from an API key login, its listen key is validated below
+	var checkListenKey bool
+	if creds.APIKey != "" {
+		login, err = loginAPIKey(network, creds.APIKey)
+		if err == nil {
+			account, err = login.Account(network)
+		}
+		if err == api.ErrCantAuthenticate && creds.WebSessionCookie != "" {
+			// members/authenticate is not available, fall back to the saved web-session
+			var session *api.WebSession
+			session, err = network.RestoreWebSession(creds.WebSessionCookie)
+			if err == nil {
+				account, err = webSessionAccount(session)
+				checkListenKey = true
+			}
+		}
+		if err == api.ErrInvalidCredentials {
+			if interactive {
+				fmt.Printf("Could not authenticate with API key from %s.\n", cfg.Source(tunesettings.KeyAPIKey))
+			}
+		} else if err != nil {
+			return fmt.Errorf("error authenticating with API key: %v", err)
+		}
+	}
+	if account == nil && creds.APIKey == "" && creds.ListenKey != "" {
+		account, err = network.AuthenticateListenKey(creds.ListenKey)
+		if err != nil {
+			return fmt.Errorf("error authenticating with listen key: %v", err)
+		}
+	}
+	if account == nil {
+		if !interactive {
+			return errNotInteractive
+		}
+		fmt.Printf("Please enter your AudioAddict username and password for profile %q.\n", s.name)
+		for {
+			username := mustReadLine("username: ")
+			password := mustReadLine("password: ")
+			login, err = api.LoginUserPass(network, username, password)
+			if err == nil {
+				rememberLogin(login)
+				account, err = login.Account(network)
+			}
+			if err == api.ErrCantAuthenticate {
+				// members/authenticate is not available, fall back to logging in on the website
+				var session *api.WebSession
+				session, err = network.LoginWebSession(username, password)
+				if err == nil {
+					account, err = webSessionAccount(session)
+					creds.WebSessionCookie = session.Cookie()
+				}
+			}
+			if err == api.ErrInvalidCredentials {
+				fmt.Println("Invalid username and/or password, please try again.")
+				continue
+			} else if err != nil {
+				return fmt.Errorf("error authenticating with username/password: %v", err)
+			}
+			creds.APIKey = account.APIKey
+			checkListenKey = true
+			err = s.credStore.Save(creds)
+			if err != nil {
+				fmt.Printf("error saving credentials: %v\n", err)
+			}
+			break
+		}
+	}
+	s.account = account
+
+	// make sure the listen key works, otherwise playback would just silently stop
+	if checkListenKey {
+		_, err = network.ValidateListenKey(account.ListenKey)
+		if err != nil {
+			return fmt.Errorf("error validating listen key: %v", err)
+		}
+	}
+
+	var sl *api.Streamlist
+	if cfg.StreamlistKey != "" {
+		sl, err = network.StreamlistByKey(cfg.StreamlistKey)
+		if err != nil && interactive {
+			fmt.Printf("Could not use stream quality from %s, selecting best quality.\n", cfg.Source(tunesettings.KeyStreamlist))
+			linenoise.Line("Press enter to continue")
+		}
+	}
+	if sl == nil {
+		sl = network.BestStreamlist(account.Premium)
+		if !cfg.Overridden(tunesettings.KeyStreamlist) {
+			s.defaultStreamlistKey = sl.Key
+		}
+	}
+
+	// get all channels
+	s.channels, err = sl.Channels()
+	if err != nil {
+		return fmt.Errorf("error getting channels: %v", err)
+	}
+	s.channelsByKey = make(map[string]*api.Channel)
+	s.channelsByID = make(map[int]*api.Channel)
+	for _, channel := range s.channels {
+		s.channelsByKey[channel.Key] = channel
+		s.channelsByID[channel.ID] = channel
+	}
+
+	// accounts without api key don't have their favorites yet
+	if account.APIKey == "" {
+		favorites, err := network.FavoritesByListenKey(account.ListenKey, s.channels)
+		if err != nil {
+			return fmt.Errorf("error getting favorites: %v", err)
+		}
+		for _, ch := range favorites {
+			account.Favorites = append(account.Favorites, ch.ID)
+		}
+	}
+
+	return nil
+}
+
+// setDefaults sets the network and streamlist that connect chose on the profile, it returns true when the profile
+// changed and should be saved.
+func (s *session) setDefaults() bool {
+	if s.defaultNetworkKey != "" {
+		s.profile.NetworkKey = s.defaultNetworkKey
+	}
+	if s.defaultStreamlistKey != "" {
+		s.profile.StreamlistKey = s.defaultStreamlistKey
+	}
+	return s.defaultNetworkKey != "" || s.defaultStreamlistKey != ""
+}
+
+// displayedChannels returns the channels in the order they are displayed: favorites first, then the rest.
+func (s *session) displayedChannels() []*api.Channel {
+	var displayed []*api.Channel
+	for _, favoriteID := range s.account.Favorites {
+		if ch := s.channelsByID[favoriteID]; ch != nil {
+			displayed = append(displayed, ch)
+		}
+	}
+	for _, ch := range s.channels {
+		if s.account.IsFavoriteChannel(ch.ID) {
+			continue
+		}
+		displayed = append(displayed, ch)
+	}
+	return displayed
+}
+
+// webSessionAccount obtains the account from the webplayer config of a web-session.
+func webSessionAccount(session *api.WebSession) (*api.Account, error) {
+	wc, err := session.WebplayerConfig()
+	if err != nil {
+		return nil, err
+	}
+	return wc.Account(), nil
+}
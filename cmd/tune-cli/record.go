@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	tuneplayer "github.com/GeertJohan/tune/player"
+	"github.com/GeertJohan/tune/recorder"
+	tunesettings "github.com/GeertJohan/tune/settings"
+)
+
+// recordOptions returns the recorder options from the settings.
+func recordOptions(settings *tunesettings.Settings) recorder.Options {
+	return recorder.Options{
+		Dir:         settings.RecordDir(),
+		MaxDuration: time.Duration(settings.Record.MaxMinutes) * time.Minute,
+		MaxSize:     int64(settings.Record.MaxMegabytes) << 20,
+	}
+}
+
+// runRecord records a channel until it is interrupted or a limit is reached.
+// Usage: tune-cli record [-dir folder] [-duration 1h30m] [-max-mb 500] [channel-key]
+// The channel defaults to the channel that was played last.
+func runRecord(settings *tunesettings.Settings, overrides *tunesettings.Overrides, profileName string, args []string) {
+	opts := recordOptions(settings)
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	fs.StringVar(&opts.Dir, "dir", opts.Dir, "folder to write the recordings to")
+	fs.DurationVar(&opts.MaxDuration, "duration", opts.MaxDuration, "stop recording after this long, 0 for no limit")
+	maxMegabytes := fs.Int64("max-mb", opts.MaxSize>>20, "stop recording after this many megabytes, 0 for no limit")
+	fs.Parse(args)
+	opts.MaxSize = *maxMegabytes << 20
+
+	sess, err := openSession(settings, overrides, profileName, true)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	channelKey := fs.Arg(0)
+	if channelKey == "" {
+		channelKey = sess.profile.LastPlayedChannel
+	}
+	channel := sess.channelsByKey[channelKey]
+	if channel == nil {
+		fmt.Printf("unknown channel %q, give the key of a channel on %s\n", channelKey, sess.network.Name)
+		os.Exit(1)
+	}
+
+	opts.OnFile = func(path string) {
+		fmt.Printf("recorded %s\n", filepath.Base(path))
+	}
+	rec, err := recorder.Start(sess.account, channel, opts)
+	if err != nil {
+		fmt.Printf("error starting recording: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Recording %s to %s, press Ctrl+C to stop.\n", channel.Name, opts.Dir)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+	select {
+	case <-sigChan:
+		fmt.Println("stopping recording")
+		err = rec.Stop()
+	case <-rec.Done():
+		err = rec.Err()
+	}
+	if err != nil {
+		fmt.Printf("recording stopped: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Recording stopped, %d files written.\n", len(rec.Files()))
+}
+
+// recording is the recording of the record key, it is kept until it has ended so it can be stopped on quit.
+type recording struct {
+	rec      *recorder.Recorder
+	stopping bool
+}
+
+// toggle stops the recording when there is one, or starts recording the channel with given key.
+// The recording starts and stops in the background, progress is shown in notifications.
+func (r *recording) toggle(settings *tunesettings.Settings, display *Display, sess *session, player *tuneplayer.Player, channelKey string) {
+	if r.rec != nil {
+		if r.stopping {
+			display.Notify("still stopping the recording")
+			return
+		}
+		display.Notify("stopping recording")
+		r.stopping = true
+		go r.rec.Stop()
+		return
+	}
+
+	channel := sess.channelsByKey[channelKey]
+	if channel == nil {
+		display.Notify("select a channel to record")
+		return
+	}
+	opts := recordOptions(settings)
+	opts.Player = player
+	opts.OnFile = func(path string) {
+		display.Notify(fmt.Sprintf("recorded %s", filepath.Base(path)))
+	}
+	rec, err := recorder.Start(sess.account, channel, opts)
+	if err != nil {
+		display.Notify(fmt.Sprintf("error starting recording: %v", err))
+		return
+	}
+	r.rec = rec
+	display.Notify(fmt.Sprintf("recording %s to %s", channel.Name, opts.Dir))
+}
+
+// done returns a channel that is closed when the recording has ended, it is nil without recording.
+func (r *recording) done() <-chan struct{} {
+	if r.rec == nil {
+		return nil
+	}
+	return r.rec.Done()
+}
+
+// ended reports a recording that has ended, by the record key, a limit or an error.
+func (r *recording) ended(display *Display) {
+	rec := r.rec
+	r.rec, r.stopping = nil, false
+	if err := rec.Err(); err != nil {
+		display.Notify(fmt.Sprintf("recording stopped: %v", err))
+		return
+	}
+	display.Notify(fmt.Sprintf("recording of %s stopped, %d files written", rec.Channel().Name, len(rec.Files())))
+}
+
+// stop stops the recording and waits until its last file is complete.
+func (r *recording) stop() {
+	if r.rec != nil {
+		r.rec.Stop()
+	}
+}
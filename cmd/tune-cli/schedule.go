@@ -0,0 +1,180 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GeertJohan/tune/scheduler"
+	tunesettings "github.com/GeertJohan/tune/settings"
+)
+
+// scheduleTimeFormat is how the next run of a schedule entry is shown.
+const scheduleTimeFormat = "Mon Jan 2 15:04"
+
+// scheduleEntries returns the enabled schedule entries of the profile, sorted by name.
+// Entries with an invalid time are left out, their errors are returned.
+func scheduleEntries(profile *tunesettings.Profile) ([]*scheduler.Entry, []error) {
+	var entries []*scheduler.Entry
+	var errs []error
+	for _, name := range scheduleNames(profile) {
+		se := profile.Schedule[name]
+		if se.Disabled {
+			continue
+		}
+		spec, err := scheduler.ParseSpec(se.When)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("schedule entry %s: %v", name, err))
+			continue
+		}
+		entries = append(entries, &scheduler.Entry{
+			Name:    name,
+			Spec:    spec,
+			Channel: se.Channel,
+			Volume:  se.Volume,
+			Ramp:    time.Duration(se.RampMinutes) * time.Minute,
+			LastRun: se.LastRun,
+		})
+	}
+	return entries, errs
+}
+
+// scheduleNames returns the names of the schedule entries of the profile, sorted.
+func scheduleNames(profile *tunesettings.Profile) []string {
+	var names []string
+	for name := range profile.Schedule {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// describeScheduleEntry describes what the entry does, e.g. "play chillout, volume 60 over 10 minutes".
+func describeScheduleEntry(se *tunesettings.ScheduleEntry) string {
+	var parts []string
+	if se.Channel != "" {
+		parts = append(parts, "play "+se.Channel)
+	}
+	switch {
+	case se.Volume > 0 && se.RampMinutes > 0:
+		parts = append(parts, fmt.Sprintf("volume %d%% over %d minutes", se.Volume, se.RampMinutes))
+	case se.Volume > 0:
+		parts = append(parts, fmt.Sprintf("volume %d%%", se.Volume))
+	}
+	if len(parts) == 0 {
+		return "nothing"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// nextScheduled describes the entry that runs first after now, for the schedule key.
+func nextScheduled(profile *tunesettings.Profile, now time.Time) string {
+	entries, _ := scheduleEntries(profile)
+	var first *scheduler.Entry
+	var firstAt time.Time
+	for _, e := range entries {
+		at := e.Next(now)
+		if !at.IsZero() && (first == nil || at.Before(firstAt)) {
+			first, firstAt = e, at
+		}
+	}
+	if first == nil {
+		return "nothing scheduled, see tune-cli schedule"
+	}
+	return fmt.Sprintf("next %s at %s: %s", first.Name, firstAt.Format(scheduleTimeFormat), describeScheduleEntry(profile.Schedule[first.Name]))
+}
+
+// runSchedule shows and edits the schedule of a profile, a running tune-cli picks up the changes.
+// Usage: tune-cli schedule [add [-channel key] [-volume 60] [-ramp 10] name "30 7 * * mon-fri" | remove name |
+// enable name | disable name]
+// Without arguments the entries are listed with their next run.
+func runSchedule(settings *tunesettings.Settings, profileName string, args []string) {
+	profile := settings.Profile(profileName)
+	if len(args) == 0 {
+		names := scheduleNames(profile)
+		if len(names) == 0 {
+			fmt.Printf("The schedule of profile %q is empty, add entries with: tune-cli schedule add\n", profileName)
+			return
+		}
+		fmt.Printf("Schedule of profile %q:\n", profileName)
+		now := time.Now()
+		for _, name := range names {
+			se := profile.Schedule[name]
+			next := "disabled"
+			if !se.Disabled {
+				spec, err := scheduler.ParseSpec(se.When)
+				switch {
+				case err != nil:
+					next = err.Error()
+				case spec.Next(now).IsZero():
+					next = "never"
+				default:
+					next = "next " + spec.Next(now).Format(scheduleTimeFormat)
+				}
+			}
+			fmt.Printf("  %s: %q %s (%s)\n", name, se.When, describeScheduleEntry(se), next)
+		}
+		return
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "add":
+		se := &tunesettings.ScheduleEntry{}
+		fs := flag.NewFlagSet("schedule add", flag.ExitOnError)
+		fs.StringVar(&se.Channel, "channel", "", "key of the channel to play, empty keeps the channel")
+		fs.IntVar(&se.Volume, "volume", 0, "volume to set, 0 keeps the volume")
+		fs.IntVar(&se.RampMinutes, "ramp", 0, "minutes to raise the volume from 1 to the volume, for a wake-up alarm")
+		fs.Parse(args)
+		if fs.NArg() != 2 {
+			fmt.Println(`usage: tune-cli schedule add [-channel key] [-volume 60] [-ramp 10] name "minute hour day-of-month month day-of-week"`)
+			os.Exit(1)
+		}
+		name := fs.Arg(0)
+		se.When = fs.Arg(1)
+		_, err := scheduler.ParseSpec(se.When)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if se.Volume < 0 || se.Volume > 100 {
+			fmt.Printf("invalid volume %d, must be 0 to 100\n", se.Volume)
+			os.Exit(1)
+		}
+		if profile.Schedule == nil {
+			profile.Schedule = make(map[string]*tunesettings.ScheduleEntry)
+		}
+		profile.Schedule[name] = se
+	case "remove", "enable", "disable":
+		if len(args) != 1 {
+			fmt.Printf("usage: tune-cli schedule %s name\n", command)
+			os.Exit(1)
+		}
+		se := profile.Schedule[args[0]]
+		if se == nil {
+			fmt.Printf("profile %q has no schedule entry %q\n", profileName, args[0])
+			os.Exit(1)
+		}
+		switch command {
+		case "remove":
+			delete(profile.Schedule, args[0])
+		case "enable":
+			se.Disabled = false
+		case "disable":
+			se.Disabled = true
+		}
+	default:
+		fmt.Printf("unknown schedule command %q, use add, remove, enable or disable\n", command)
+		os.Exit(1)
+	}
+
+	err := settings.Save()
+	if err != nil {
+		fmt.Printf("error saving settings: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Schedule saved.")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	tunesettings "github.com/GeertJohan/tune/settings"
+)
+
+// sleepPresets are the sleep timers the sleep key cycles through, followed by the end of the track and off.
+var sleepPresets = []time.Duration{
+	15 * time.Minute,
+	30 * time.Minute,
+	60 * time.Minute,
+	90 * time.Minute,
+}
+
+// trackEndFade is how long the volume is lowered before the end of a track, when sleeping at the end of the track.
+const trackEndFade = 20 * time.Second
+
+// sleepRequest is a sleep timer as set by the user.
+type sleepRequest struct {
+	after    time.Duration // stop after this long, 0 is off
+	trackEnd bool          // stop at the end of the current track instead
+}
+
+func (r sleepRequest) String() string {
+	switch {
+	case r.trackEnd:
+		return "sleeping at the end of the track"
+	case r.after == 0:
+		return "sleep timer off"
+	}
+	return fmt.Sprintf("sleeping in %d minutes", int(r.after.Minutes()))
+}
+
+// parseSleep parses a sleep timer: a duration like 1h30m, a number of minutes, "track" for the end of the current
+// track, or "off".
+func parseSleep(s string) (sleepRequest, error) {
+	switch s {
+	case "track":
+		return sleepRequest{trackEnd: true}, nil
+	case "off", "0":
+		return sleepRequest{}, nil
+	}
+	minutes, err := strconv.Atoi(s)
+	if err == nil && minutes > 0 {
+		return sleepRequest{after: time.Duration(minutes) * time.Minute}, nil
+	}
+	after, err := time.ParseDuration(s)
+	if err != nil || after <= 0 {
+		return sleepRequest{}, fmt.Errorf("invalid sleep timer %q, use a duration like 45m, \"track\" or \"off\"", s)
+	}
+	return sleepRequest{after: after}, nil
+}
+
+// nextSleep returns the sleep timer that follows r when the sleep key is pressed.
+func nextSleep(r sleepRequest) sleepRequest {
+	if r.trackEnd {
+		return sleepRequest{}
+	}
+	for _, preset := range sleepPresets {
+		if preset > r.after {
+			return sleepRequest{after: preset}
+		}
+	}
+	return sleepRequest{trackEnd: true}
+}
+
+// sleepFade returns how long the sleep timer lowers the volume before playback stops.
+func sleepFade(settings *tunesettings.Settings) time.Duration {
+	return time.Duration(settings.Player.SleepFadeMinutes) * time.Minute
+}
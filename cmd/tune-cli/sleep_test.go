@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSleep(t *testing.T) {
+	tests := []struct {
+		s    string
+		want sleepRequest
+	}{
+		{"track", sleepRequest{trackEnd: true}},
+		{"off", sleepRequest{}},
+		{"0", sleepRequest{}},
+		{"45", sleepRequest{after: 45 * time.Minute}},
+		{"1h30m", sleepRequest{after: 90 * time.Minute}},
+		{"90s", sleepRequest{after: 90 * time.Second}},
+	}
+	for _, test := range tests {
+		got, err := parseSleep(test.s)
+		if err != nil || got != test.want {
+			t.Errorf("parseSleep(%q) = %+v, %v, want %+v", test.s, got, err, test.want)
+		}
+	}
+
+	for _, s := range []string{"", "-5", "-5m", "soon", "0s"} {
+		_, err := parseSleep(s)
+		if err == nil {
+			t.Errorf("parseSleep(%q) succeeded", s)
+		}
+	}
+}
+
+func TestNextSleep(t *testing.T) {
+	// the sleep key cycles through the presets, the end of the track and off
+	var got []sleepRequest
+	r := sleepRequest{}
+	for i := 0; i < len(sleepPresets)+2; i++ {
+		r = nextSleep(r)
+		got = append(got, r)
+	}
+	want := []sleepRequest{
+		{after: 15 * time.Minute},
+		{after: 30 * time.Minute},
+		{after: 60 * time.Minute},
+		{after: 90 * time.Minute},
+		{trackEnd: true},
+		{},
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("cycle %+v, want %+v", got, want)
+		}
+	}
+
+	// a timer set on the command line continues with the next larger preset
+	if r := nextSleep(sleepRequest{after: 45 * time.Minute}); r.after != 60*time.Minute {
+		t.Errorf("after 45 minutes comes %+v, want 60 minutes", r)
+	}
+	if r := nextSleep(sleepRequest{after: 2 * time.Hour}); !r.trackEnd {
+		t.Errorf("after 2 hours comes %+v, want the end of the track", r)
+	}
+}
+
+func TestSleepRequestString(t *testing.T) {
+	tests := map[sleepRequest]string{
+		{}:                        "sleep timer off",
+		{trackEnd: true}:          "sleeping at the end of the track",
+		{after: 30 * time.Minute}: "sleeping in 30 minutes",
+	}
+	for r, want := range tests {
+		if got := r.String(); got != want {
+			t.Errorf("%+v.String() = %q, want %q", r, got, want)
+		}
+	}
+}
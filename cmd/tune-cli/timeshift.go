@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	tunesettings "github.com/GeertJohan/tune/settings"
+)
+
+// seekStep is how far the seek keys move playback in the timeshift buffer.
+const seekStep = 30 * time.Second
+
+// timeshiftConfig returns the timeshift buffer duration and folder from the settings, the folder is empty for a
+// buffer in memory.
+func timeshiftConfig(settings *tunesettings.Settings, dirs tunesettings.Dirs) (time.Duration, string) {
+	duration := time.Duration(settings.Player.TimeshiftMinutes) * time.Minute
+	if !settings.Player.TimeshiftOnDisk {
+		return duration, ""
+	}
+	return duration, filepath.Join(dirs.Cache, "timeshift")
+}
+
+// formatBehind formats how far playback is behind live, as minutes and seconds.
+func formatBehind(behind time.Duration) string {
+	behind = behind.Round(time.Second)
+	return fmt.Sprintf("%d:%02d", int(behind.Minutes()), int(behind.Seconds())%60)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"time"
+
+	"github.com/GeertJohan/tune/api"
+	"github.com/GeertJohan/tune/clock"
+)
+
+// minTrackUpdate is the minimum time between track updates.
+// This avoids an infinite loop when the information provided by the api is incorrect.
+const minTrackUpdate = 2 * time.Second
+
+// trackProgress returns the duration of the track and the time that has passed since it started, according to clk.
+func trackProgress(clk clock.Interface, track *api.Track) (duration, passed time.Duration) {
+	duration = time.Duration(track.Duration) * time.Second
+	started := time.Unix(int64(track.Started), 0)
+	passed = clk.Now().Sub(started)
+	return duration, passed
+}
+
+// nextTrackUpdate returns how long to wait before the track information should be refreshed.
+func nextTrackUpdate(duration, passed time.Duration) time.Duration {
+	left := duration - passed
+	if left < minTrackUpdate {
+		left = minTrackUpdate
+	}
+	return left
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GeertJohan/tune/api"
+	"github.com/GeertJohan/tune/clock/clocktest"
+)
+
+func TestTrackProgress(t *testing.T) {
+	started := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	clk := clocktest.NewFake(started.Add(90 * time.Second))
+	track := &api.Track{Duration: 240, Started: int(started.Unix())}
+
+	duration, passed := trackProgress(clk, track)
+	if duration != 4*time.Minute || passed != 90*time.Second {
+		t.Fatalf("progress %v of %v, want 1m30s of 4m0s", passed, duration)
+	}
+
+	clk.Advance(time.Minute)
+	_, passed = trackProgress(clk, track)
+	if passed != 150*time.Second {
+		t.Fatalf("passed %v, want 2m30s", passed)
+	}
+}
+
+func TestNextTrackUpdate(t *testing.T) {
+	tests := []struct {
+		duration, passed, want time.Duration
+	}{
+		{4 * time.Minute, 90 * time.Second, 150 * time.Second},
+		{4 * time.Minute, 4*time.Minute - time.Second, minTrackUpdate},
+		{4 * time.Minute, 5 * time.Minute, minTrackUpdate}, // the track should have ended already
+		{0, 0, minTrackUpdate}, // no duration known
+	}
+	for _, test := range tests {
+		got := nextTrackUpdate(test.duration, test.passed)
+		if got != test.want {
+			t.Errorf("nextTrackUpdate(%v, %v) = %v, want %v", test.duration, test.passed, got, test.want)
+		}
+	}
+}
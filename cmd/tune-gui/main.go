@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"strconv"
@@ -14,7 +15,7 @@ import (
 	"github.com/therecipe/qt/quickcontrols2"
 
 	"github.com/GeertJohan/tune/api"
-	"github.com/GeertJohan/tune/config"
+	tunesettings "github.com/GeertJohan/tune/settings"
 )
 
 //go:generate qtmoc
@@ -30,8 +31,14 @@ type PlayerBridge struct {
 }
 
 func main() {
-	// Add panicwrap to catch any panics and save them to file.
-	exitStatus, err := panicwrap.BasicWrap(panicToFile)
+	// the arguments belong to qt for now, so only environment variables override the settings
+	overrides := tunesettings.NewOverrides(flag.NewFlagSet("tune-gui", flag.ContinueOnError))
+
+	// Add panicwrap to catch any panics and save them to file in the log folder.
+	dirs, _ := overrides.Dirs()
+	exitStatus, err := panicwrap.BasicWrap(func(output string) {
+		panicToFile(dirs.Log, output)
+	})
 	if err != nil {
 		panic(err)
 	}
@@ -63,15 +70,13 @@ func main() {
 
 	var chGuiClosed = make(chan chan struct{})
 
-	// hardcode di.fm network for now
-	network := api.NetworkDI
-	conf := loadConfig()
-	// load account
-	account := loadAccount(network, conf)
-	streamList := loadStreamList(network, conf, account)
+	conf := loadConfig(overrides)
+	// load account on the network of the profile
+	network, account, cfg := loadAccount(conf, overrides)
+	streamList := loadStreamList(network, conf, cfg, account)
 
 	go startChannelList(streamList, channelBridge)
-	go startPlayer(chGuiClosed, conf, account, playerBridge)
+	go startPlayer(chGuiClosed, cfg, account, playerBridge)
 
 	// enter the main event loop, blocks until gui is exited
 	gui.QGuiApplication_Exec()
@@ -82,28 +87,58 @@ func main() {
 	<-chPlayerClosed
 }
 
-func loadConfig() *config.Config {
-	// Load aa configuration. Note this config is compatible with aacli and by default is saved in the same location.
-	conf, err := config.Load()
+func loadConfig(overrides *tunesettings.Overrides) *tunesettings.Settings {
+	// Load tune settings. A legacy aacli config is imported when there are no tune settings yet.
+	conf, err := overrides.Load()
 	if err != nil {
-		if err == config.ErrNoConfigFile {
-			conf = config.New()
-		} else {
-			fmt.Printf("error loading conf: %v\n", err)
-			os.Exit(1)
-		}
+		fmt.Printf("error loading or creating settings file: %v\n", err)
+		os.Exit(1)
 	}
 	return conf
 }
 
-func loadAccount(network *api.Network, conf *config.Config) *api.Account {
+func loadAccount(conf *tunesettings.Settings, overrides *tunesettings.Overrides) (*api.Network, *api.Account, *tunesettings.Config) {
+	// credentials are kept outside of the settings file
+	credStore, err := conf.OpenCredentialStore(conf.Settings.LastProfile, func() (string, error) {
+		return mustReadLine("credentials passphrase: "), nil
+	})
+	if err != nil {
+		fmt.Printf("error opening credential store: %v\n", err)
+		os.Exit(1)
+	}
+	creds, err := credStore.Load()
+	if err == tunesettings.ErrNoCredentials {
+		creds, err = &tunesettings.Credentials{}, nil
+	}
+	if err != nil {
+		fmt.Printf("error loading stored credentials: %v\n", err)
+		os.Exit(1)
+	}
+	cfg, err := overrides.Resolve(conf, conf.Settings.LastProfile, creds)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	creds.APIKey = cfg.APIKey
+
+	network := api.NetworkByKey(cfg.NetworkKey)
+	if network == nil {
+		if cfg.NetworkKey != "" {
+			fmt.Printf("Unknown network %q from %s, using %s.\n", cfg.NetworkKey, cfg.Source(tunesettings.KeyNetwork), api.NetworkDI.Name)
+		}
+		network = api.NetworkDI
+		if !cfg.Overridden(tunesettings.KeyNetwork) {
+			conf.Profile(conf.Settings.LastProfile).NetworkKey = network.Key
+			conf.Save()
+		}
+	}
+
 	// authenticate account
-	var err error
 	var account *api.Account
-	if conf.Account.APIKey != "" {
-		account, err = network.AuthenticateAPIKey(conf.Account.APIKey)
+	if creds.APIKey != "" {
+		account, err = network.AuthenticateAPIKey(creds.APIKey)
 		if err == api.ErrInvalidCredentials {
-			fmt.Println("Could not authenticate with saved API key.")
+			fmt.Printf("Could not authenticate with API key from %s.\n", cfg.Source(tunesettings.KeyAPIKey))
 		} else if err != nil {
 			fmt.Printf("error authenticating with API key: %v\n", err)
 			os.Exit(1)
@@ -122,12 +157,15 @@ func loadAccount(network *api.Network, conf *config.Config) *api.Account {
 				fmt.Printf("error authenticating with username/password: %v\n", err)
 				os.Exit(1)
 			}
-			conf.Account.APIKey = account.APIKey
-			conf.Save()
+			creds.APIKey = account.APIKey
+			err = credStore.Save(creds)
+			if err != nil {
+				fmt.Printf("error saving credentials: %v\n", err)
+			}
 			break
 		}
 	}
-	return account
+	return network, account, cfg
 }
 
 func mustReadLine(prompt string) string {
@@ -143,11 +181,11 @@ func mustReadLine(prompt string) string {
 	}
 }
 
-func loadStreamList(network *api.Network, conf *config.Config, account *api.Account) *api.Streamlist {
+func loadStreamList(network *api.Network, conf *tunesettings.Settings, cfg *tunesettings.Config, account *api.Account) *api.Streamlist {
 	var err error
 	var streamList *api.Streamlist
-	if conf.Settings.StreamlistKey != "" {
-		streamList, err = network.StreamlistByKey(conf.Settings.StreamlistKey)
+	if cfg.StreamlistKey != "" {
+		streamList, err = network.StreamlistByKey(cfg.StreamlistKey)
 		if err != nil {
 			fmt.Println("Could not use saved stream quality, selecting best quality.")
 			linenoise.Line("Press enter to continue")
@@ -155,8 +193,10 @@ func loadStreamList(network *api.Network, conf *config.Config, account *api.Acco
 	}
 	if streamList == nil {
 		streamList = network.BestStreamlist(account.Premium)
-		conf.Settings.StreamlistKey = streamList.Key
-		conf.Save()
+		if !cfg.Overridden(tunesettings.KeyStreamlist) {
+			conf.Profile(conf.Settings.LastProfile).StreamlistKey = streamList.Key
+			conf.Save()
+		}
 	}
 	return streamList
 }
@@ -187,7 +227,7 @@ func startChannelList(streamList *api.Streamlist, channelBridge *ChannelBridge)
 	}
 }
 
-func startPlayer(chGuiClosed chan chan struct{}, conf *config.Config, account *api.Account, playerBridge *PlayerBridge) {
+func startPlayer(chGuiClosed chan chan struct{}, cfg *tunesettings.Config, account *api.Account, playerBridge *PlayerBridge) {
 
 	// // create a clock
 	// var clk *clock.Clock
@@ -203,7 +243,7 @@ func startPlayer(chGuiClosed chan chan struct{}, conf *config.Config, account *a
 	// create an aaplayer
 	player := aaplayer.NewPlayer(account)
 	// restore default config
-	player.SetVolume(conf.Player.Volume)
+	player.SetVolume(cfg.Volume)
 	// defer proper shutdown of the player
 	defer player.Close()
 
@@ -261,8 +301,8 @@ func startPlayer(chGuiClosed chan chan struct{}, conf *config.Config, account *a
 	// 	signal.Notify(sigChan, os.Kill)
 	//
 	// 	// start channel that was previously being played
-	// 	if conf.Player.LastPlayedChannel != "" {
-	// 		channel := channelsByKey[conf.Player.LastPlayedChannel]
+	// 	if profile.LastPlayedChannel != "" {
+	// 		channel := channelsByKey[profile.LastPlayedChannel]
 	// 		if channel != nil {
 	// 			player.SetChannel(channel)
 	// 			display.SetChannel(channel.Name, channel.Key)
@@ -270,16 +310,16 @@ func startPlayer(chGuiClosed chan chan struct{}, conf *config.Config, account *a
 	// 	}
 	//
 	// 	changeVolume := func(change int) {
-	// 		conf.Player.Volume += change
-	// 		if conf.Player.Volume < 0 {
-	// 			conf.Player.Volume = 0
+	// 		profile.Volume += change
+	// 		if profile.Volume < 0 {
+	// 			profile.Volume = 0
 	// 		}
-	// 		if conf.Player.Volume > 100 {
-	// 			conf.Player.Volume = 100
+	// 		if profile.Volume > 100 {
+	// 			profile.Volume = 100
 	// 		}
 	// 		// first set volume (fast audio feedback to user), afterwards save conf to disk
-	// 		player.SetVolume(conf.Player.Volume)
-	// 		display.Notify(fmt.Sprintf("volume set to %02d%%", conf.Player.Volume))
+	// 		player.SetVolume(cfg.Volume)
+	// 		display.Notify(fmt.Sprintf("volume set to %02d%%", profile.Volume))
 	// 		conf.Save()
 	// 	}
 	//
@@ -304,7 +344,7 @@ func startPlayer(chGuiClosed chan chan struct{}, conf *config.Config, account *a
 	// 					ch := channelsByKey[channelKey]
 	// 					player.SetChannel(ch)
 	// 					display.SetChannel(ch.Name, ch.Key)
-	// 					conf.Player.LastPlayedChannel = ch.Key
+	// 					profile.LastPlayedChannel = ch.Key
 	// 					conf.Save()
 	// 				}
 	// 				switch event.Ch {
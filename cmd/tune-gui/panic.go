@@ -3,15 +3,17 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 )
 
-func panicToFile(output string) {
-	panicFile, err := os.Create(fmt.Sprintf("aagui-panic-%d", time.Now().Unix()))
+func panicToFile(logDir, output string) {
+	os.MkdirAll(logDir, 0700)
+	panicFile, err := os.Create(filepath.Join(logDir, fmt.Sprintf("aagui-panic-%d", time.Now().Unix())))
 	if err != nil {
 		panic(err) // seriously!? Looks like we're out of luck today..
 	}
 	defer panicFile.Close()
 	panicFile.WriteString(output)
-	fmt.Println("PANIC TO FILE!")
+	fmt.Printf("PANIC TO FILE! %s\n", panicFile.Name())
 }
@@ -0,0 +1,73 @@
+package player
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// streamClient connects to the streams. A stream doesn't end, so there is no overall timeout, but a server that
+// doesn't accept the connection or doesn't respond is given up on.
+var streamClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+	},
+}
+
+// AudioBackend plays audio streams for a Player.
+// A Player only calls its backend from one goroutine at a time, implementations don't have to be safe for concurrent use.
+type AudioBackend interface {
+	// Open opens the stream at url, a stream that was open before is closed. Playback starts with Play.
+	Open(url string) error
+
+	// Play starts playback of the open stream.
+	Play() error
+
+	// Stop stops playback.
+	Stop() error
+
+	// IsPlaying returns true when the backend is playing.
+	IsPlaying() bool
+
+	// SetVolume sets the volume between 0 and 100 (inclusive).
+	// It may be called at any time, the volume applies to current and future playback.
+	SetVolume(volume int) error
+
+	// Events returns the channel on which the backend sends its events.
+	Events() <-chan BackendEvent
+
+	// Close stops playback and releases the backend, it can't be used afterwards.
+	Close() error
+}
+
+// BackendEventType is the type of a BackendEvent.
+type BackendEventType int
+
+// Backend event types.
+const (
+	// BackendPlaying is sent when playback has started.
+	BackendPlaying BackendEventType = iota
+	// BackendStopped is sent when playback has stopped.
+	BackendStopped
+	// BackendError is sent when playback failed, Err holds the error.
+	BackendError
+	// BackendMetadata is sent when the stream sent new metadata, Title holds the stream title when the backend knows it.
+	BackendMetadata
+)
+
+// BackendEvent is an event from an AudioBackend.
+type BackendEvent struct {
+	Type  BackendEventType
+	Err   error
+	Title string
+}
+
+// backendEventBuffer is the number of events a backend buffers. Backends may drop events when the buffer is full,
+// so they never block on a Player that isn't reading.
+const backendEventBuffer = 16
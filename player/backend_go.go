@@ -0,0 +1,212 @@
+package player
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// pcmBufferSize is the size of the buffer that decoded audio is read into, about 50ms of 44.1kHz stereo.
+const pcmBufferSize = 8192
+
+// GoBackend is an AudioBackend written in Go, without libvlc.
+// It fetches the HTTP stream itself, decodes it with the Decoder registered for its content type,
+// applies the volume and writes the PCM to an Output. Stream titles are read from the ICY metadata.
+type GoBackend struct {
+	client *http.Client
+	output Output
+
+	lock    sync.Mutex
+	url     string
+	volume  int
+	cancel  context.CancelFunc // stops the current stream, nil when not playing
+	chDone  chan struct{}      // closed when the current stream has stopped
+	playing bool
+
+	chEvents chan BackendEvent
+}
+
+var _ AudioBackend = (*GoBackend)(nil)
+
+// NewGoBackend creates a GoBackend that writes to output.
+// The backend owns the output and closes it on Close.
+func NewGoBackend(output Output) *GoBackend {
+	return &GoBackend{
+		client:   streamClient,
+		output:   output,
+		volume:   100,
+		chEvents: make(chan BackendEvent, backendEventBuffer),
+	}
+}
+
+// Open stops the current stream and sets the url for Play.
+func (b *GoBackend) Open(url string) error {
+	b.Stop()
+	b.lock.Lock()
+	b.url = url
+	b.lock.Unlock()
+	return nil
+}
+
+// Play starts streaming the url in the background.
+func (b *GoBackend) Play() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.url == "" {
+		return errors.New("no stream opened")
+	}
+	if b.cancel != nil {
+		return nil // already playing
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	b.chDone = make(chan struct{})
+	go b.stream(ctx, b.url, b.chDone)
+	return nil
+}
+
+// Stop stops the stream and waits until it has stopped.
+func (b *GoBackend) Stop() error {
+	b.lock.Lock()
+	cancel, chDone := b.cancel, b.chDone
+	b.cancel = nil
+	b.lock.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-chDone
+	return nil
+}
+
+// IsPlaying returns true when audio is being written to the output.
+func (b *GoBackend) IsPlaying() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.playing
+}
+
+// SetVolume sets the volume that is applied to the decoded audio.
+func (b *GoBackend) SetVolume(volume int) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.volume = volume
+	return nil
+}
+
+// Events returns the channel with events from the stream.
+func (b *GoBackend) Events() <-chan BackendEvent {
+	return b.chEvents
+}
+
+// Close stops the stream and closes the output.
+func (b *GoBackend) Close() error {
+	b.Stop()
+	return b.output.Close()
+}
+
+// send sends an event, events are dropped when nobody is reading.
+func (b *GoBackend) send(ev BackendEvent) {
+	select {
+	case b.chEvents <- ev:
+	default:
+	}
+}
+
+func (b *GoBackend) setPlaying(playing bool) {
+	b.lock.Lock()
+	b.playing = playing
+	b.lock.Unlock()
+}
+
+// stream fetches, decodes and outputs the stream until ctx is cancelled or the stream fails.
+func (b *GoBackend) stream(ctx context.Context, url string, chDone chan struct{}) {
+	defer close(chDone)
+
+	err := b.streamAudio(ctx, url)
+	if err != nil && ctx.Err() == nil {
+		b.send(BackendEvent{Type: BackendError, Err: err})
+	}
+	b.setPlaying(false)
+	b.send(BackendEvent{Type: BackendStopped})
+
+	// a stream that ended by itself must be cleared, so Play can start it again
+	b.lock.Lock()
+	if b.chDone == chDone {
+		b.cancel = nil
+	}
+	b.lock.Unlock()
+}
+
+func (b *GoBackend) streamAudio(ctx context.Context, url string) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create stream request")
+	}
+	RequestICYMetadata(req)
+	resp, err := b.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to stream")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("stream responded with status %s", resp.Status)
+	}
+
+	// the stream title is sent when it changes, and repeated in between by some servers
+	var title string
+	audio := NewICYReader(resp.Body, ICYMetaInt(resp.Header), func(streamTitle string) {
+		if streamTitle != title {
+			title = streamTitle
+			b.send(BackendEvent{Type: BackendMetadata, Title: title})
+		}
+	})
+	dec, err := NewDecoder(resp.Header.Get("Content-Type"), audio)
+	if err != nil {
+		return err
+	}
+	format := dec.Format()
+	err = b.output.Open(format)
+	if err != nil {
+		return errors.Wrap(err, "failed to open output")
+	}
+	b.setPlaying(true)
+	b.send(BackendEvent{Type: BackendPlaying})
+
+	pcm := make([]byte, pcmBufferSize-pcmBufferSize%format.bytesPerFrame())
+	for {
+		n, err := dec.Read(pcm)
+		if n > 0 {
+			b.lock.Lock()
+			volume := b.volume
+			b.lock.Unlock()
+			applyVolume(pcm[:n], volume)
+			_, werr := b.output.Write(pcm[:n])
+			if werr != nil {
+				return errors.Wrap(werr, "failed to write to output")
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to decode stream")
+		}
+	}
+}
+
+// applyVolume scales 16-bit little-endian samples by volume, between 0 and 100.
+func applyVolume(pcm []byte, volume int) {
+	if volume >= 100 {
+		return
+	}
+	for i := 0; i+1 < len(pcm); i += 2 {
+		sample := int32(int16(binary.LittleEndian.Uint16(pcm[i:])))
+		binary.LittleEndian.PutUint16(pcm[i:], uint16(int16(sample*int32(volume)/100)))
+	}
+}
@@ -0,0 +1,186 @@
+package player_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GeertJohan/tune/player"
+)
+
+const (
+	// mp3FrameSize is the size of an MPEG-1 Layer III frame at 128kbit/s and 44.1kHz without padding.
+	mp3FrameSize = 417
+
+	// mp3FramePCM is the size of a decoded frame: 1152 stereo 16-bit samples.
+	mp3FramePCM = 1152 * 2 * 2
+
+	// aacFramePCM is the size of a decoded frame: 1024 stereo 16-bit samples.
+	aacFramePCM = 1024 * 2 * 2
+)
+
+// silentMP3 returns n frames of silent MPEG-1 Layer III, 128kbit/s 44.1kHz stereo.
+// The side info and main data are all zeroes, so every granule is empty.
+func silentMP3(n int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		frame := make([]byte, mp3FrameSize)
+		copy(frame, []byte{0xff, 0xfb, 0x90, 0x00}) // MPEG-1 Layer III without CRC, 128kbit/s, 44.1kHz, stereo
+		buf.Write(frame)
+	}
+	return buf.Bytes()
+}
+
+// silentAAC returns n ADTS frames of silent AAC-LC, 44.1kHz stereo.
+// Every frame is a channel pair of two long windows without scalefactor bands.
+func silentAAC(n int) []byte {
+	raw := []byte{0x20, 0x64, 0x00, 0x01, 0x90, 0x00, 0x0e}
+	size := 7 + len(raw)
+	header := []byte{
+		0xff, 0xf1, // MPEG-4 without CRC
+		0x50,                  // AAC-LC, 44.1kHz
+		0x80 | byte(size>>11), // stereo
+		byte(size >> 3),
+		byte(size<<5) | 0x1f, // variable bitrate
+		0xfc,                 // one raw data block
+	}
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		buf.Write(header)
+		buf.Write(raw)
+	}
+	return buf.Bytes()
+}
+
+// wav is a decoded WAV file.
+type wav struct {
+	channels   int
+	sampleRate int
+	bits       int
+	pcm        []byte
+}
+
+// playToWAV plays a stream with given content type through a GoBackend into a WAVOutput and reads the file back.
+func playToWAV(t *testing.T, contentType string, stream []byte) wav {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Write(stream)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "out.wav")
+	b := player.NewGoBackend(player.NewWAVOutput(path))
+	err := b.Open(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Play()
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(5 * time.Second)
+	for stopped := false; !stopped; {
+		select {
+		case ev := <-b.Events():
+			if ev.Type == player.BackendError {
+				t.Fatal(ev.Err)
+			}
+			stopped = ev.Type == player.BackendStopped
+		case <-timeout:
+			t.Fatal("stream didn't end")
+		}
+	}
+	err = b.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 44 || string(data[:4]) != "RIFF" || string(data[8:16]) != "WAVEfmt " || string(data[36:40]) != "data" {
+		t.Fatalf("no wav header: % x", data)
+	}
+	dataSize := binary.LittleEndian.Uint32(data[40:])
+	if int(dataSize) != len(data)-44 {
+		t.Fatalf("data size %d in header, file has %d bytes of data", dataSize, len(data)-44)
+	}
+	return wav{
+		channels:   int(binary.LittleEndian.Uint16(data[22:])),
+		sampleRate: int(binary.LittleEndian.Uint32(data[24:])),
+		bits:       int(binary.LittleEndian.Uint16(data[34:])),
+		pcm:        data[44:],
+	}
+}
+
+// checkSilentWAV checks the format of the wav, and that it has size bytes of silence.
+func checkSilentWAV(t *testing.T, w wav, sampleRate, size int) {
+	t.Helper()
+	if w.channels != 2 || w.sampleRate != sampleRate || w.bits != 16 {
+		t.Fatalf("format %d channels %dHz %d bits, want 2 channels %dHz 16 bits", w.channels, w.sampleRate, w.bits, sampleRate)
+	}
+	if len(w.pcm) != size {
+		t.Fatalf("decoded %d bytes of pcm, want %d", len(w.pcm), size)
+	}
+	for i, sample := range w.pcm {
+		if sample != 0 {
+			t.Fatalf("pcm byte %d is %d, want silence", i, sample)
+		}
+	}
+}
+
+func TestGoBackendMP3(t *testing.T) {
+	const frames = 20
+	w := playToWAV(t, "audio/mpeg", silentMP3(frames))
+	checkSilentWAV(t, w, 44100, frames*mp3FramePCM)
+}
+
+func TestGoBackendAAC(t *testing.T) {
+	const frames = 20
+	for _, contentType := range []string{"audio/aac", "audio/aacp"} {
+		t.Run(contentType, func(t *testing.T) {
+			w := playToWAV(t, contentType, silentAAC(frames))
+			checkSilentWAV(t, w, 44100, frames*aacFramePCM)
+		})
+	}
+}
+
+func TestGoBackendAACResync(t *testing.T) {
+	// a stream that is joined halfway a frame, with garbage between the frames
+	var stream []byte
+	stream = append(stream, silentAAC(1)[5:]...)
+	stream = append(stream, silentAAC(2)...)
+	stream = append(stream, 0xff, 0x00, 0x12)
+	stream = append(stream, silentAAC(3)...)
+	w := playToWAV(t, "audio/aacp", stream)
+	checkSilentWAV(t, w, 44100, 5*aacFramePCM)
+}
+
+func TestGoBackendUnsupportedEncoding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/x-ms-wma")
+		w.Write(make([]byte, 1024))
+	}))
+	defer server.Close()
+
+	b := player.NewGoBackend(player.NullOutput{})
+	defer b.Close()
+	b.Open(server.URL)
+	b.Play()
+	select {
+	case ev := <-b.Events():
+		if ev.Type != player.BackendError || !errors.Is(ev.Err, player.ErrUnsupportedEncoding) {
+			t.Fatalf("event %+v, want unsupported encoding error", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error")
+	}
+}
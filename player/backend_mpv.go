@@ -0,0 +1,348 @@
+package player
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// mpvStartTimeout is how long a launched mpv gets to create its IPC socket.
+	mpvStartTimeout = 5 * time.Second
+
+	// mpvCommandTimeout is how long mpv gets to respond to a command.
+	mpvCommandTimeout = 5 * time.Second
+
+	// mpvMetadataObserver is the id for observing the metadata property.
+	mpvMetadataObserver = 1
+)
+
+// ErrMPVClosed is returned for commands to an mpv that has exited or was detached.
+var ErrMPVClosed = errors.New("mpv connection closed")
+
+// MPVBackend is an AudioBackend that plays with mpv, controlled over its JSON IPC socket.
+// See https://mpv.io/manual/stable/#json-ipc for the protocol.
+type MPVBackend struct {
+	conn    net.Conn
+	cmd     *exec.Cmd // nil when attached to a running mpv
+	tempDir string    // holds the socket of a launched mpv
+
+	lock    sync.Mutex
+	nextID  int
+	pending map[int]chan mpvMessage
+	url     string
+	playing bool
+	loading bool // loadfile was sent, mpv didn't start the file yet
+
+	chEvents chan BackendEvent
+	chClosed chan struct{}
+}
+
+var _ AudioBackend = (*MPVBackend)(nil)
+
+// mpvMessage is a response to a command or an event, as sent by mpv.
+type mpvMessage struct {
+	// responses
+	RequestID int             `json:"request_id"`
+	Error     string          `json:"error"`
+	Data      json.RawMessage `json:"data"`
+
+	// events
+	Event     string `json:"event"`
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Reason    string `json:"reason"`
+	FileError string `json:"file_error"`
+}
+
+// NewMPVBackend launches mpv without video and terminal, and controls it over an IPC socket in a temporary folder.
+// The mpv executable is looked up in PATH when mpvPath is empty. Extra arguments are passed to mpv as they are,
+// mpv also reads its own config, so audio output settings apply.
+func NewMPVBackend(mpvPath string, args ...string) (*MPVBackend, error) {
+	if mpvPath == "" {
+		mpvPath = "mpv"
+	}
+	tempDir, err := ioutil.TempDir("", "tune-mpv")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create folder for mpv socket")
+	}
+	socketPath := filepath.Join(tempDir, "mpv.sock")
+
+	args = append([]string{
+		"--idle=yes",
+		"--no-video",
+		"--no-terminal",
+		"--input-ipc-server=" + socketPath,
+	}, args...)
+	cmd := exec.Command(mpvPath, args...)
+	err = cmd.Start()
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return nil, errors.Wrap(err, "failed to start mpv")
+	}
+
+	// mpv creates the socket once it has started
+	var conn net.Conn
+	deadline := time.Now().Add(mpvStartTimeout)
+	for {
+		conn, err = net.Dial("unix", socketPath)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			cmd.Wait()
+			os.RemoveAll(tempDir)
+			return nil, errors.Wrap(err, "failed to connect to mpv")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	b, err := newMPVBackend(conn)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+	b.cmd = cmd
+	b.tempDir = tempDir
+	return b, nil
+}
+
+// AttachMPVBackend controls a running mpv that was started with --input-ipc-server=socketPath.
+// The mpv keeps running after Close. On Windows mpv uses named pipes, which aren't supported.
+func AttachMPVBackend(socketPath string) (*MPVBackend, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to mpv")
+	}
+	b, err := newMPVBackend(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+func newMPVBackend(conn net.Conn) (*MPVBackend, error) {
+	b := &MPVBackend{
+		conn:     conn,
+		pending:  make(map[int]chan mpvMessage),
+		chEvents: make(chan BackendEvent, backendEventBuffer),
+		chClosed: make(chan struct{}),
+	}
+	go b.read()
+
+	// the icy-title in the metadata is the stream title
+	_, err := b.command("observe_property", mpvMetadataObserver, "metadata")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to observe mpv metadata")
+	}
+	return b, nil
+}
+
+// read reads responses and events from mpv until the connection is closed.
+func (b *MPVBackend) read() {
+	defer close(b.chClosed)
+	scanner := bufio.NewScanner(b.conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var msg mpvMessage
+		err := json.Unmarshal(scanner.Bytes(), &msg)
+		if err != nil {
+			b.send(BackendEvent{Type: BackendError, Err: errors.Wrap(err, "failed to decode message from mpv")})
+			continue
+		}
+		if msg.Event != "" {
+			b.handleEvent(msg)
+			continue
+		}
+		b.lock.Lock()
+		ch, ok := b.pending[msg.RequestID]
+		delete(b.pending, msg.RequestID)
+		b.lock.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+}
+
+// handleEvent translates mpv events to backend events.
+func (b *MPVBackend) handleEvent(msg mpvMessage) {
+	switch msg.Event {
+	case "start-file":
+		b.lock.Lock()
+		b.loading = false
+		b.lock.Unlock()
+	case "playback-restart":
+		// also sent after seeking, only the first one starts playback
+		if b.setPlaying(true) {
+			b.send(BackendEvent{Type: BackendPlaying})
+		}
+	case "end-file":
+		b.lock.Lock()
+		loading := b.loading
+		b.lock.Unlock()
+		if loading {
+			return // the end of the stream that played before the loadfile
+		}
+		if msg.Reason == "error" {
+			b.send(BackendEvent{Type: BackendError, Err: fmt.Errorf("mpv failed to play stream: %s", msg.FileError)})
+		}
+		if b.setPlaying(false) {
+			b.send(BackendEvent{Type: BackendStopped})
+		}
+	case "property-change":
+		if msg.ID != mpvMetadataObserver {
+			return
+		}
+		var metadata map[string]string
+		json.Unmarshal(msg.Data, &metadata) // null when nothing is loaded
+		if metadata == nil {
+			return
+		}
+		b.send(BackendEvent{Type: BackendMetadata, Title: metadata["icy-title"]})
+	}
+}
+
+// setPlaying sets the playing state, it returns true when the state changed.
+func (b *MPVBackend) setPlaying(playing bool) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	changed := b.playing != playing
+	b.playing = playing
+	return changed
+}
+
+// command sends a command to mpv and waits for the response.
+func (b *MPVBackend) command(args ...interface{}) (json.RawMessage, error) {
+	ch := make(chan mpvMessage, 1)
+	b.lock.Lock()
+	b.nextID++
+	id := b.nextID
+	b.pending[id] = ch
+	b.lock.Unlock()
+
+	request, err := json.Marshal(struct {
+		Command   []interface{} `json:"command"`
+		RequestID int           `json:"request_id"`
+	}{args, id})
+	if err != nil {
+		return nil, err
+	}
+	_, err = b.conn.Write(append(request, '\n'))
+	if err != nil {
+		b.forget(id)
+		return nil, errors.Wrap(err, "failed to send command to mpv")
+	}
+
+	select {
+	case msg := <-ch:
+		if msg.Error != "success" {
+			return nil, fmt.Errorf("mpv command %v failed: %s", args[0], msg.Error)
+		}
+		return msg.Data, nil
+	case <-b.chClosed:
+		return nil, ErrMPVClosed
+	case <-time.After(mpvCommandTimeout):
+		b.forget(id)
+		return nil, fmt.Errorf("mpv command %v timed out", args[0])
+	}
+}
+
+func (b *MPVBackend) forget(id int) {
+	b.lock.Lock()
+	delete(b.pending, id)
+	b.lock.Unlock()
+}
+
+// Open stops playback and sets the url for Play.
+func (b *MPVBackend) Open(url string) error {
+	err := b.Stop()
+	if err != nil {
+		return err
+	}
+	b.lock.Lock()
+	b.url = url
+	b.playing = false // mpv sends the end-file of the stopped stream after the response to stop
+	b.lock.Unlock()
+	return nil
+}
+
+// Play loads the url in mpv, which starts playback.
+func (b *MPVBackend) Play() error {
+	b.lock.Lock()
+	url, playing := b.url, b.playing
+	if url != "" && !playing {
+		b.loading = true
+	}
+	b.lock.Unlock()
+	if url == "" {
+		return errors.New("no stream opened")
+	}
+	if playing {
+		return nil
+	}
+	_, err := b.command("loadfile", url, "replace")
+	if err != nil {
+		b.lock.Lock()
+		b.loading = false
+		b.lock.Unlock()
+	}
+	return err
+}
+
+// Stop stops playback, mpv stays idle.
+func (b *MPVBackend) Stop() error {
+	_, err := b.command("stop")
+	return err
+}
+
+// IsPlaying returns true when mpv is playing.
+func (b *MPVBackend) IsPlaying() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.playing
+}
+
+// SetVolume sets the volume property of mpv, it is kept for later streams.
+func (b *MPVBackend) SetVolume(volume int) error {
+	_, err := b.command("set_property", "volume", volume)
+	return err
+}
+
+// Events returns the channel with events from mpv.
+func (b *MPVBackend) Events() <-chan BackendEvent {
+	return b.chEvents
+}
+
+// Close quits a launched mpv, or stops playback and detaches from an attached mpv.
+func (b *MPVBackend) Close() error {
+	if b.cmd == nil {
+		b.Stop()
+		return b.conn.Close()
+	}
+	b.command("quit")
+	b.conn.Close()
+	err := b.cmd.Wait()
+	os.RemoveAll(b.tempDir)
+	return err
+}
+
+// send sends an event, events are dropped when nobody is reading.
+func (b *MPVBackend) send(ev BackendEvent) {
+	select {
+	case b.chEvents <- ev:
+	default:
+	}
+}
@@ -0,0 +1,138 @@
+package player_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GeertJohan/tune/player"
+	"github.com/GeertJohan/tune/player/playertest"
+)
+
+func newTestMPV(t *testing.T) (*player.MPVBackend, *playertest.MPVServer) {
+	s, err := playertest.NewMPVServer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	b, err := player.AttachMPVBackend(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b, s
+}
+
+// nextBackendEvent returns the next event of the backend, stops of an earlier stream are skipped when skipStopped
+// is set.
+func nextBackendEvent(t *testing.T, b player.AudioBackend, skipStopped bool) player.BackendEvent {
+	t.Helper()
+	for {
+		select {
+		case ev := <-b.Events():
+			if skipStopped && ev.Type == player.BackendStopped {
+				continue
+			}
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("no backend event")
+		}
+	}
+}
+
+// loaded returns the arguments of the loadfile commands the server received.
+func loaded(s *playertest.MPVServer) []string {
+	var urls []string
+	for _, command := range s.Commands() {
+		if command[0] == "loadfile" {
+			urls = append(urls, fmt.Sprint(command[1], " ", command[2]))
+		}
+	}
+	return urls
+}
+
+func TestMPVBackendPlayStop(t *testing.T) {
+	b, s := newTestMPV(t)
+	if err := b.Play(); err == nil {
+		t.Fatal("Play without Open succeeded")
+	}
+
+	err := b.Open("http://stream/one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Play()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextBackendEvent(t, b, true); ev.Type != player.BackendPlaying {
+		t.Fatalf("event %v, want playing", ev.Type)
+	}
+	if !b.IsPlaying() {
+		t.Fatal("not playing")
+	}
+	if want := []string{"http://stream/one replace"}; !reflect.DeepEqual(loaded(s), want) {
+		t.Fatalf("loaded %q, want %q", loaded(s), want)
+	}
+
+	s.SendEvent(map[string]interface{}{"event": "property-change", "id": 1, "name": "metadata", "data": map[string]string{"icy-title": "Artist - Title"}})
+	if ev := nextBackendEvent(t, b, false); ev.Type != player.BackendMetadata || ev.Title != "Artist - Title" {
+		t.Fatalf("event %v %q, want the title", ev.Type, ev.Title)
+	}
+
+	err = b.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextBackendEvent(t, b, false); ev.Type != player.BackendStopped {
+		t.Fatalf("event %v, want stopped", ev.Type)
+	}
+	if b.IsPlaying() {
+		t.Fatal("still playing")
+	}
+}
+
+func TestMPVBackendSwitch(t *testing.T) {
+	b, s := newTestMPV(t)
+	s.DelayEndFile(true)
+	for _, url := range []string{"http://stream/one", "http://stream/two", "http://stream/three"} {
+		// the end-file of the previous stream arrives after Open returned, Play must load the new stream anyway
+		err := b.Open(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = b.Play()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev := nextBackendEvent(t, b, true); ev.Type != player.BackendPlaying {
+			t.Fatalf("event %v for %s, want playing", ev.Type, url)
+		}
+	}
+	want := []string{"http://stream/one replace", "http://stream/two replace", "http://stream/three replace"}
+	if !reflect.DeepEqual(loaded(s), want) {
+		t.Fatalf("loaded %q, want %q", loaded(s), want)
+	}
+}
+
+func TestMPVBackendErrors(t *testing.T) {
+	b, s := newTestMPV(t)
+	b.Open("http://stream/one")
+	b.Play()
+	nextBackendEvent(t, b, true)
+
+	s.SendEvent(map[string]interface{}{"event": "end-file", "reason": "error", "file_error": "loading failed"})
+	if ev := nextBackendEvent(t, b, false); ev.Type != player.BackendError || ev.Err == nil {
+		t.Fatalf("event %v %v, want an error", ev.Type, ev.Err)
+	}
+	if ev := nextBackendEvent(t, b, false); ev.Type != player.BackendStopped {
+		t.Fatalf("event %v, want stopped", ev.Type)
+	}
+
+	s.FailCommand("loadfile", "loading failed")
+	b.Open("http://stream/two")
+	if err := b.Play(); err == nil {
+		t.Fatal("failed loadfile wasn't reported")
+	}
+}
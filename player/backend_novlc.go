@@ -0,0 +1,14 @@
+//go:build novlc
+// +build novlc
+
+package player
+
+import (
+	"github.com/pkg/errors"
+)
+
+// newDefaultBackend creates the backend for NewPlayer.
+// Without libvlc there is no default, the Output for a GoBackend has to be chosen by the caller.
+func newDefaultBackend() (AudioBackend, error) {
+	return nil, errors.New("tune was built without libvlc (novlc tag), use NewPlayerWithBackend")
+}
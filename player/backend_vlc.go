@@ -0,0 +1,179 @@
+//go:build !novlc
+// +build !novlc
+
+package player
+
+import (
+	"sync"
+
+	"github.com/nzlov/go-vlc"
+	"github.com/pkg/errors"
+)
+
+// VLCBackend is an AudioBackend that plays streams with libvlc.
+type VLCBackend struct {
+	instance *vlc.Instance
+	player   *vlc.Player
+
+	// volume is set from the vlc event thread as well, libvlc can only set the volume while there is audio output
+	volumeLock sync.Mutex
+	volume     int
+
+	chEvents chan BackendEvent
+}
+
+var _ AudioBackend = (*VLCBackend)(nil)
+
+// newDefaultBackend creates the backend for NewPlayer.
+func newDefaultBackend() (AudioBackend, error) {
+	b, err := NewVLCBackend()
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// NewVLCBackend loads the vlc engine and creates a vlc player.
+func NewVLCBackend() (*VLCBackend, error) {
+	// Load the VLC engine with quit option
+	instance, err := vlc.New([]string{"-q"})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create new vlc instance")
+	}
+
+	player, err := instance.NewPlayer()
+	if err != nil {
+		instance.Release()
+		return nil, errors.Wrap(err, "failed to create new vlc player")
+	}
+
+	b := &VLCBackend{
+		instance: instance,
+		player:   player,
+		chEvents: make(chan BackendEvent, backendEventBuffer),
+	}
+
+	// get an event manager for our player.
+	evt, err := player.Events()
+	if err != nil {
+		player.Release()
+		instance.Release()
+		return nil, errors.Wrap(err, "failed to get events manager for new vlc player")
+	}
+
+	// Be notified when the player starts or stops playing.
+	evt.Attach(vlc.MediaPlayerStopped, hookVLCStopped, b)
+	evt.Attach(vlc.MediaPlayerPlaying, hookVLCPlaying, b)
+	evt.Attach(vlc.MediaPlayerTitleChanged, hookVLCTitleChanged, b)
+	evt.Attach(vlc.MediaPlayerEncounteredError, hookVLCEncounteredError, b)
+
+	return b, nil
+}
+
+// Open creates a new media item from the url and sets it on the vlc player.
+func (b *VLCBackend) Open(url string) error {
+	media, err := b.instance.OpenMediaUri(url)
+	if err != nil {
+		return errors.Wrap(err, "failed to open media uri")
+	}
+	defer media.Release()
+
+	if b.player.IsPlaying() {
+		err = b.player.Stop()
+		if err != nil {
+			return errors.Wrap(err, "failed to stop vlc player before setting new media")
+		}
+	}
+
+	err = b.player.SetMedia(media)
+	if err != nil {
+		return errors.Wrap(err, "failed to set media in player")
+	}
+	return nil
+}
+
+// Play starts the vlc player.
+func (b *VLCBackend) Play() error {
+	return b.player.Play()
+}
+
+// Stop stops the vlc player.
+func (b *VLCBackend) Stop() error {
+	return b.player.Stop()
+}
+
+// IsPlaying returns true when the vlc player is playing.
+func (b *VLCBackend) IsPlaying() bool {
+	return b.player.IsPlaying()
+}
+
+// SetVolume sets the volume, it is applied when the vlc player is playing or starts playing.
+func (b *VLCBackend) SetVolume(volume int) error {
+	b.volumeLock.Lock()
+	b.volume = volume
+	b.volumeLock.Unlock()
+	if !b.player.IsPlaying() {
+		return nil
+	}
+	return b.refreshVolume()
+}
+
+func (b *VLCBackend) refreshVolume() error {
+	b.volumeLock.Lock()
+	defer b.volumeLock.Unlock()
+	err := b.player.SetVolume(b.volume)
+	if err != nil {
+		return errors.Wrap(err, "failed to change volume")
+	}
+	return nil
+}
+
+// Events returns the channel with events from the vlc player.
+func (b *VLCBackend) Events() <-chan BackendEvent {
+	return b.chEvents
+}
+
+// Close stops and releases the vlc player and engine.
+func (b *VLCBackend) Close() error {
+	b.player.Stop()
+	b.player.Release()
+	return b.instance.Release()
+}
+
+// send sends an event without blocking the vlc event thread.
+func (b *VLCBackend) send(ev BackendEvent) {
+	select {
+	case b.chEvents <- ev:
+	default:
+	}
+}
+
+// vlcBackend returns the backend that was attached to a vlc event.
+func vlcBackend(data interface{}) *VLCBackend {
+	b, ok := data.(*VLCBackend)
+	if !ok {
+		panic("expected data to be *VLCBackend")
+	}
+	return b
+}
+
+var hookVLCStopped = func(evt *vlc.Event, data interface{}) {
+	vlcBackend(data).send(BackendEvent{Type: BackendStopped})
+}
+
+var hookVLCPlaying = func(evt *vlc.Event, data interface{}) {
+	b := vlcBackend(data)
+	err := b.refreshVolume()
+	if err != nil {
+		b.send(BackendEvent{Type: BackendError, Err: err})
+	}
+	b.send(BackendEvent{Type: BackendPlaying})
+}
+
+var hookVLCTitleChanged = func(evt *vlc.Event, data interface{}) {
+	vlcBackend(data).send(BackendEvent{Type: BackendMetadata})
+}
+
+var hookVLCEncounteredError = func(evt *vlc.Event, data interface{}) {
+	vlcBackend(data).send(BackendEvent{Type: BackendError, Err: errors.New("vlc encountered an error during playback")})
+}
@@ -0,0 +1,123 @@
+package player
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/GeertJohan/tune/api"
+)
+
+// attemptGate lets the connection attempts open the backend one at a time, and only the current attempt.
+type attemptGate struct {
+	lock    sync.Mutex
+	current int64 // accessed atomically, 0 when no attempt may open the backend
+}
+
+// setCurrent sets the attempt that may open the backend, 0 for none.
+func (g *attemptGate) setCurrent(id int) {
+	atomic.StoreInt64(&g.current, int64(id))
+}
+
+// wait waits until no attempt is opening the backend.
+func (g *attemptGate) wait() {
+	g.lock.Lock()
+	g.lock.Unlock()
+}
+
+// connectAttempt opens a stream in the backend outside of the run loop, because fetching the stream urls and
+// connecting the timeshift buffer wait for the network. An attempt that isn't current anymore when it is ready to
+// open the backend leaves it alone.
+type connectAttempt struct {
+	id      int
+	backend AudioBackend
+	gate    *attemptGate
+
+	// the stream of channel at streamIndex is opened, the stream urls are fetched when there are none
+	channel     *api.Channel
+	account     *api.Account
+	client      *http.Client
+	streamURLs  []string
+	streamIndex int
+	timeshift   timeshiftConfig
+
+	// the timeshift buffer that is played from its playhead instead, when resuming
+	resume *timeshift
+
+	// results
+	fetched bool       // streamURLs were fetched
+	ts      *timeshift // the new timeshift buffer, nil without timeshift or when the attempt failed
+	opened  bool       // the backend was opened
+	err     error
+}
+
+// run makes the attempt and hands it to the run loop, the timeshift buffer is closed when the Player was closed.
+func (a *connectAttempt) run(chConnected chan<- *connectAttempt, chClosing <-chan struct{}) {
+	a.err = a.connect()
+	select {
+	case chConnected <- a:
+	case <-chClosing:
+		if a.ts != nil {
+			a.ts.Close()
+		}
+	}
+}
+
+func (a *connectAttempt) connect() error {
+	url, err := a.url()
+	if err != nil {
+		return err
+	}
+	a.gate.lock.Lock()
+	if atomic.LoadInt64(&a.gate.current) == int64(a.id) {
+		a.opened = true
+		err = a.backend.Open(url)
+		if err == nil {
+			err = a.backend.Play()
+		}
+	}
+	a.gate.lock.Unlock()
+	if err != nil {
+		if a.ts != nil {
+			a.ts.Close()
+			a.ts = nil
+		}
+		if a.resume != nil {
+			return errors.Wrap(err, "failed to play timeshift stream")
+		}
+		return errors.Wrap(err, "failed to play stream")
+	}
+	return nil
+}
+
+// url returns the url to open in the backend, which is the timeshift buffer when there is one.
+func (a *connectAttempt) url() (string, error) {
+	if a.resume != nil {
+		return a.resume.URL(), nil
+	}
+	if len(a.streamURLs) == 0 {
+		streamURLs, err := a.channel.StreamURLs(a.account)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to get stream urls")
+		}
+		if len(streamURLs) == 0 {
+			return "", errors.New("channel has no streams")
+		}
+		a.streamURLs = streamURLs
+		a.streamIndex = 0
+		a.fetched = true
+	}
+
+	url := a.streamURLs[a.streamIndex]
+	if a.timeshift.duration > 0 {
+		ts, err := newTimeshift(a.client, url, a.timeshift.duration, a.timeshift.dir)
+		if err != nil {
+			return "", err
+		}
+		a.ts = ts
+		url = ts.URL()
+	}
+	return url, nil
+}
@@ -0,0 +1,89 @@
+package player
+
+import (
+	"io"
+	"mime"
+	"strings"
+	"sync"
+
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/pkg/errors"
+)
+
+// Format describes PCM audio: interleaved signed 16-bit little-endian samples.
+type Format struct {
+	SampleRate int
+	Channels   int
+}
+
+// bytesPerFrame returns the size of one sample for all channels.
+func (f Format) bytesPerFrame() int {
+	return f.Channels * 2
+}
+
+// Decoder decodes a compressed audio stream to PCM.
+type Decoder interface {
+	// Format returns the format of the decoded audio.
+	Format() Format
+
+	// Read reads decoded PCM, it returns whole frames only.
+	Read(pcm []byte) (int, error)
+}
+
+// DecoderFunc creates a Decoder that reads a compressed stream from r.
+type DecoderFunc func(r io.Reader) (Decoder, error)
+
+// ErrUnsupportedEncoding is returned when there is no Decoder for the content type of a stream.
+var ErrUnsupportedEncoding = errors.New("unsupported stream encoding")
+
+var (
+	decodersLock sync.RWMutex
+	decoders     = map[string]DecoderFunc{
+		"audio/mpeg": newMP3Decoder,
+		"audio/mp3":  newMP3Decoder,
+		"audio/aac":  newAACDecoder,
+		"audio/aacp": newAACDecoder,
+	}
+)
+
+// RegisterDecoder registers a decoder for a content type, such as audio/ogg, or replaces the decoder for a content type.
+func RegisterDecoder(contentType string, fn DecoderFunc) {
+	decodersLock.Lock()
+	defer decodersLock.Unlock()
+	decoders[contentType] = fn
+}
+
+// NewDecoder creates a Decoder for a stream with given content type.
+func NewDecoder(contentType string, r io.Reader) (Decoder, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(contentType)
+	}
+	decodersLock.RLock()
+	fn, ok := decoders[mediaType]
+	decodersLock.RUnlock()
+	if !ok {
+		return nil, errors.Wrapf(ErrUnsupportedEncoding, "no decoder for %q", contentType)
+	}
+	return fn(r)
+}
+
+// mp3Decoder decodes MP3 with go-mp3, which always decodes to stereo.
+type mp3Decoder struct {
+	*mp3.Decoder
+}
+
+func newMP3Decoder(r io.Reader) (Decoder, error) {
+	d, err := mp3.NewDecoder(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create mp3 decoder")
+	}
+	return mp3Decoder{d}, nil
+}
+
+func (d mp3Decoder) Format() Format {
+	return Format{
+		SampleRate: d.SampleRate(),
+		Channels:   2,
+	}
+}
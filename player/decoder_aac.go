@@ -0,0 +1,134 @@
+package player
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+	"github.com/skrashevich/go-aac/pkg/adts"
+	aac "github.com/skrashevich/go-aac/pkg/decoder"
+)
+
+const (
+	// adtsHeaderSize is the size of an ADTS header without CRC.
+	adtsHeaderSize = 7
+
+	// aacMaxFailures is how many frames in a row may fail to decode before the stream is considered broken.
+	aacMaxFailures = 32
+)
+
+// aacDecoder decodes AAC-LC in ADTS frames, as sent by AAC streams, with go-aac.
+// HE-AAC streams (audio/aacp) are decoded without SBR and PS, at the sample rate of their AAC-LC core.
+type aacDecoder struct {
+	r      *bufio.Reader
+	dec    *aac.Decoder
+	format Format
+
+	frame []byte
+	pcm   []byte // decoded audio that wasn't read yet
+}
+
+func newAACDecoder(r io.Reader) (Decoder, error) {
+	d := &aacDecoder{
+		r:   bufio.NewReader(r),
+		dec: aac.New(),
+	}
+	// the format is known once the first frame is decoded
+	err := d.decode()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create aac decoder")
+	}
+	return d, nil
+}
+
+func (d *aacDecoder) Format() Format {
+	return d.format
+}
+
+func (d *aacDecoder) Read(pcm []byte) (int, error) {
+	if len(d.pcm) == 0 {
+		err := d.decode()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(pcm[:len(pcm)-len(pcm)%d.format.bytesPerFrame()], d.pcm)
+	d.pcm = d.pcm[n:]
+	return n, nil
+}
+
+// decode decodes the next frame into d.pcm, frames that fail to decode are skipped.
+func (d *aacDecoder) decode() error {
+	var err error
+	for failures := 0; failures < aacMaxFailures; failures++ {
+		err = d.readFrame()
+		if err != nil {
+			return err
+		}
+		var samples []float32
+		samples, err = d.dec.DecodeFrame(d.frame)
+		if err != nil || len(samples) == 0 {
+			continue
+		}
+		channels := len(samples) / d.dec.Config.FrameLength
+		if d.format.SampleRate == 0 {
+			d.format = Format{SampleRate: d.dec.Config.SampleRate, Channels: channels}
+		} else if channels != d.format.Channels || d.dec.Config.SampleRate != d.format.SampleRate {
+			return errors.New("aac stream changed format")
+		}
+		d.pcm = d.pcm[:0]
+		for _, sample := range samples {
+			d.pcm = binary.LittleEndian.AppendUint16(d.pcm, uint16(pcmSample(sample)))
+		}
+		return nil
+	}
+	if err == nil {
+		err = errors.New("no audio in frames")
+	}
+	return errors.Wrap(err, "failed to decode aac frames")
+}
+
+// readFrame reads the next ADTS frame into d.frame, bytes before the syncword are skipped.
+func (d *aacDecoder) readFrame() error {
+	for {
+		header, err := d.r.Peek(adtsHeaderSize)
+		if err == io.EOF && len(header) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		if header[0] != 0xff || header[1]&0xf6 != 0xf0 {
+			d.r.Discard(1)
+			continue
+		}
+		h, err := adts.ReadHeaderFromBytes(header)
+		if err != nil || h.FrameLength <= adtsHeaderSize {
+			d.r.Discard(1)
+			continue
+		}
+		if cap(d.frame) < h.FrameLength {
+			d.frame = make([]byte, h.FrameLength)
+		}
+		d.frame = d.frame[:h.FrameLength]
+		_, err = io.ReadFull(d.r, d.frame)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+}
+
+// pcmSample converts a sample between -1 and 1 to 16 bits, louder samples are clipped.
+func pcmSample(sample float32) int16 {
+	s := math.Round(float64(sample) * 32768)
+	if s > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if s < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(s)
+}
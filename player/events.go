@@ -0,0 +1,179 @@
+package player
+
+import (
+	"sync"
+	"time"
+
+	"github.com/GeertJohan/tune/api"
+)
+
+// State is the playback state of a Player.
+type State int
+
+const (
+	// StateIdle is the state before a channel was set.
+	StateIdle State = iota
+	// StateConnecting is the state while the stream of the channel is looked up and opened.
+	StateConnecting
+	// StateBuffering is the state after the stream was opened, until audio is played.
+	StateBuffering
+	// StatePlaying is the state while audio is played.
+	StatePlaying
+	// StatePaused is the state after playback was paused, the timeshift buffer keeps recording the stream.
+	StatePaused
+	// StateStopped is the state after playback was stopped on request.
+	StateStopped
+	// StateReconnecting is the state while waiting to retry a stream that failed or ended.
+	StateReconnecting
+	// StateError is the state after playback failed and was given up.
+	StateError
+)
+
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateConnecting:
+		return "connecting"
+	case StateBuffering:
+		return "buffering"
+	case StatePlaying:
+		return "playing"
+	case StatePaused:
+		return "paused"
+	case StateStopped:
+		return "stopped"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// active returns true for the states in which the Player wants to play.
+func (s State) active() bool {
+	switch s {
+	case StateConnecting, StateBuffering, StatePlaying, StateReconnecting:
+		return true
+	}
+	return false
+}
+
+// EventType is the type of an Event.
+type EventType int
+
+const (
+	// EventStateChanged is sent when the Player changed state.
+	EventStateChanged EventType = iota
+	// EventTitleChanged is sent when the stream reports a new title.
+	EventTitleChanged
+	// EventTrackChanged is sent when the stream title was matched to a track in the track history.
+	EventTrackChanged
+	// EventVolumeChanged is sent when the volume changed.
+	EventVolumeChanged
+	// EventError is sent for errors that don't change the state, and before a change to StateReconnecting or StateError.
+	EventError
+	// EventSleepChanged is sent when the sleep timer was set, cancelled or has stopped playback.
+	EventSleepChanged
+)
+
+// Event is sent to the subscribers of a Player.
+type Event struct {
+	Type EventType
+
+	// State is the state of the Player after the event.
+	State State
+
+	// Channel is the current channel, nil when no channel was set.
+	Channel *api.Channel
+
+	// Title is the stream title, it is empty when the backend doesn't know it.
+	Title string
+
+	// Track is the track from the track history that matches Title, nil until it was matched.
+	Track *api.Track
+
+	// Behind is how far playback is behind the live stream, it is 0 without timeshift.
+	Behind time.Duration
+
+	// SleepAt is when the sleep timer stops playback, it is the zero time when no sleep timer is set.
+	SleepAt time.Time
+
+	// Volume is the volume for EventVolumeChanged.
+	Volume int
+
+	// Err is the error for EventError.
+	Err error
+}
+
+// Subscription receives the events of a Player, see Player.Subscribe.
+type Subscription struct {
+	player *Player
+
+	chIn      chan Event
+	chOut     chan Event
+	chClose   chan struct{}
+	closeOnce sync.Once
+}
+
+func newSubscription(p *Player) *Subscription {
+	s := &Subscription{
+		player:  p,
+		chIn:    make(chan Event),
+		chOut:   make(chan Event),
+		chClose: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// run queues the events from the Player until they are received, so the Player never waits for a subscriber.
+// When the Player closes chIn, the queued events are delivered before Events is closed.
+func (s *Subscription) run() {
+	defer close(s.chOut)
+
+	var queue []Event
+	in := s.chIn
+	for {
+		var out chan Event
+		var next Event
+		if len(queue) > 0 {
+			out = s.chOut
+			next = queue[0]
+		} else if in == nil {
+			return
+		}
+
+		select {
+		case ev, ok := <-in:
+			if !ok {
+				in = nil
+				break
+			}
+			queue = append(queue, ev)
+		case out <- next:
+			queue[0] = Event{}
+			queue = queue[1:]
+		case <-s.chClose:
+			return
+		}
+	}
+}
+
+// Events returns the channel with the events, in the order they happened.
+// The channel is closed after Close, or after the Player was closed and all events were received.
+func (s *Subscription) Events() <-chan Event {
+	return s.chOut
+}
+
+// Close stops the subscription, events that weren't received yet are dropped.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		select {
+		case s.player.chUnsubscribe <- s:
+		case <-s.player.chClosed:
+		}
+		close(s.chClose)
+	})
+}
@@ -0,0 +1,172 @@
+package player
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/GeertJohan/tune/clock"
+)
+
+// fadeInterval is the time between the volume steps of a fade.
+const fadeInterval = 50 * time.Millisecond
+
+// Fades configures the volume fades of a Player. Fades change the volume that the Player sets on its backend,
+// so they don't depend on the backend. A zero duration disables a fade.
+type Fades struct {
+	// In fades in when playback starts or resumes.
+	In time.Duration
+
+	// Out fades out on Stop and Pause, and before another channel is opened when there is no crossfade.
+	Out time.Duration
+
+	// Cross fades from the playing channel to a new channel, the playing channel continues until the new one plays.
+	Cross time.Duration
+
+	// NewBackend creates a second backend to play the new channel during a crossfade, it is created once.
+	// There is no crossfade without it.
+	NewBackend func() (AudioBackend, error)
+}
+
+// fade changes the gain of the backend over time, and during a crossfade that of the outgoing backend.
+type fade struct {
+	start        time.Time
+	duration     time.Duration
+	from, to     float64
+	outgoingFrom float64
+	ticker       clock.Ticker
+	done         func() // called when the fade completes, not when it is cancelled
+}
+
+// startFade fades the gain of the backend to given value, and calls done when it gets there.
+func (p *Player) startFade(to float64, duration time.Duration, done func()) {
+	p.cancelFade()
+	if duration <= 0 {
+		p.gain = to
+		p.outgoingGain = 0
+		p.applyVolume()
+		if done != nil {
+			done()
+		}
+		return
+	}
+	p.fade = &fade{
+		start:        p.clk.Now(),
+		duration:     duration,
+		from:         p.gain,
+		to:           to,
+		outgoingFrom: p.outgoingGain,
+		ticker:       p.clk.NewTicker(fadeInterval),
+		done:         done,
+	}
+}
+
+// stepFade sets the gains for the current point in the fade.
+func (p *Player) stepFade() {
+	f := p.fade
+	progress := float64(p.clk.Now().Sub(f.start)) / float64(f.duration)
+	if progress > 1 {
+		progress = 1
+	}
+	p.gain = f.from + (f.to-f.from)*progress
+	p.outgoingGain = f.outgoingFrom * (1 - progress)
+	p.applyVolume()
+	if progress < 1 {
+		return
+	}
+	p.cancelFade()
+	if f.done != nil {
+		f.done()
+	}
+}
+
+func (p *Player) cancelFade() {
+	if p.fade != nil {
+		p.fade.ticker.Stop()
+		p.fade = nil
+	}
+}
+
+// fadeIn fades in the backend that just started playing, crossfading from the outgoing backend if there is one.
+func (p *Player) fadeIn() {
+	if p.outgoing != nil {
+		p.startFade(1, p.fades.Cross, p.finishCrossfade)
+		return
+	}
+	if p.gain < 1 {
+		p.startFade(1, p.fades.In, nil)
+	}
+}
+
+// fadeOut fades out when the backend can be heard and then calls done, or calls done right away.
+func (p *Player) fadeOut(audible bool, done func()) {
+	if !audible {
+		p.cancelFade()
+		done()
+		return
+	}
+	p.startFade(0, p.fades.Out, done)
+}
+
+// applyVolume sets the volume with the gains of the fades and the sleep timer applied on the backends.
+func (p *Player) applyVolume() {
+	scaled := func(gain float64) int {
+		return int(float64(p.volume)*gain*p.sleepGain + 0.5)
+	}
+	if p.backend != nil {
+		err := p.backend.SetVolume(scaled(p.gain))
+		if err != nil {
+			p.send(Event{Type: EventError, Err: err})
+		}
+	}
+	if p.outgoing != nil {
+		p.outgoing.SetVolume(scaled(p.outgoingGain))
+	}
+}
+
+// startCrossfade moves the playing backend aside to fade out, and makes the second backend play the next stream.
+// It returns false when there is no second backend.
+func (p *Player) startCrossfade() bool {
+	if p.fades.NewBackend == nil {
+		return false
+	}
+	// a crossfade that is still going on ends now
+	p.finishCrossfade()
+	if p.spare == nil {
+		backend, err := p.fades.NewBackend()
+		if err != nil {
+			p.send(Event{Type: EventError, Err: errors.Wrap(err, "failed to create backend for crossfade")})
+			return false
+		}
+		p.spare = backend
+	}
+	p.cancelFade()
+	p.outgoing, p.backend, p.spare = p.backend, p.spare, nil
+	p.outgoingGain = p.gain
+	p.outgoingTS, p.ts = p.ts, nil
+	p.gain = 0
+	return true
+}
+
+// finishCrossfade stops the outgoing backend, it becomes the second backend for the next crossfade.
+func (p *Player) finishCrossfade() {
+	if p.outgoing == nil {
+		return
+	}
+	err := p.outgoing.Stop()
+	if err != nil {
+		p.send(Event{Type: EventError, Err: err})
+	}
+	p.spare, p.outgoing = p.outgoing, nil
+	p.outgoingGain = 0
+	if p.outgoingTS != nil {
+		p.outgoingTS.Close()
+		p.outgoingTS = nil
+	}
+}
+
+// fadingOut reports whether the backend still plays a stream that fades out, after it was stopped or before the next
+// channel is connected.
+func (p *Player) fadingOut() bool {
+	return p.fade != nil && (p.state == StateConnecting || p.state == StateStopped)
+}
@@ -0,0 +1,134 @@
+package player_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GeertJohan/tune/player"
+	"github.com/GeertJohan/tune/player/playertest"
+)
+
+// eventually fails the test when cond doesn't become true in time, for changes that the Player makes on its own.
+func eventually(t *testing.T, cond func() bool, format string, args ...interface{}) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waitVolume(t *testing.T, backend *playertest.Fake, want int) {
+	t.Helper()
+	eventually(t, func() bool { return backend.Volume() == want }, "backend volume %d, want %d", backend.Volume(), want)
+}
+
+func TestFadeIn(t *testing.T) {
+	p, backend, clk, events := newTestPlayer(t)
+	p.SetVolume(80)
+	p.SetFades(player.Fades{In: time.Second})
+	p.SetChannel(newChannel(t, "one", "_a"))
+	events.waitState(player.StatePlaying)
+	clk.BlockUntil(1)
+	waitVolume(t, backend, 0)
+
+	clk.Advance(500 * time.Millisecond)
+	waitVolume(t, backend, 40)
+	clk.Advance(500 * time.Millisecond)
+	waitVolume(t, backend, 80)
+	eventually(t, func() bool { return clk.Waiters() == 0 }, "fade didn't end")
+}
+
+func TestFadeOutOnStop(t *testing.T) {
+	p, backend, clk, events := newTestPlayer(t)
+	p.SetVolume(80)
+	p.SetChannel(newChannel(t, "one", "_a"))
+	events.waitState(player.StatePlaying)
+	p.SetFades(player.Fades{Out: time.Second})
+
+	// the Player is stopped right away, the backend plays until the fade out ends
+	p.Stop()
+	events.waitState(player.StateStopped)
+	clk.BlockUntil(1)
+	clk.Advance(500 * time.Millisecond)
+	waitVolume(t, backend, 40)
+	if !backend.IsPlaying() {
+		t.Fatal("backend stopped before the fade out ended")
+	}
+	clk.Advance(500 * time.Millisecond)
+	waitVolume(t, backend, 0)
+	eventually(t, func() bool { return !backend.IsPlaying() }, "backend still playing after the fade out")
+}
+
+func TestFadeOutBeforeChannel(t *testing.T) {
+	p, backend, clk, events := newTestPlayer(t)
+	p.SetVolume(80)
+	p.SetChannel(newChannel(t, "one", "_a"))
+	events.waitState(player.StatePlaying)
+	p.SetFades(player.Fades{Out: time.Second})
+
+	// the next channel connects after the playing one faded out
+	p.SetChannel(newChannel(t, "two", "_a"))
+	events.waitState(player.StateConnecting)
+	clk.BlockUntil(1)
+	clk.Advance(900 * time.Millisecond)
+	waitVolume(t, backend, 8)
+	if url := backend.URL(); url != "http://stream/one_a" {
+		t.Fatalf("opened %q during the fade out", url)
+	}
+	clk.Advance(100 * time.Millisecond)
+	events.waitState(player.StatePlaying)
+	if url := backend.URL(); url != "http://stream/two_a" {
+		t.Fatalf("playing %q, want the next channel", url)
+	}
+	waitVolume(t, backend, 80)
+}
+
+func TestCrossfade(t *testing.T) {
+	p, first, clk, events := newTestPlayer(t)
+	second := playertest.NewFake()
+	created := 0
+	p.SetVolume(80)
+	p.SetChannel(newChannel(t, "one", "_a"))
+	events.waitState(player.StatePlaying)
+	p.SetFades(player.Fades{Cross: time.Second, NewBackend: func() (player.AudioBackend, error) {
+		created++
+		return second, nil
+	}})
+
+	// the second backend fades in the next channel while the first one fades out
+	p.SetChannel(newChannel(t, "two", "_a"))
+	events.waitState(player.StatePlaying)
+	clk.BlockUntil(1)
+	waitVolume(t, second, 0)
+	clk.Advance(250 * time.Millisecond)
+	waitVolume(t, second, 20)
+	waitVolume(t, first, 60)
+	if !first.IsPlaying() {
+		t.Fatal("first backend stopped during the crossfade")
+	}
+	clk.Advance(750 * time.Millisecond)
+	waitVolume(t, second, 80)
+	eventually(t, func() bool { return !first.IsPlaying() }, "first backend plays after the crossfade")
+
+	// the next crossfade goes back to the first backend, the volume applies to the playing backend
+	p.SetChannel(newChannel(t, "three", "_a"))
+	events.waitState(player.StatePlaying)
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	waitVolume(t, first, 80)
+	eventually(t, func() bool { return !second.IsPlaying() }, "second backend plays after the crossfade")
+	p.SetVolume(50)
+	waitVolume(t, first, 50)
+
+	want := []string{"http://stream/one_a", "http://stream/three_a"}
+	if got := first.Opened(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("first backend opened %q, want %q", got, want)
+	}
+	if created != 1 {
+		t.Fatalf("created %d second backends, want 1", created)
+	}
+}
@@ -0,0 +1,117 @@
+package player
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// ICY is the metadata protocol of Shoutcast and Icecast streams. A client that sends the Icy-MetaData request header
+// gets the interval in the icy-metaint response header, and a metadata block after every interval of audio bytes.
+// A block starts with its length in units of 16 bytes and holds fields like StreamTitle='Artist - Title';.
+const (
+	icyRequestHeader  = "Icy-MetaData"
+	icyMetaIntHeader  = "Icy-Metaint"
+	icyBlockUnit      = 16
+	icyStreamTitleKey = "StreamTitle='"
+)
+
+// RequestICYMetadata asks the stream server to send ICY metadata with the audio.
+func RequestICYMetadata(req *http.Request) {
+	req.Header.Set(icyRequestHeader, "1")
+}
+
+// ICYMetaInt returns the metadata interval from the headers of a stream response, 0 means there is no metadata.
+func ICYMetaInt(header http.Header) int {
+	metaint, err := strconv.Atoi(header.Get(icyMetaIntHeader))
+	if err != nil || metaint < 0 {
+		return 0
+	}
+	return metaint
+}
+
+// ICYReader reads the audio of a stream with ICY metadata, the metadata blocks are left out.
+type ICYReader struct {
+	r       io.Reader
+	metaint int
+	left    int // audio bytes until the next metadata block
+	onTitle func(title string)
+}
+
+// NewICYReader creates an ICYReader for a stream with a metadata block after every metaint bytes of audio.
+// onTitle is called with the StreamTitle of every metadata block that has one, also when it didn't change.
+// When metaint is 0 the stream is read as it is.
+func NewICYReader(r io.Reader, metaint int, onTitle func(title string)) *ICYReader {
+	return &ICYReader{
+		r:       r,
+		metaint: metaint,
+		left:    metaint,
+		onTitle: onTitle,
+	}
+}
+
+// Read reads audio up to the next metadata block, the block is read before the audio that follows it.
+func (r *ICYReader) Read(p []byte) (int, error) {
+	if r.metaint == 0 {
+		return r.r.Read(p)
+	}
+	if r.left == 0 {
+		err := r.readMetadata()
+		if err != nil {
+			return 0, err
+		}
+		r.left = r.metaint
+	}
+	if len(p) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.r.Read(p)
+	r.left -= n
+	return n, err
+}
+
+func (r *ICYReader) readMetadata() error {
+	var length [1]byte
+	_, err := io.ReadFull(r.r, length[:])
+	if err != nil {
+		return err
+	}
+	if length[0] == 0 {
+		return nil
+	}
+	block := make([]byte, int(length[0])*icyBlockUnit)
+	_, err = io.ReadFull(r.r, block)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return errors.Wrap(err, "failed to read icy metadata")
+	}
+	title, ok := icyStreamTitle(block)
+	if ok && r.onTitle != nil {
+		r.onTitle(title)
+	}
+	return nil
+}
+
+// icyStreamTitle returns the StreamTitle from a metadata block.
+// The title isn't escaped, so it ends at the first quote that is followed by a semicolon or the end of the block.
+func icyStreamTitle(block []byte) (string, bool) {
+	block = bytes.TrimRight(block, "\x00")
+	start := bytes.Index(block, []byte(icyStreamTitleKey))
+	if start < 0 {
+		return "", false
+	}
+	value := block[start+len(icyStreamTitleKey):]
+	end := bytes.Index(value, []byte("';"))
+	if end < 0 {
+		end = bytes.LastIndexByte(value, '\'')
+		if end < 0 {
+			return "", false
+		}
+	}
+	return string(value[:end]), true
+}
@@ -0,0 +1,140 @@
+package player_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+	"testing/iotest"
+
+	"github.com/GeertJohan/tune/player"
+)
+
+// icyBlock returns a metadata block with given content, padded to 16 bytes. An empty content gives an empty block.
+func icyBlock(content string) []byte {
+	length := (len(content) + 15) / 16
+	block := make([]byte, 1+length*16)
+	block[0] = byte(length)
+	copy(block[1:], content)
+	return block
+}
+
+// icyStream interleaves the audio with the blocks, a block after every metaint bytes of audio.
+func icyStream(audio []byte, metaint int, blocks ...[]byte) []byte {
+	var stream []byte
+	for _, block := range blocks {
+		stream = append(stream, audio[:metaint]...)
+		stream = append(stream, block...)
+		audio = audio[metaint:]
+	}
+	return append(stream, audio...)
+}
+
+func testAudio(n int) []byte {
+	audio := make([]byte, n)
+	for i := range audio {
+		audio[i] = byte(i%251) + 1 // no zero bytes, so padding can't be mistaken for audio
+	}
+	return audio
+}
+
+func TestICYReader(t *testing.T) {
+	const metaint = 32
+	audio := testAudio(5*metaint + 10)
+	stream := icyStream(audio, metaint,
+		icyBlock("StreamTitle='Artist - First';StreamUrl='';"),
+		icyBlock(""),
+		icyBlock("StreamTitle='Guns N' Roses - Sweet Child O' Mine';"),
+		icyBlock("StreamUrl='http://example.com';"),
+		icyBlock("StreamTitle='It's Not Over'"),
+	)
+	// the title of the last block ends at its last quote, as there is no semicolon
+	wantTitles := []string{"Artist - First", "Guns N' Roses - Sweet Child O' Mine", "It's Not Over"}
+
+	readers := map[string]func(io.Reader) io.Reader{
+		"whole":    func(r io.Reader) io.Reader { return r },
+		"one byte": iotest.OneByteReader,
+		"half":     iotest.HalfReader,
+		"data err": iotest.DataErrReader,
+	}
+	for name, wrap := range readers {
+		t.Run(name, func(t *testing.T) {
+			var titles []string
+			r := player.NewICYReader(wrap(bytes.NewReader(stream)), metaint, func(title string) {
+				titles = append(titles, title)
+			})
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, audio) {
+				t.Fatalf("read %d bytes of audio that differ from the %d bytes that were sent", len(got), len(audio))
+			}
+			if !reflect.DeepEqual(titles, wantTitles) {
+				t.Fatalf("titles %q, want %q", titles, wantTitles)
+			}
+		})
+	}
+}
+
+func TestICYReaderReadsUpToBlock(t *testing.T) {
+	const metaint = 8
+	audio := testAudio(2 * metaint)
+	r := player.NewICYReader(bytes.NewReader(icyStream(audio, metaint, icyBlock("StreamTitle='x';"))), metaint, nil)
+	buf := make([]byte, 100)
+	n, err := r.Read(buf)
+	if err != nil || n != metaint {
+		t.Fatalf("read %d bytes, %v, want the %d bytes before the block", n, err, metaint)
+	}
+	n, err = r.Read(buf)
+	if err != nil || !bytes.Equal(buf[:n], audio[metaint:]) {
+		t.Fatalf("read % x, %v after the block, want % x", buf[:n], err, audio[metaint:])
+	}
+}
+
+func TestICYReaderWithoutMetadata(t *testing.T) {
+	audio := testAudio(100)
+	r := player.NewICYReader(iotest.OneByteReader(bytes.NewReader(audio)), 0, func(string) {
+		t.Fatal("title without metadata")
+	})
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, audio) {
+		t.Fatalf("read %d bytes, %v, want the stream as it is", len(got), err)
+	}
+}
+
+func TestICYReaderTruncatedBlock(t *testing.T) {
+	const metaint = 8
+	stream := icyStream(testAudio(metaint), metaint, icyBlock("StreamTitle='Artist - Title';"))
+	stream = stream[:len(stream)-5]
+	r := player.NewICYReader(bytes.NewReader(stream), metaint, nil)
+	_, err := io.ReadAll(r)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("error %v, want unexpected EOF", err)
+	}
+}
+
+func TestICYMetaInt(t *testing.T) {
+	for value, want := range map[string]int{
+		"":      0,
+		"16000": 16000,
+		"-1":    0,
+		"many":  0,
+	} {
+		header := http.Header{}
+		if value != "" {
+			header.Set("icy-metaint", value)
+		}
+		if got := player.ICYMetaInt(header); got != want {
+			t.Errorf("metaint %d for %q, want %d", got, value, want)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "http://stream/", nil)
+	player.RequestICYMetadata(req)
+	if req.Header.Get("Icy-MetaData") != "1" {
+		t.Fatalf("request headers %v", req.Header)
+	}
+}
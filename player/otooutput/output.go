@@ -0,0 +1,66 @@
+// Package otooutput provides a player.Output that plays audio on the sound card with oto.
+// It's a separate package so the player package doesn't depend on the platform audio libraries.
+package otooutput
+
+import (
+	"github.com/hajimehoshi/oto"
+	"github.com/pkg/errors"
+
+	"github.com/GeertJohan/tune/player"
+)
+
+// bufferSize is the size of the audio buffer in bytes, about 200ms of 44.1kHz stereo.
+const bufferSize = 32768
+
+// Output plays audio on the default sound card.
+// oto allows one context per process, so the format of the first stream is used for all streams.
+type Output struct {
+	context *oto.Context
+	player  *oto.Player
+	format  player.Format
+}
+
+var _ player.Output = (*Output)(nil)
+
+// New creates a new Output, the sound card is opened with the first stream.
+func New() *Output {
+	return &Output{}
+}
+
+// Open opens the sound card for the first stream, and checks the format for later streams.
+func (o *Output) Open(format player.Format) error {
+	if o.context != nil {
+		if format != o.format {
+			return player.ErrFormatChanged
+		}
+		return nil
+	}
+	context, err := oto.NewContext(format.SampleRate, format.Channels, 2, bufferSize)
+	if err != nil {
+		return errors.Wrap(err, "failed to open sound card")
+	}
+	o.context = context
+	o.player = context.NewPlayer()
+	o.format = format
+	return nil
+}
+
+// Write plays the audio, it blocks until the audio fits in the buffer.
+func (o *Output) Write(pcm []byte) (int, error) {
+	if o.player == nil {
+		return 0, errors.New("oto output is not open")
+	}
+	return o.player.Write(pcm)
+}
+
+// Close closes the sound card.
+func (o *Output) Close() error {
+	if o.context == nil {
+		return nil
+	}
+	o.player.Close()
+	err := o.context.Close()
+	o.context = nil
+	o.player = nil
+	return err
+}
@@ -0,0 +1,139 @@
+package player
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Output receives the decoded audio from a GoBackend.
+type Output interface {
+	// Open prepares the output for audio in given format, it is called before every stream.
+	Open(format Format) error
+
+	// Write writes PCM in the format given to Open. Outputs that play the audio block until it fits in their buffer.
+	Write(pcm []byte) (int, error)
+
+	// Close closes the output, it can't be used afterwards.
+	Close() error
+}
+
+// ErrFormatChanged is returned by outputs that can't change format after the first stream.
+var ErrFormatChanged = errors.New("output can't change audio format")
+
+// NullOutput is an Output that discards all audio.
+type NullOutput struct{}
+
+var _ Output = NullOutput{}
+
+// Open does nothing.
+func (NullOutput) Open(format Format) error { return nil }
+
+// Write discards the audio.
+func (NullOutput) Write(pcm []byte) (int, error) { return len(pcm), nil }
+
+// Close does nothing.
+func (NullOutput) Close() error { return nil }
+
+// wavHeaderSize is the size of the RIFF header, the fmt chunk and the data chunk header.
+const wavHeaderSize = 44
+
+// WAVOutput is an Output that writes all audio to a WAV file.
+// All streams are appended to the same file, so they must have the same format.
+type WAVOutput struct {
+	path   string
+	file   *os.File
+	format Format
+	size   int64
+}
+
+var _ Output = (*WAVOutput)(nil)
+
+// NewWAVOutput creates a WAVOutput, the file is created when the first stream is opened.
+func NewWAVOutput(path string) *WAVOutput {
+	return &WAVOutput{
+		path: path,
+	}
+}
+
+// Open creates the file for the first stream, and checks the format for later streams.
+func (w *WAVOutput) Open(format Format) error {
+	if w.file != nil {
+		if format != w.format {
+			return ErrFormatChanged
+		}
+		return nil
+	}
+	file, err := os.Create(w.path)
+	if err != nil {
+		return errors.Wrap(err, "failed to create wav file")
+	}
+	w.file = file
+	w.format = format
+	// the sizes are filled in on Close
+	return w.writeHeader()
+}
+
+// Write appends the audio to the file.
+func (w *WAVOutput) Write(pcm []byte) (int, error) {
+	if w.file == nil {
+		return 0, errors.New("wav output is not open")
+	}
+	n, err := w.file.Write(pcm)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close writes the sizes in the header and closes the file.
+func (w *WAVOutput) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	_, err := w.file.Seek(0, io.SeekStart)
+	if err == nil {
+		err = w.writeHeader()
+	}
+	closeErr := w.file.Close()
+	w.file = nil
+	if err != nil {
+		return errors.Wrap(err, "failed to write wav header")
+	}
+	return closeErr
+}
+
+// writeHeader writes a canonical 16-bit PCM WAV header for the audio written so far.
+func (w *WAVOutput) writeHeader() error {
+	blockAlign := w.format.bytesPerFrame()
+	header := struct {
+		RIFF          [4]byte
+		RIFFSize      uint32
+		WAVE          [4]byte
+		Fmt           [4]byte
+		FmtSize       uint32
+		AudioFormat   uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}{
+		RIFF:          [4]byte{'R', 'I', 'F', 'F'},
+		RIFFSize:      uint32(wavHeaderSize - 8 + w.size),
+		WAVE:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		AudioFormat:   1, // PCM
+		Channels:      uint16(w.format.Channels),
+		SampleRate:    uint32(w.format.SampleRate),
+		ByteRate:      uint32(w.format.SampleRate * blockAlign),
+		BlockAlign:    uint16(blockAlign),
+		BitsPerSample: 16,
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      uint32(w.size),
+	}
+	return binary.Write(w.file, binary.LittleEndian, &header)
+}
@@ -1,57 +1,185 @@
 package player
 
 import (
-	"fmt"
+	"net/http"
+	"time"
 
-	"github.com/nzlov/go-vlc"
 	"github.com/pkg/errors"
 
 	"github.com/GeertJohan/tune/api"
+	"github.com/GeertJohan/tune/clock"
 )
 
-// Player manages the streaming of an AudioAddict music channel
-type Player struct {
-	account *api.Account
+var (
+	// ErrNoBackend is reported when a channel is set on a Player that has no working AudioBackend.
+	ErrNoBackend = errors.New("no audio backend available")
 
-	chPlay chan struct{}
-	chStop chan struct{}
+	// ErrStreamEnded is reported when the backend stopped playing while it wasn't asked to.
+	ErrStreamEnded = errors.New("stream ended unexpectedly")
+)
 
-	chGetVolume  chan chan int
-	chSetVolume  chan int
-	chGetChannel chan chan *api.Channel
-	chSetChannel chan *api.Channel
+// reconnectDelays are the waits before each attempt to reconnect a stream that failed or ended.
+// The Player gives up and goes to StateError when all attempts have failed.
+var reconnectDelays = []time.Duration{
+	1 * time.Second,
+	2 * time.Second,
+	4 * time.Second,
+	8 * time.Second,
+	16 * time.Second,
+}
 
-	chClose  chan struct{}
-	chLock   chan struct{}
-	chUnlock chan struct{}
+// trackMatchDelays are the waits before each attempt to find a new stream title in the track history,
+// which is updated a little later than the stream.
+var trackMatchDelays = []time.Duration{
+	0,
+	5 * time.Second,
+	15 * time.Second,
+	30 * time.Second,
+}
 
-	volume     int
-	curChannel *api.Channel
+// trackMatch is the result of matching a stream title to the track history.
+type trackMatch struct {
+	channel *api.Channel
+	title   string
+	track   *api.Track
+}
 
-	vlcInstance *vlc.Instance
-	vlcPlayer   *vlc.Player
+// Player manages the streaming of an AudioAddict music channel.
+// All commands and backend events are handled by one loop, which moves the Player through its States.
+// Any number of listeners can follow the Player with Subscribe.
+type Player struct {
+	account *api.Account
+	client  *http.Client // connects to the streams for the timeshift buffer
+
+	backend    AudioBackend
+	backendErr error
+	gate       attemptGate // shared with the connection attempts
+
+	chGetVolume   chan chan int
+	chSetVolume   chan int
+	chGetChannel  chan chan *api.Channel
+	chSetChannel  chan *api.Channel
+	chGetState    chan chan State
+	chPlayStop    chan chan bool
+	chPlay        chan chan bool
+	chStop        chan struct{}
+	chPause       chan chan bool
+	chSeek        chan seekRequest
+	chTimeshift   chan timeshiftConfig
+	chFades       chan Fades
+	chSleep       chan sleepTimer
+	chClock       chan clock.Interface
+	chSubscribe   chan *Subscription
+	chUnsubscribe chan *Subscription
+	chTrackMatch  chan trackMatch
+	chConnected   chan *connectAttempt
+	chTap         chan tapRequest
+
+	chClose   chan struct{}
+	chClosing chan struct{} // closed when run starts closing, connection attempts stop waiting for it
+	chClosed  chan struct{}
+
+	// owned by run
+	clk          clock.Interface
+	state        State
+	volume       int
+	curChannel   *api.Channel
+	title        string
+	track        *api.Track
+	streamURLs   []string
+	streamIndex  int
+	reconnects   int
+	reconnect    <-chan time.Time // nil when no reconnect is waiting
+	attempt      *connectAttempt  // the connection attempt that is waited for, nil when none
+	attempts     int              // the number of connection attempts that were started
+	subscribers  []*Subscription
+	timeshift    timeshiftConfig
+	ts           *timeshift // nil without timeshift
+	fades        Fades
+	gain         float64 // the part of the volume that is heard, fades change it
+	fade         *fade   // nil when no fade is going on
+	outgoing     AudioBackend
+	outgoingGain float64
+	outgoingTS   *timeshift
+	spare        AudioBackend // the backend that is not used until the next crossfade
+	sleep        *sleepTimer  // nil when no sleep timer is set
+	sleepGain    float64      // the part of the volume that is left by the sleep timer
+}
 
-	playerStoppedHandler      func()
-	playerPlayingHandler      func()
-	playerTitleChangedHandler func()
-	errorHandler              func(error)
+// timeshiftConfig is the timeshift buffer for the next stream.
+type timeshiftConfig struct {
+	duration time.Duration
+	dir      string
 }
 
-// NewPlayer creates a new Player instance.
-func NewPlayer(account *api.Account) *Player {
-	p := &Player{
-		account: account,
+// seekRequest moves the timeshift playhead by offset, or to the live stream.
+type seekRequest struct {
+	offset time.Duration
+	live   bool
+	retCh  chan seekResult
+}
 
-		chGetVolume:  make(chan chan int),
-		chSetVolume:  make(chan int),
-		chGetChannel: make(chan chan *api.Channel),
-		chSetChannel: make(chan *api.Channel),
+type seekResult struct {
+	behind time.Duration
+	err    error
+}
 
-		chClose:  make(chan struct{}),
-		chLock:   make(chan struct{}),
-		chUnlock: make(chan struct{}),
+// NewPlayer creates a new Player instance that plays with libvlc.
+// When libvlc can't be loaded, or tune was built with the novlc tag, the error is reported when a channel is set.
+func NewPlayer(account *api.Account) *Player {
+	backend, err := newDefaultBackend()
+	if err != nil {
+		return newPlayer(account, nil, err)
 	}
+	return newPlayer(account, backend, nil)
+}
+
+// NewDefaultBackend creates the backend that NewPlayer plays with, e.g. as a second backend for crossfades.
+func NewDefaultBackend() (AudioBackend, error) {
+	return newDefaultBackend()
+}
 
+// NewPlayerWithBackend creates a new Player instance that plays with given backend.
+// The Player owns the backend and closes it on Close.
+func NewPlayerWithBackend(account *api.Account, backend AudioBackend) *Player {
+	return newPlayer(account, backend, ErrNoBackend)
+}
+
+func newPlayer(account *api.Account, backend AudioBackend, backendErr error) *Player {
+	p := &Player{
+		account:    account,
+		client:     streamClient,
+		backend:    backend,
+		backendErr: backendErr,
+
+		chGetVolume:   make(chan chan int),
+		chSetVolume:   make(chan int),
+		chGetChannel:  make(chan chan *api.Channel),
+		chSetChannel:  make(chan *api.Channel),
+		chGetState:    make(chan chan State),
+		chPlayStop:    make(chan chan bool),
+		chPlay:        make(chan chan bool),
+		chStop:        make(chan struct{}),
+		chPause:       make(chan chan bool),
+		chSeek:        make(chan seekRequest),
+		chTimeshift:   make(chan timeshiftConfig),
+		chFades:       make(chan Fades),
+		chSleep:       make(chan sleepTimer),
+		chClock:       make(chan clock.Interface),
+		chSubscribe:   make(chan *Subscription),
+		chUnsubscribe: make(chan *Subscription),
+		chTrackMatch:  make(chan trackMatch),
+		chConnected:   make(chan *connectAttempt),
+		chTap:         make(chan tapRequest),
+
+		chClose:   make(chan struct{}),
+		chClosing: make(chan struct{}),
+		chClosed:  make(chan struct{}),
+
+		clk:       clock.Real,
+		gain:      1,
+		sleepGain: 1,
+	}
 	go p.run()
 
 	return p
@@ -59,234 +187,579 @@ func NewPlayer(account *api.Account) *Player {
 
 // run manages the lifecycle of a Player in a thread-safe way.
 func (p *Player) run() {
-	var err error
+	defer close(p.chClosed)
 
-	// Load the VLC engine with quit option
-	p.vlcInstance, err = vlc.New([]string{"-q"})
-	if err != nil {
-		p.handleError(errors.Wrap(err, "failed to create new vlc instance"))
-		return
-	}
-	defer p.vlcInstance.Release()
-
-	p.vlcPlayer, err = p.vlcInstance.NewPlayer()
-	if err != nil {
-		p.handleError(errors.Wrap(err, "failed to create new vlc player"))
-		return
-	}
-
-	// set saved volume
-	err = p.vlcPlayer.SetVolume(p.volume)
-	if err != nil {
-		p.handleError(errors.Wrap(err, "failed to set volume on new vlc player"))
-		return
-	}
-
-	// get an event manager for our player.
-	evt, err := p.vlcPlayer.Events()
-	if err != nil {
-		p.handleError(errors.Wrap(err, "failed to get events manager for new vlc player"))
-		return
-	}
-
-	// Be notified when the player stops playing.
-	evt.Attach(vlc.MediaPlayerStopped, hookPlayerStoppedHandler, p)
-	evt.Attach(vlc.MediaPlayerPlaying, hookPlayerPlayingHandler, p)
-	evt.Attach(vlc.MediaPlayerTitleChanged, hookPlayerTitleChangedHandler, p)
-
-controlloop:
 	for {
+		// a crossfade swaps the backends
+		// the events of the backend wait while a connection attempt opens it, like they would for a blocking open
+		var backendEvents, outgoingEvents, spareEvents <-chan BackendEvent
+		if p.backend != nil && p.attempt == nil {
+			backendEvents = p.backend.Events()
+		}
+		if p.outgoing != nil {
+			outgoingEvents = p.outgoing.Events()
+		}
+		if p.spare != nil {
+			spareEvents = p.spare.Events()
+		}
+		var timeshiftTitle <-chan struct{}
+		if p.ts != nil {
+			timeshiftTitle = p.ts.chTitle
+		}
+		var fadeStep <-chan time.Time
+		if p.fade != nil {
+			fadeStep = p.fade.ticker.C()
+		}
+		var sleepStep <-chan time.Time
+		if p.sleep != nil {
+			sleepStep = p.sleep.ticker.C()
+		}
+
 		select {
 		case retCh := <-p.chGetVolume:
-			if p.vlcPlayer == nil {
-				retCh <- -1
-				break
-			}
-			volume, err := p.vlcPlayer.Volume()
-			if err != nil {
-				p.handleError(errors.Wrap(err, "failed to get current volume from vlc player"))
-				retCh <- -1
-				break
-			}
-			retCh <- volume
+			retCh <- p.volume
 
 		case volume := <-p.chSetVolume:
-			p.volume = volume
-			if p.vlcPlayer == nil || !p.vlcPlayer.IsPlaying() {
-				break
-			}
-			p.refreshVolume()
+			p.setVolume(volume)
 
 		case retCh := <-p.chGetChannel:
 			retCh <- p.curChannel
 
+		case retCh := <-p.chGetState:
+			retCh <- p.state
+
 		case ch := <-p.chSetChannel:
-			// set current channel
+			// the backend replaces the current stream when the new one is opened
+			p.cancelReconnect()
+			p.reconnects = 0
+			playing := p.state == StatePlaying
 			p.curChannel = ch
-
-			streamURLs, err := ch.StreamURLs(p.account)
-			if err != nil {
-				p.handleError(fmt.Errorf("ch.StreamURLs(): %v", err))
-				break
+			p.title = ""
+			p.track = nil
+			p.streamURLs = nil
+			switch {
+			case playing && p.fades.Cross > 0 && p.startCrossfade():
+				p.connect()
+			case playing && p.fades.Out > 0:
+				p.setState(StateConnecting)
+				p.startFade(0, p.fades.Out, p.connect)
+			default:
+				p.connect()
 			}
 
-			// Create a new media item from an url.
-			media, err := p.vlcInstance.OpenMediaUri(streamURLs[0])
-			if err != nil {
-				p.handleError(fmt.Errorf("OpenMediaUri(): %v", err))
-				break
+		case retCh := <-p.chPlayStop:
+			switch {
+			case p.state.active() && p.ts != nil:
+				p.pause()
+			case p.state.active():
+				p.stop()
+			default:
+				p.play()
 			}
+			retCh <- p.state.active()
 
-			if p.vlcPlayer.IsPlaying() {
-				err = p.vlcPlayer.Stop()
-				if err != nil {
-					p.handleError(errors.Wrap(err, "failed to stop vlc player before setting new media"))
-					break
-				}
+		case retCh := <-p.chPause:
+			retCh <- p.pause()
+
+		case req := <-p.chSeek:
+			behind, err := p.seek(req)
+			req.retCh <- seekResult{behind: behind, err: err}
+
+		case cfg := <-p.chTimeshift:
+			p.timeshift = cfg
+
+		case req := <-p.chTap:
+			var tap *StreamTap
+			if p.ts != nil && p.curChannel == req.channel {
+				tap = p.ts.tap(req.onTitle)
 			}
+			req.retCh <- tap
 
-			err = p.vlcPlayer.SetMedia(media)
-			if err != nil {
-				p.handleError(errors.Wrap(err, "failed to set media in player"))
+		case fades := <-p.chFades:
+			p.fades = fades
+
+		case clk := <-p.chClock:
+			p.clk = clk
+
+		case <-fadeStep:
+			p.stepFade()
+
+		case t := <-p.chSleep:
+			p.setSleep(t.at, t.fadeOver)
+
+		case <-sleepStep:
+			p.stepSleep()
+
+		case <-timeshiftTitle:
+			if p.fadingOut() {
 				break
 			}
+			p.setTitle(p.ts.Title())
 
-			media.Release()
+		case retCh := <-p.chPlay:
+			p.play()
+			retCh <- p.state.active()
 
-			err = p.vlcPlayer.Play()
-			if err != nil {
-				p.handleError(errors.Wrap(err, "failed to play new media"))
+		case <-p.chStop:
+			p.stop()
+
+		case ev := <-backendEvents:
+			p.handleBackendEvent(ev)
+
+		case <-outgoingEvents:
+			// the outgoing stream is fading out, what happens to it doesn't matter anymore
+
+		case <-spareEvents:
+
+		case match := <-p.chTrackMatch:
+			if match.channel != p.curChannel || match.title != p.title {
+				break // the title changed while matching
+			}
+			p.track = match.track
+			p.send(Event{Type: EventTrackChanged})
+
+		case <-p.reconnect:
+			p.reconnect = nil
+			p.connect()
+
+		case a := <-p.chConnected:
+			p.connected(a)
+
+		case s := <-p.chSubscribe:
+			p.subscribers = append(p.subscribers, s)
+			s.chIn <- p.event(Event{Type: EventStateChanged})
+
+		case s := <-p.chUnsubscribe:
+			for i, sub := range p.subscribers {
+				if sub == s {
+					p.subscribers = append(p.subscribers[:i], p.subscribers[i+1:]...)
+					break
+				}
 			}
+
 		case <-p.chClose:
-			if p.vlcPlayer != nil {
-				p.vlcPlayer.Stop()
-				p.vlcPlayer.Release()
+			p.cancelReconnect()
+			close(p.chClosing)
+			p.gate.wait() // the backend is closed below
+			p.cancelFade()
+			if p.sleep != nil {
+				p.sleep.ticker.Stop()
 			}
-			break controlloop
-		case <-p.chLock:
-			<-p.chUnlock
+			p.finishCrossfade()
+			p.closeTimeshift()
+			if p.backend != nil {
+				p.backend.Close()
+			}
+			if p.spare != nil {
+				p.spare.Close()
+			}
+			for _, s := range p.subscribers {
+				close(s.chIn)
+			}
+			return
 		}
 	}
+}
 
+// play connects to the current channel, unless the Player is already playing or there is no channel.
+// A paused Player resumes from the timeshift buffer.
+func (p *Player) play() {
+	if p.state == StatePaused {
+		p.resume()
+		return
+	}
+	if p.state.active() || p.curChannel == nil {
+		return
+	}
+	p.connect()
+}
+
+// pause stops the backend, the timeshift buffer keeps the stream. It returns false when there is no timeshift.
+func (p *Player) pause() bool {
+	if p.state == StatePaused {
+		return true
+	}
+	if !p.state.active() {
+		return false
+	}
+	if p.ts == nil {
+		p.send(Event{Type: EventError, Err: ErrNoTimeshift})
+		return false
+	}
+	p.cancelReconnect()
+	playing := p.state == StatePlaying
+	p.setState(StatePaused)
+	ts := p.ts
+	p.fadeOut(playing, func() {
+		err := p.backend.Stop()
+		if err != nil {
+			p.send(Event{Type: EventError, Err: err})
+		}
+		// the backend had audio buffered that wasn't heard yet
+		ts.Seek(-timeshiftBurst)
+	})
+	return true
 }
 
-// used for internal locking (obtaining ownership of the player)
-func (p *Player) lock() {
-	p.chLock <- struct{}{}
+// resume plays the timeshift buffer from the playhead. The backend connects again, so buffered audio from before
+// a seek is dropped.
+func (p *Player) resume() {
+	p.startAttempt(&connectAttempt{resume: p.ts})
 }
-func (p *Player) unlock() {
-	p.chUnlock <- struct{}{}
+
+// seek moves the timeshift playhead, playback continues from there.
+func (p *Player) seek(req seekRequest) (time.Duration, error) {
+	if p.ts == nil {
+		return 0, ErrNoTimeshift
+	}
+	offset := req.offset
+	if req.live {
+		offset = p.ts.Behind()
+	}
+	behind := p.ts.Seek(offset)
+	if p.state == StateBuffering || p.state == StatePlaying {
+		p.resume()
+	}
+	return behind, nil
 }
 
-// Close stops the player and closes it.
-// Player instance can never be used again after calling Close().
-func (p *Player) Close() {
-	p.chClose <- struct{}{}
+func (p *Player) closeTimeshift() {
+	if p.ts != nil {
+		p.ts.Close()
+		p.ts = nil
+	}
 }
 
-func (p *Player) SetPlayerStoppedHandler(handler func()) {
-	p.playerStoppedHandler = handler
+// connect opens a stream of the current channel in the backend and starts playback.
+// The stream urls are fetched again after all of them have been tried.
+func (p *Player) connect() {
+	if p.backend == nil {
+		p.fail(p.backendErr)
+		return
+	}
+	p.setState(StateConnecting)
+	p.closeTimeshift()
+	p.startAttempt(&connectAttempt{
+		channel:     p.curChannel,
+		account:     p.account,
+		client:      p.client,
+		streamURLs:  p.streamURLs,
+		streamIndex: p.streamIndex,
+		timeshift:   p.timeshift,
+	})
 }
 
-var hookPlayerStoppedHandler = func(evt *vlc.Event, data interface{}) {
-	p, ok := data.(*Player)
-	if !ok {
-		panic("expected data to be *Player")
+// startAttempt starts a connection attempt in the background, its result is handled by connected.
+// A fade that was going on ends, and playback starts silent when it fades in.
+func (p *Player) startAttempt(a *connectAttempt) {
+	p.cancelFade()
+	p.gain = 1
+	if p.fades.In > 0 || p.outgoing != nil {
+		p.gain = 0
 	}
-	if p.playerStoppedHandler != nil {
-		p.playerStoppedHandler()
+	if p.sleep == nil {
+		p.sleepGain = 1
 	}
+	p.applyVolume()
+
+	p.attempts++
+	a.id = p.attempts
+	a.backend = p.backend
+	a.gate = &p.gate
+	p.attempt = a
+	p.gate.setCurrent(a.id)
+	go a.run(p.chConnected, p.chClosing)
 }
 
-func (p *Player) SetPlayerPlayingHandler(handler func()) {
-	p.playerPlayingHandler = handler
+// connected handles the result of a connection attempt. The result of an attempt that was cancelled, or replaced by
+// a newer one, is dropped.
+func (p *Player) connected(a *connectAttempt) {
+	if a != p.attempt {
+		if a.ts != nil {
+			a.ts.Close()
+		}
+		if a.opened && a.id == p.attempts {
+			// playback was stopped while the backend was opened, and no other stream was opened since
+			err := a.backend.Stop()
+			if err != nil {
+				p.send(Event{Type: EventError, Err: err})
+			}
+		}
+		return
+	}
+	p.attempt = nil
+	if a.fetched {
+		p.streamURLs = a.streamURLs
+		p.streamIndex = 0
+	}
+	if a.err != nil {
+		p.retry(a.err)
+		return
+	}
+	if a.ts != nil {
+		p.ts = a.ts
+	}
+	p.setState(StateBuffering)
 }
 
-var hookPlayerPlayingHandler = func(evt *vlc.Event, data interface{}) {
-	p, ok := data.(*Player)
-	if !ok {
-		panic("expected data to be *Player")
+// retry reports err and schedules the next attempt with the next stream url, or fails when all attempts were made.
+func (p *Player) retry(err error) {
+	p.finishCrossfade()
+	if p.reconnects >= len(reconnectDelays) {
+		p.fail(err)
+		return
 	}
-	p.refreshVolume()
-	if p.playerPlayingHandler != nil {
-		p.playerPlayingHandler()
+	p.send(Event{Type: EventError, Err: err})
+
+	p.streamIndex++
+	if p.streamIndex >= len(p.streamURLs) {
+		p.streamURLs = nil
 	}
+	p.reconnect = p.clk.After(reconnectDelays[p.reconnects])
+	p.reconnects++
+	p.setState(StateReconnecting)
 }
 
-func (p *Player) SetPlayerTitleChangedHandler(handler func()) {
-	p.playerTitleChangedHandler = handler
+// fail reports err and gives up playback.
+func (p *Player) fail(err error) {
+	p.finishCrossfade()
+	p.cancelReconnect()
+	p.reconnects = 0
+	p.send(Event{Type: EventError, Err: err})
+	p.setState(StateError)
 }
 
-var hookPlayerTitleChangedHandler = func(evt *vlc.Event, data interface{}) {
-	p, ok := data.(*Player)
-	if !ok {
-		panic("expected data to be *Player")
+// stop stops playback when the Player is active or paused, the timeshift buffer is dropped after the fade out.
+func (p *Player) stop() {
+	p.cancelReconnect()
+	p.reconnects = 0
+	p.finishCrossfade()
+	if !p.state.active() && p.state != StatePaused {
+		if p.fade == nil {
+			p.closeTimeshift()
+		}
+		return
 	}
-	if p.playerTitleChangedHandler != nil {
-		p.playerTitleChangedHandler()
+	playing := p.state == StatePlaying
+	p.title = ""
+	p.track = nil
+	p.setState(StateStopped)
+	p.fadeOut(playing, func() {
+		err := p.backend.Stop()
+		if err != nil {
+			p.send(Event{Type: EventError, Err: err})
+		}
+		p.closeTimeshift()
+	})
+}
+
+// cancelReconnect cancels the reconnect that is waiting and the connection attempt that is going on.
+func (p *Player) cancelReconnect() {
+	p.reconnect = nil
+	p.attempt = nil
+	p.gate.setCurrent(0)
+}
+
+func (p *Player) setVolume(volume int) {
+	p.volume = volume
+	p.applyVolume()
+	p.send(Event{Type: EventVolumeChanged, Volume: volume})
+}
+
+// handleBackendEvent moves the Player to the state that follows from a backend event.
+// Backends may report the stop of a previous stream after a new one was opened, so a stop only counts while playing.
+func (p *Player) handleBackendEvent(ev BackendEvent) {
+	switch ev.Type {
+	case BackendPlaying:
+		if p.state == StateBuffering {
+			p.reconnects = 0
+			p.setState(StatePlaying)
+			p.fadeIn()
+		}
+	case BackendStopped:
+		if p.state == StatePlaying {
+			err := ErrStreamEnded
+			if p.ts != nil && p.ts.Err() != nil {
+				err = p.ts.Err()
+			}
+			p.retry(err)
+		}
+	case BackendError:
+		if p.state == StateBuffering || p.state == StatePlaying {
+			p.retry(ev.Err)
+			break
+		}
+		p.send(Event{Type: EventError, Err: ev.Err})
+	case BackendMetadata:
+		if p.ts != nil || p.fadingOut() {
+			break // the title follows the timeshift playhead instead, or belongs to the previous channel
+		}
+		p.setTitle(ev.Title)
 	}
 }
 
-func (p *Player) SetErrorHandler(handler func(error)) {
-	p.errorHandler = handler
+// setTitle sets the stream title, and starts looking for its track in the track history.
+func (p *Player) setTitle(title string) {
+	p.title = title
+	p.track = nil
+	p.send(Event{Type: EventTitleChanged})
+	if p.title != "" && p.curChannel != nil {
+		go p.matchTrack(p.clk, p.curChannel, p.title)
+	}
 }
-func (p *Player) handleError(err error) {
-	if p.errorHandler != nil {
-		p.errorHandler(err)
+
+// matchTrack looks up the stream title in the track history of the channel and hands the track to run.
+// It waits on clk, the clock of the run loop when the title changed.
+func (p *Player) matchTrack(clk clock.Interface, channel *api.Channel, title string) {
+	for _, delay := range trackMatchDelays {
+		select {
+		case <-clk.After(delay):
+		case <-p.chClosed:
+			return
+		}
+		track, err := channel.TrackForTitle(title)
+		if err == api.ErrNoTrackMatch {
+			continue
+		}
+		if err != nil {
+			return // the title is still shown, the track information is a bonus
+		}
+		select {
+		case p.chTrackMatch <- trackMatch{channel: channel, title: title, track: track}:
+		case <-p.chClosed:
+		}
+		return
 	}
 }
 
-// PlayStop starts the player when it was stopped, and stops the player when it was started.
-// When playback has stopped or there is no player attached, false is returned.
-// Otherwise the boolean indicates if the player playing after this call.
-func (p *Player) PlayStop() bool {
-	p.lock()
-	defer p.unlock()
-	//++ TODO: move this logic to run() and use channels for communication
-	// 			like the other methods (SetVolume, etc)
+func (p *Player) setState(state State) {
+	if p.state == state {
+		return
+	}
+	p.state = state
+	p.send(Event{Type: EventStateChanged})
+}
 
-	if p.vlcPlayer == nil {
-		return false
+// event completes ev with the current state, channel and track.
+func (p *Player) event(ev Event) Event {
+	ev.State = p.state
+	ev.Channel = p.curChannel
+	ev.Title = p.title
+	ev.Track = p.track
+	if p.ts != nil {
+		ev.Behind = p.ts.Behind()
+	}
+	if p.sleep != nil {
+		ev.SleepAt = p.sleep.at
 	}
+	return ev
+}
 
-	if p.vlcPlayer.IsPlaying() {
-		p.vlcPlayer.Stop()
-		return false
+// send sends an event to all subscribers. A subscription always accepts events, so this doesn't block.
+func (p *Player) send(ev Event) {
+	ev = p.event(ev)
+	for _, s := range p.subscribers {
+		s.chIn <- ev
 	}
-	p.vlcPlayer.Play()
-	return true
 }
 
-// Play starts the player
-func (p *Player) Play() bool {
-	p.lock()
-	defer p.unlock()
-	//++ TODO: move this logic to run() and use channels for communication
-	// 			like the other methods (SetVolume, etc)
+// Close stops the player and closes it, subscriptions end after their last event.
+// Player instance can never be used again after calling Close().
+func (p *Player) Close() {
+	p.chClose <- struct{}{}
+	<-p.chClosed
+}
 
-	if p.vlcPlayer == nil {
-		return false
+// Subscribe returns a new subscription to the events of the player, starting with an EventStateChanged for the
+// current state. Events are queued for each subscription, so a slow subscriber never holds up the player.
+func (p *Player) Subscribe() *Subscription {
+	s := newSubscription(p)
+	select {
+	case p.chSubscribe <- s:
+	case <-p.chClosed:
+		close(s.chIn)
 	}
+	return s
+}
 
-	p.vlcPlayer.Play()
-	return true
+// PlayStop starts the player when it was stopped, and stops the player when it was started.
+// With timeshift the player is paused and resumed instead.
+// The returned boolean indicates if the player is playing, or trying to, after this call.
+func (p *Player) PlayStop() bool {
+	retCh := make(chan bool)
+	p.chPlayStop <- retCh
+	return <-retCh
 }
 
-// Stop stops the player. There is no pause since we're working with streams.
+// Play starts the player, it returns false when there is no channel to play or playback failed right away.
+func (p *Player) Play() bool {
+	retCh := make(chan bool)
+	p.chPlay <- retCh
+	return <-retCh
+}
+
+// Stop stops the player and drops the timeshift buffer. Use Pause to continue from the same point later.
 func (p *Player) Stop() {
-	p.lock()
-	defer p.unlock()
-	//++ TODO: move this logic to run() and use channels for communication
-	// 			like the other methods (SetVolume, etc)
+	p.chStop <- struct{}{}
+}
 
-	if p.vlcPlayer == nil {
-		return
-	}
+// Pause pauses playback, Play continues where it was paused. The timeshift buffer keeps recording the live stream
+// in the meantime, so Pause only works when timeshift is enabled. It returns false when playback can't be paused.
+func (p *Player) Pause() bool {
+	retCh := make(chan bool)
+	p.chPause <- retCh
+	return <-retCh
+}
+
+// SetTimeshift enables the timeshift buffer for the streams that are played after this call, 0 disables it.
+// It keeps the last part of the stream of about duration, in a temporary file in dir, or in memory when dir is
+// empty. With a timeshift buffer PlayStop pauses instead of stops.
+func (p *Player) SetTimeshift(duration time.Duration, dir string) {
+	p.chTimeshift <- timeshiftConfig{duration: duration, dir: dir}
+}
 
-	p.vlcPlayer.Stop()
+// Seek moves playback in the timeshift buffer by offset, a negative offset goes back. Playback can't go beyond the
+// start of the buffer or the live stream. It returns how far playback is behind the live stream afterwards.
+func (p *Player) Seek(offset time.Duration) (time.Duration, error) {
+	retCh := make(chan seekResult)
+	p.chSeek <- seekRequest{offset: offset, retCh: retCh}
+	res := <-retCh
+	return res.behind, res.err
 }
 
-// SetChannel sets the channel on the player
+// JumpToLive moves playback in the timeshift buffer to the live stream.
+func (p *Player) JumpToLive() error {
+	retCh := make(chan seekResult)
+	p.chSeek <- seekRequest{live: true, retCh: retCh}
+	return (<-retCh).err
+}
+
+// State returns the current state of the player.
+func (p *Player) State() State {
+	retCh := make(chan State)
+	p.chGetState <- retCh
+	return <-retCh
+}
+
+// SetFades sets the fades for everything that is played after this call.
+func (p *Player) SetFades(fades Fades) {
+	p.chFades <- fades
+}
+
+// SetClock sets the clock for the reconnect delays, fades and the sleep timer that start after this call.
+// It is the local clock by default.
+func (p *Player) SetClock(clk clock.Interface) {
+	p.chClock <- clk
+}
+
+// SetSleepTimer stops playback at given time on the clock of the Player, the volume is lowered gradually over
+// fadeOver before it. The zero time cancels the sleep timer. Playback can be started again after the sleep timer
+// stopped it.
+func (p *Player) SetSleepTimer(at time.Time, fadeOver time.Duration) {
+	p.chSleep <- sleepTimer{at: at, fadeOver: fadeOver}
+}
+
+// SetChannel sets the channel on the player and starts playing it.
 func (p *Player) SetChannel(c *api.Channel) {
 	p.chSetChannel <- c
 }
@@ -312,10 +785,3 @@ func (p *Player) Volume() int {
 	volume := <-retCh
 	return volume
 }
-
-func (p *Player) refreshVolume() {
-	err := p.vlcPlayer.SetVolume(p.volume)
-	if err != nil {
-		p.handleError(errors.Wrap(err, "failed to change volume"))
-	}
-}
@@ -0,0 +1,339 @@
+package player_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GeertJohan/tune/api"
+	"github.com/GeertJohan/tune/clock/clocktest"
+	"github.com/GeertJohan/tune/player"
+	"github.com/GeertJohan/tune/player/playertest"
+)
+
+// newChannel returns a channel whose stream urls are served by a test server, they are the channel key with the
+// suffixes.
+func newChannel(t *testing.T, key string, suffixes ...string) *api.Channel {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "[")
+		for i, suffix := range suffixes {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, "%q", "http://stream/"+key+suffix)
+		}
+		fmt.Fprint(w, "]")
+	}))
+	t.Cleanup(srv.Close)
+	return &api.Channel{
+		Network:    &api.Network{ListenURLBase: srv.URL},
+		Streamlist: &api.Streamlist{Key: "mp3"},
+		Key:        key,
+	}
+}
+
+// newSlowChannel returns a channel whose stream urls are only served after release is closed.
+func newSlowChannel(t *testing.T, key string, release <-chan struct{}) *api.Channel {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprintf(w, "[%q]", "http://stream/"+key)
+	}))
+	t.Cleanup(srv.Close)
+	return &api.Channel{
+		Network:    &api.Network{ListenURLBase: srv.URL},
+		Streamlist: &api.Streamlist{Key: "mp3"},
+		Key:        key,
+	}
+}
+
+// follower reads the events of a subscription.
+type follower struct {
+	t   *testing.T
+	sub *player.Subscription
+}
+
+func follow(t *testing.T, p *player.Player) *follower {
+	f := &follower{t: t, sub: p.Subscribe()}
+	f.waitState(p.State())
+	return f
+}
+
+func (f *follower) next() player.Event {
+	f.t.Helper()
+	select {
+	case ev, ok := <-f.sub.Events():
+		if !ok {
+			f.t.Fatal("subscription ended")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		f.t.Fatal("no event")
+	}
+	return player.Event{}
+}
+
+// waitFor returns the first event of given type, other events are skipped.
+func (f *follower) waitFor(typ player.EventType) player.Event {
+	f.t.Helper()
+	for {
+		ev := f.next()
+		if ev.Type == typ {
+			return ev
+		}
+	}
+}
+
+// waitState waits until the Player reaches state, and returns the states it went through, including state.
+func (f *follower) waitState(state player.State) []player.State {
+	f.t.Helper()
+	var states []player.State
+	for {
+		ev := f.waitFor(player.EventStateChanged)
+		states = append(states, ev.State)
+		if ev.State == state {
+			return states
+		}
+	}
+}
+
+func checkStates(t *testing.T, got []player.State, want ...player.State) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("states %v, want %v", got, want)
+	}
+}
+
+func newTestPlayer(t *testing.T) (*player.Player, *playertest.Fake, *clocktest.Fake, *follower) {
+	backend := playertest.NewFake()
+	p := player.NewPlayerWithBackend(nil, backend)
+	clk := clocktest.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	p.SetClock(clk)
+	t.Cleanup(p.Close)
+	return p, backend, clk, follow(t, p)
+}
+
+func TestPlayerPlayStop(t *testing.T) {
+	p, backend, _, events := newTestPlayer(t)
+	if state := p.State(); state != player.StateIdle {
+		t.Fatalf("state %v, want idle", state)
+	}
+	if p.Play() {
+		t.Fatal("playing without a channel")
+	}
+
+	p.SetChannel(newChannel(t, "one", "_a"))
+	checkStates(t, events.waitState(player.StatePlaying), player.StateConnecting, player.StateBuffering, player.StatePlaying)
+	if url := backend.URL(); url != "http://stream/one_a" || !backend.IsPlaying() {
+		t.Fatalf("backend plays %q: %v", url, backend.IsPlaying())
+	}
+
+	backend.Send(player.BackendEvent{Type: player.BackendMetadata, Title: "Artist - Title"})
+	if ev := events.waitFor(player.EventTitleChanged); ev.Title != "Artist - Title" {
+		t.Fatalf("title %q", ev.Title)
+	}
+
+	// without timeshift PlayStop stops, the stop of the backend is no reason to reconnect
+	if p.PlayStop() {
+		t.Fatal("PlayStop returned playing")
+	}
+	checkStates(t, events.waitState(player.StateStopped), player.StateStopped)
+	if backend.IsPlaying() {
+		t.Fatal("backend still playing")
+	}
+	if p.PlayStop() != true {
+		t.Fatal("PlayStop returned stopped")
+	}
+	checkStates(t, events.waitState(player.StatePlaying), player.StateConnecting, player.StateBuffering, player.StatePlaying)
+	if got := backend.Opened(); len(got) != 2 {
+		t.Fatalf("opened %q, want the stream twice", got)
+	}
+}
+
+func TestPlayerSetChannel(t *testing.T) {
+	p, backend, _, events := newTestPlayer(t)
+	one, two := newChannel(t, "one", "_a"), newChannel(t, "two", "_a")
+	p.SetChannel(one)
+	events.waitState(player.StatePlaying)
+
+	p.SetChannel(two)
+	checkStates(t, events.waitState(player.StatePlaying), player.StateConnecting, player.StateBuffering, player.StatePlaying)
+	if p.Channel() != two {
+		t.Fatal("channel wasn't changed")
+	}
+	want := []string{"http://stream/one_a", "http://stream/two_a"}
+	if got := backend.Opened(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("opened %q, want %q", got, want)
+	}
+}
+
+func TestPlayerVolume(t *testing.T) {
+	p, backend, _, events := newTestPlayer(t)
+	p.SetVolume(40)
+	if ev := events.waitFor(player.EventVolumeChanged); ev.Volume != 40 {
+		t.Fatalf("volume event %d, want 40", ev.Volume)
+	}
+	if p.Volume() != 40 || backend.Volume() != 40 {
+		t.Fatalf("volume %d, backend %d, want 40", p.Volume(), backend.Volume())
+	}
+
+	// the volume is kept for the next stream
+	p.SetChannel(newChannel(t, "one", "_a"))
+	events.waitState(player.StatePlaying)
+	if backend.Volume() != 40 {
+		t.Fatalf("backend volume %d, want 40", backend.Volume())
+	}
+}
+
+func TestPlayerNoBackend(t *testing.T) {
+	p := player.NewPlayerWithBackend(nil, nil)
+	defer p.Close()
+	events := follow(t, p)
+	p.SetChannel(newChannel(t, "one", "_a"))
+	if ev := events.waitFor(player.EventError); ev.Err != player.ErrNoBackend {
+		t.Fatalf("error %v, want %v", ev.Err, player.ErrNoBackend)
+	}
+	checkStates(t, events.waitState(player.StateError), player.StateError)
+}
+
+func TestPlayerBackendError(t *testing.T) {
+	p, backend, clk, events := newTestPlayer(t)
+	openErr := errors.New("device busy")
+	backend.OpenErr = openErr
+
+	// every attempt fails, the Player gives up after the last reconnect
+	p.SetChannel(newChannel(t, "one", "_a"))
+	for i := 0; i < 5; i++ {
+		if ev := events.waitFor(player.EventError); !errors.Is(ev.Err, openErr) {
+			t.Fatalf("error %v, want %v", ev.Err, openErr)
+		}
+		events.waitState(player.StateReconnecting)
+		clk.Advance(16 * time.Second)
+	}
+	events.waitFor(player.EventError)
+	events.waitState(player.StateError)
+	if len(backend.Opened()) != 0 {
+		t.Fatalf("opened %q", backend.Opened())
+	}
+}
+
+func TestPlayerReconnect(t *testing.T) {
+	p, backend, clk, events := newTestPlayer(t)
+	p.SetChannel(newChannel(t, "one", "_a", "_b"))
+	events.waitState(player.StatePlaying)
+
+	// the stream ends, the next stream url is tried after a second
+	backend.Send(player.BackendEvent{Type: player.BackendStopped})
+	if ev := events.waitFor(player.EventError); ev.Err != player.ErrStreamEnded {
+		t.Fatalf("error %v, want %v", ev.Err, player.ErrStreamEnded)
+	}
+	events.waitState(player.StateReconnecting)
+	clk.Advance(999 * time.Millisecond)
+	if state := p.State(); state != player.StateReconnecting {
+		t.Fatalf("state %v before the reconnect delay", state)
+	}
+	clk.Advance(time.Millisecond)
+	checkStates(t, events.waitState(player.StatePlaying), player.StateConnecting, player.StateBuffering, player.StatePlaying)
+	if url := backend.URL(); url != "http://stream/one_b" {
+		t.Fatalf("reconnected to %q, want the second stream", url)
+	}
+
+	// an error while playing reconnects too, with the first delay again because playback succeeded
+	backend.Send(player.BackendEvent{Type: player.BackendError, Err: errors.New("decode error")})
+	events.waitState(player.StateReconnecting)
+	clk.Advance(time.Second)
+	events.waitState(player.StatePlaying)
+	if url := backend.URL(); url != "http://stream/one_a" {
+		t.Fatalf("reconnected to %q, want the first stream after all were tried", url)
+	}
+
+	// Stop cancels a reconnect
+	backend.Send(player.BackendEvent{Type: player.BackendStopped})
+	events.waitState(player.StateReconnecting)
+	p.Stop()
+	events.waitState(player.StateStopped)
+	clk.Advance(time.Minute)
+	if state := p.State(); state != player.StateStopped {
+		t.Fatalf("state %v after a cancelled reconnect", state)
+	}
+}
+
+// within fails the test when fn doesn't return in time.
+func within(t *testing.T, what string, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		fn()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("%s blocked", what)
+	}
+}
+
+func TestPlayerSlowConnect(t *testing.T) {
+	p, backend, _, events := newTestPlayer(t)
+	release := make(chan struct{})
+	defer close(release)
+
+	p.SetChannel(newSlowChannel(t, "slow", release))
+	events.waitState(player.StateConnecting)
+	within(t, "State", func() {
+		if state := p.State(); state != player.StateConnecting {
+			t.Errorf("state %v while connecting", state)
+		}
+	})
+	within(t, "SetVolume", func() { p.SetVolume(42) })
+	within(t, "Volume", func() { p.Volume() })
+	within(t, "Channel", func() { p.Channel() })
+
+	// the stream urls of the slow channel come in after the channel was changed, they are dropped
+	fast := newChannel(t, "fast", "_a")
+	p.SetChannel(fast)
+	events.waitState(player.StatePlaying)
+	release <- struct{}{}
+	within(t, "State", func() { p.State() })
+	if got := backend.Opened(); !reflect.DeepEqual(got, []string{"http://stream/fast_a"}) {
+		t.Fatalf("opened %q, want only the fast channel", got)
+	}
+	if p.Channel() != fast || p.State() != player.StatePlaying {
+		t.Fatalf("playing %v in state %v, want the fast channel", p.Channel(), p.State())
+	}
+}
+
+func TestPlayerStopWhileConnecting(t *testing.T) {
+	p, backend, _, events := newTestPlayer(t)
+	release := make(chan struct{})
+	p.SetChannel(newSlowChannel(t, "slow", release))
+	events.waitState(player.StateConnecting)
+	p.Stop()
+	events.waitState(player.StateStopped)
+	close(release)
+	if state := p.State(); state != player.StateStopped {
+		t.Fatalf("state %v after a stop while connecting", state)
+	}
+
+	// the stopped attempt leaves the backend alone, playing again opens the stream once
+	p.Play()
+	events.waitState(player.StatePlaying)
+	if got := backend.Opened(); !reflect.DeepEqual(got, []string{"http://stream/slow"}) {
+		t.Fatalf("opened %q, want the stream once", got)
+	}
+}
+
+func TestPlayerClose(t *testing.T) {
+	backend := playertest.NewFake()
+	p := player.NewPlayerWithBackend(nil, backend)
+	sub := p.Subscribe()
+	p.Close()
+	for range sub.Events() {
+	}
+	if !backend.Closed() {
+		t.Fatal("backend wasn't closed")
+	}
+}
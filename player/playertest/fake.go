@@ -0,0 +1,133 @@
+// Package playertest provides a fake player.AudioBackend for tests.
+package playertest
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/GeertJohan/tune/player"
+)
+
+// ErrNotOpen is returned by Play when no stream was opened.
+var ErrNotOpen = errors.New("no stream opened")
+
+// Fake is a player.AudioBackend that plays nothing, it records the calls that were made.
+// Play and Stop send the playing and stopped events like a real backend would, other events are sent with Send.
+type Fake struct {
+	lock    sync.Mutex
+	url     string
+	playing bool
+	volume  int
+	closed  bool
+	opened  []string
+
+	// OpenErr, when set, is returned by Open.
+	OpenErr error
+
+	chEvents chan player.BackendEvent
+}
+
+var _ player.AudioBackend = (*Fake)(nil)
+
+// NewFake creates a new Fake backend.
+func NewFake() *Fake {
+	return &Fake{
+		chEvents: make(chan player.BackendEvent, 16),
+	}
+}
+
+// Open records the url.
+func (f *Fake) Open(url string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.OpenErr != nil {
+		return f.OpenErr
+	}
+	f.url = url
+	f.opened = append(f.opened, url)
+	return nil
+}
+
+// Play starts fake playback and sends a playing event.
+func (f *Fake) Play() error {
+	f.lock.Lock()
+	if f.url == "" {
+		f.lock.Unlock()
+		return ErrNotOpen
+	}
+	f.playing = true
+	f.lock.Unlock()
+	f.Send(player.BackendEvent{Type: player.BackendPlaying})
+	return nil
+}
+
+// Stop stops fake playback and sends a stopped event.
+func (f *Fake) Stop() error {
+	f.lock.Lock()
+	f.playing = false
+	f.lock.Unlock()
+	f.Send(player.BackendEvent{Type: player.BackendStopped})
+	return nil
+}
+
+// IsPlaying returns true between Play and Stop.
+func (f *Fake) IsPlaying() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.playing
+}
+
+// SetVolume records the volume.
+func (f *Fake) SetVolume(volume int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.volume = volume
+	return nil
+}
+
+// Events returns the channel with the events.
+func (f *Fake) Events() <-chan player.BackendEvent {
+	return f.chEvents
+}
+
+// Close marks the backend closed.
+func (f *Fake) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.playing = false
+	f.closed = true
+	return nil
+}
+
+// Send sends an event to the Player, as if the backend sent it.
+func (f *Fake) Send(ev player.BackendEvent) {
+	f.chEvents <- ev
+}
+
+// URL returns the url of the open stream.
+func (f *Fake) URL() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.url
+}
+
+// Opened returns all urls that were opened, in order.
+func (f *Fake) Opened() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string(nil), f.opened...)
+}
+
+// Volume returns the last volume that was set.
+func (f *Fake) Volume() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.volume
+}
+
+// Closed returns true when Close was called.
+func (f *Fake) Closed() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.closed
+}
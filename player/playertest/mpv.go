@@ -0,0 +1,158 @@
+package playertest
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"sync"
+)
+
+// MPVServer is a fake mpv JSON IPC server on a unix socket, for testing player.MPVBackend with AttachMPVBackend.
+// It answers commands with success and records them. The loadfile and stop commands are followed by the events
+// mpv would send, other events are sent with SendEvent.
+type MPVServer struct {
+	// Path is the path of the socket.
+	Path string
+
+	listener net.Listener
+
+	lock     sync.Mutex
+	conns    []net.Conn
+	commands [][]interface{}
+	failures map[string]string
+
+	delayEndFile   bool
+	pendingEndFile bool // an end-file for a stop that is sent after the next response
+}
+
+// NewMPVServer starts a fake mpv IPC server with a socket in dir.
+func NewMPVServer(dir string) (*MPVServer, error) {
+	path := filepath.Join(dir, "mpv.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	s := &MPVServer{
+		Path:     path,
+		listener: listener,
+		failures: make(map[string]string),
+	}
+	go s.accept()
+	return s, nil
+}
+
+func (s *MPVServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.lock.Lock()
+		s.conns = append(s.conns, conn)
+		s.lock.Unlock()
+		go s.serve(conn)
+	}
+}
+
+func (s *MPVServer) serve(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var request struct {
+			Command   []interface{} `json:"command"`
+			RequestID int           `json:"request_id"`
+		}
+		err := json.Unmarshal(scanner.Bytes(), &request)
+		if err != nil || len(request.Command) == 0 {
+			s.write(conn, map[string]interface{}{"error": "invalid parameter"})
+			continue
+		}
+		name, _ := request.Command[0].(string)
+
+		s.lock.Lock()
+		s.commands = append(s.commands, request.Command)
+		failure, failed := s.failures[name]
+		pendingEndFile := s.pendingEndFile
+		delayEndFile := name == "stop" && s.delayEndFile
+		s.pendingEndFile = delayEndFile
+		s.lock.Unlock()
+
+		if failed {
+			s.write(conn, map[string]interface{}{"error": failure, "request_id": request.RequestID})
+		} else {
+			s.write(conn, map[string]interface{}{"error": "success", "data": nil, "request_id": request.RequestID})
+		}
+		if pendingEndFile {
+			s.write(conn, map[string]interface{}{"event": "end-file", "reason": "stop"})
+		}
+		if failed {
+			continue
+		}
+		switch name {
+		case "loadfile":
+			s.write(conn, map[string]interface{}{"event": "start-file"})
+			s.write(conn, map[string]interface{}{"event": "file-loaded"})
+			s.write(conn, map[string]interface{}{"event": "playback-restart"})
+		case "stop":
+			if !delayEndFile {
+				s.write(conn, map[string]interface{}{"event": "end-file", "reason": "stop"})
+			}
+		}
+	}
+}
+
+func (s *MPVServer) write(conn net.Conn, msg map[string]interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(append(data, '\n'))
+	return err
+}
+
+// Commands returns the commands that were received, in order.
+func (s *MPVServer) Commands() [][]interface{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([][]interface{}(nil), s.commands...)
+}
+
+// FailCommand makes the server respond with errMsg to the command with given name, such as "loadfile".
+func (s *MPVServer) FailCommand(name, errMsg string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failures[name] = errMsg
+}
+
+// DelayEndFile makes the server send the end-file event of a stop after the response to the next command, like a
+// busy mpv does.
+func (s *MPVServer) DelayEndFile(delay bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.delayEndFile = delay
+}
+
+// SendEvent sends an event to all connected clients, e.g. {"event": "end-file", "reason": "error"}.
+func (s *MPVServer) SendEvent(event map[string]interface{}) error {
+	s.lock.Lock()
+	conns := append([]net.Conn(nil), s.conns...)
+	s.lock.Unlock()
+	for _, conn := range conns {
+		err := s.write(conn, event)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops the server and closes all connections.
+func (s *MPVServer) Close() error {
+	err := s.listener.Close()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	return err
+}
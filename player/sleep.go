@@ -0,0 +1,60 @@
+package player
+
+import (
+	"time"
+
+	"github.com/GeertJohan/tune/clock"
+)
+
+// sleepInterval is the time between the volume steps while the sleep timer lowers the volume.
+const sleepInterval = time.Second
+
+// sleepTimer stops playback at a set time, after lowering the volume over the last part.
+type sleepTimer struct {
+	at       time.Time
+	fadeOver time.Duration
+	ticker   clock.Ticker
+}
+
+// setSleep replaces the sleep timer, a zero time cancels it.
+func (p *Player) setSleep(at time.Time, fadeOver time.Duration) {
+	if p.sleep != nil {
+		p.sleep.ticker.Stop()
+		p.sleep = nil
+	}
+	if !at.IsZero() {
+		p.sleep = &sleepTimer{
+			at:       at,
+			fadeOver: fadeOver,
+			ticker:   p.clk.NewTicker(sleepInterval),
+		}
+	}
+	p.send(Event{Type: EventSleepChanged})
+	p.stepSleep()
+}
+
+// stepSleep lowers the volume when the sleep timer is close, and stops playback when the time is up.
+func (p *Player) stepSleep() {
+	if p.sleep == nil {
+		p.sleepGain = 1
+		p.applyVolume()
+		return
+	}
+	left := p.sleep.at.Sub(p.clk.Now())
+	if left <= 0 {
+		p.sleep.ticker.Stop()
+		p.sleep = nil
+		// the volume stays down until playback starts again
+		p.stop()
+		p.send(Event{Type: EventSleepChanged})
+		return
+	}
+	gain := 1.0
+	if left < p.sleep.fadeOver {
+		gain = float64(left) / float64(p.sleep.fadeOver)
+	}
+	if gain != p.sleepGain {
+		p.sleepGain = gain
+		p.applyVolume()
+	}
+}
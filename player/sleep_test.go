@@ -0,0 +1,63 @@
+package player_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GeertJohan/tune/player"
+)
+
+func TestSleepTimer(t *testing.T) {
+	p, backend, clk, events := newTestPlayer(t)
+	p.SetVolume(80)
+	p.SetChannel(newChannel(t, "one", "_a"))
+	events.waitState(player.StatePlaying)
+
+	at := clk.Now().Add(4 * time.Second)
+	p.SetSleepTimer(at, 2*time.Second)
+	if ev := events.waitFor(player.EventSleepChanged); !ev.SleepAt.Equal(at) {
+		t.Fatalf("sleep at %v, want %v", ev.SleepAt, at)
+	}
+
+	// the volume goes down over the last two seconds
+	clk.Advance(2 * time.Second)
+	waitVolume(t, backend, 80)
+	clk.Advance(time.Second)
+	waitVolume(t, backend, 40)
+	if !backend.IsPlaying() {
+		t.Fatal("stopped before the sleep timer ended")
+	}
+	clk.Advance(time.Second)
+	events.waitState(player.StateStopped)
+	if ev := events.waitFor(player.EventSleepChanged); !ev.SleepAt.IsZero() {
+		t.Fatalf("sleep at %v after the sleep timer ended", ev.SleepAt)
+	}
+	eventually(t, func() bool { return !backend.IsPlaying() }, "backend still playing after the sleep timer")
+
+	// playing again is at the full volume
+	p.Play()
+	events.waitState(player.StatePlaying)
+	waitVolume(t, backend, 80)
+}
+
+func TestSleepTimerCancel(t *testing.T) {
+	p, backend, clk, events := newTestPlayer(t)
+	p.SetVolume(80)
+	p.SetChannel(newChannel(t, "one", "_a"))
+	events.waitState(player.StatePlaying)
+
+	p.SetSleepTimer(clk.Now().Add(time.Minute), time.Minute)
+	events.waitFor(player.EventSleepChanged)
+	clk.Advance(30 * time.Second)
+	waitVolume(t, backend, 40)
+
+	p.SetSleepTimer(time.Time{}, 0)
+	if ev := events.waitFor(player.EventSleepChanged); !ev.SleepAt.IsZero() {
+		t.Fatalf("sleep at %v after cancel", ev.SleepAt)
+	}
+	waitVolume(t, backend, 80)
+	clk.Advance(time.Minute)
+	if state := p.State(); state != player.StatePlaying {
+		t.Fatalf("state %v after a cancelled sleep timer", state)
+	}
+}
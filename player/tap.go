@@ -0,0 +1,170 @@
+package player
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/GeertJohan/tune/api"
+)
+
+// tapMaxBuffered is how much audio a StreamTap holds for a reader that falls behind, before it gives up.
+const tapMaxBuffered = 4 << 20
+
+var (
+	// ErrTapClosed is returned by StreamTap.Read when the tapped stream was closed by the Player, or the tap by Close.
+	ErrTapClosed = errors.New("tapped stream was closed")
+
+	// ErrTapOverflow is returned by StreamTap.Read when the reader fell too far behind the stream.
+	ErrTapOverflow = errors.New("tap reader fell behind the stream")
+)
+
+// StreamTap is a copy of the live stream that the Player receives for its timeshift buffer, so the stream can be
+// recorded without connecting to it again. The audio is read with Read, the stream titles are passed to the onTitle
+// func from Read, at their position in the audio like ICYReader does.
+// The tap never holds up the Player: a reader that falls behind gets ErrTapOverflow.
+type StreamTap struct {
+	contentType string
+	metadata    bool
+	onTitle     func(title string)
+	detach      func(t *StreamTap)
+
+	lock     sync.Mutex
+	cond     *sync.Cond
+	items    []tapItem
+	buffered int   // bytes of audio in items
+	err      error // returned by Read when items are read
+}
+
+// tapItem is a piece of audio, or a stream title when titled is set.
+type tapItem struct {
+	audio  []byte
+	title  string
+	titled bool
+}
+
+func newStreamTap(contentType string, metadata bool, onTitle func(title string), detach func(t *StreamTap)) *StreamTap {
+	t := &StreamTap{
+		contentType: contentType,
+		metadata:    metadata,
+		onTitle:     onTitle,
+		detach:      detach,
+	}
+	t.cond = sync.NewCond(&t.lock)
+	return t
+}
+
+// ContentType returns the content type of the stream.
+func (t *StreamTap) ContentType() string {
+	return t.contentType
+}
+
+// Metadata returns whether the stream has ICY metadata, only then are its titles passed to onTitle.
+func (t *StreamTap) Metadata() bool {
+	return t.metadata
+}
+
+// Read reads audio from the stream, it waits until there is some. The titles before the audio are passed to onTitle.
+func (t *StreamTap) Read(p []byte) (int, error) {
+	for {
+		t.lock.Lock()
+		for len(t.items) == 0 && t.err == nil {
+			t.cond.Wait()
+		}
+		if len(t.items) == 0 {
+			err := t.err
+			t.lock.Unlock()
+			return 0, err
+		}
+		item := t.items[0]
+		if item.titled {
+			t.items = t.items[1:]
+			t.lock.Unlock()
+			if t.onTitle != nil {
+				t.onTitle(item.title)
+			}
+			continue
+		}
+		n := copy(p, item.audio)
+		if n == len(item.audio) {
+			t.items = t.items[1:]
+		} else {
+			t.items[0].audio = item.audio[n:]
+		}
+		t.buffered -= n
+		t.lock.Unlock()
+		return n, nil
+	}
+}
+
+// Close stops the tap, Read returns ErrTapClosed afterwards.
+func (t *StreamTap) Close() error {
+	t.detach(t)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.items = nil
+	t.buffered = 0
+	t.err = ErrTapClosed
+	t.cond.Broadcast()
+	return nil
+}
+
+// streamClosed ends the tap after the audio that was received.
+func (t *StreamTap) streamClosed() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.end(ErrTapClosed)
+}
+
+// write adds a copy of audio from the stream.
+func (t *StreamTap) write(audio []byte) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.err != nil {
+		return
+	}
+	if t.buffered+len(audio) > tapMaxBuffered {
+		t.end(ErrTapOverflow)
+		return
+	}
+	t.items = append(t.items, tapItem{audio: append([]byte(nil), audio...)})
+	t.buffered += len(audio)
+	t.cond.Broadcast()
+}
+
+// title adds a stream title at the current position in the audio.
+func (t *StreamTap) title(title string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.err != nil {
+		return
+	}
+	t.items = append(t.items, tapItem{title: title, titled: true})
+	t.cond.Broadcast()
+}
+
+// end makes Read return err after the items, the lock must be held.
+func (t *StreamTap) end(err error) {
+	if t.err == nil {
+		t.err = err
+	}
+	t.cond.Broadcast()
+}
+
+// tapRequest asks the run loop for a tap of the stream of channel.
+type tapRequest struct {
+	channel *api.Channel
+	onTitle func(title string)
+	retCh   chan *StreamTap
+}
+
+// Tap returns a copy of the stream of channel from its live position on, when the Player receives that stream itself,
+// which it does for the timeshift buffer. The current title is passed to onTitle on the first Read.
+// ok is false when the Player doesn't receive the stream of channel, because it plays without timeshift, isn't
+// connected or plays another channel. The tap ends with ErrTapClosed when the Player closes the stream.
+func (p *Player) Tap(channel *api.Channel, onTitle func(title string)) (tap *StreamTap, ok bool) {
+	retCh := make(chan *StreamTap)
+	p.chTap <- tapRequest{channel: channel, onTitle: onTitle, retCh: retCh}
+	tap = <-retCh
+	return tap, tap != nil
+}
@@ -0,0 +1,479 @@
+package player
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// timeshiftDefaultByteRate is assumed for streams that don't send their bitrate, 320kbps is the highest
+	// AudioAddict serves.
+	timeshiftDefaultByteRate = 320 * 1000 / 8
+
+	// timeshiftBurst is the audio that is sent to the backend at once when it connects, to fill its buffer.
+	// After that audio is sent as fast as it plays, so the playhead stays close to what is heard.
+	timeshiftBurst = 2 * time.Second
+
+	// timeshiftReadSize is the size of the reads from the stream and the buffer.
+	timeshiftReadSize = 16 * 1024
+)
+
+// ErrNoTimeshift is reported when pausing or seeking a Player that has no timeshift buffer.
+var ErrNoTimeshift = errors.New("timeshift is not enabled")
+
+// timeshiftStorage holds the bytes of a timeshift ring buffer.
+type timeshiftStorage interface {
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+}
+
+// memoryStorage keeps a ring buffer in memory, it grows up to the size of the buffer.
+type memoryStorage struct {
+	buf []byte
+}
+
+func (m *memoryStorage) WriteAt(p []byte, off int64) (int, error) {
+	if end := off + int64(len(p)); end > int64(len(m.buf)) {
+		m.buf = append(m.buf, make([]byte, end-int64(len(m.buf)))...)
+	}
+	return copy(m.buf[off:], p), nil
+}
+
+func (m *memoryStorage) ReadAt(p []byte, off int64) (int, error) {
+	return copy(p, m.buf[off:]), nil
+}
+
+func (m *memoryStorage) Close() error {
+	m.buf = nil
+	return nil
+}
+
+// fileStorage keeps a ring buffer in a temporary file, which is removed on Close.
+type fileStorage struct {
+	*os.File
+}
+
+func (f fileStorage) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// titleMark is the position in the stream at which the stream title changed.
+type titleMark struct {
+	offset int64
+	title  string
+}
+
+// timeshift keeps the last part of a live stream in a ring buffer, and serves it from a playhead to the backend
+// over a local HTTP server. So it works with every backend. The playhead can be moved back in the buffer,
+// and forward up to the live stream. The ICY metadata is kept with the position at which it was received,
+// so the title follows the playhead.
+type timeshift struct {
+	storage     timeshiftStorage
+	size        int64
+	byteRate    int64
+	contentType string
+	metaint     int
+	listener    net.Listener
+	server      *http.Server
+	cancel      context.CancelFunc
+
+	// chTitle gets a signal when the title at the playhead changed, see Title.
+	chTitle chan struct{}
+
+	lock     sync.Mutex
+	cond     *sync.Cond
+	written  int64 // bytes received since the start, the position of the live stream
+	playhead int64 // position of the next byte for the backend
+	marks    []titleMark
+	title    string // title at the playhead
+	reader   int    // the latest backend connection, earlier connections are ended
+	taps     []*StreamTap
+	done     bool  // the stream has ended
+	err      error // why the stream ended
+	closed   bool
+}
+
+// newTimeshift connects to the stream at url with client and buffers about duration of it, in a temporary file in
+// dir or in memory when dir is empty.
+func newTimeshift(client *http.Client, url string, duration time.Duration, dir string) (*timeshift, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "failed to create stream request")
+	}
+	RequestICYMetadata(req)
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "failed to connect to stream")
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("stream responded with status %s", resp.Status)
+	}
+
+	byteRate := int64(timeshiftDefaultByteRate)
+	if kbps, err := strconv.Atoi(resp.Header.Get("Icy-Br")); err == nil && kbps > 0 {
+		byteRate = int64(kbps) * 1000 / 8
+	}
+
+	var storage timeshiftStorage = &memoryStorage{}
+	if dir != "" {
+		err = os.MkdirAll(dir, 0700)
+		var file *os.File
+		if err == nil {
+			file, err = ioutil.TempFile(dir, "timeshift-")
+		}
+		if err != nil {
+			resp.Body.Close()
+			cancel()
+			return nil, errors.Wrap(err, "failed to create timeshift file")
+		}
+		storage = fileStorage{file}
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		storage.Close()
+		resp.Body.Close()
+		cancel()
+		return nil, errors.Wrap(err, "failed to listen for the backend")
+	}
+
+	size := int64(duration.Seconds() * float64(byteRate))
+	if size < byteRate {
+		size = byteRate
+	}
+	ts := &timeshift{
+		storage:     storage,
+		size:        size,
+		byteRate:    byteRate,
+		contentType: resp.Header.Get("Content-Type"),
+		metaint:     ICYMetaInt(resp.Header),
+		listener:    listener,
+		cancel:      cancel,
+		chTitle:     make(chan struct{}, 1),
+	}
+	ts.cond = sync.NewCond(&ts.lock)
+	ts.server = &http.Server{Handler: ts}
+	go ts.server.Serve(listener)
+	go ts.fetch(resp)
+	return ts, nil
+}
+
+// URL returns the url at which the backend plays from the playhead.
+func (ts *timeshift) URL() string {
+	return "http://" + ts.listener.Addr().String() + "/stream"
+}
+
+// fetch writes the stream to the ring buffer until it ends or the timeshift is closed.
+func (ts *timeshift) fetch(resp *http.Response) {
+	defer resp.Body.Close()
+
+	// the title is marked at the position where its metadata block was, the audio that follows it
+	stream := NewICYReader(resp.Body, ts.metaint, func(title string) {
+		ts.lock.Lock()
+		defer ts.lock.Unlock()
+		if len(ts.marks) == 0 || ts.marks[len(ts.marks)-1].title != title {
+			ts.marks = append(ts.marks, titleMark{offset: ts.written, title: title})
+		}
+		for _, t := range ts.taps {
+			t.title(title)
+		}
+	})
+
+	buf := make([]byte, timeshiftReadSize)
+	for {
+		n, err := stream.Read(buf)
+		if n > 0 {
+			werr := ts.write(buf[:n])
+			if werr != nil && err == nil {
+				err = errors.Wrap(werr, "failed to write timeshift buffer")
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = ErrStreamEnded
+			}
+			ts.lock.Lock()
+			ts.done = true
+			ts.err = err
+			ts.closeTaps()
+			ts.cond.Broadcast()
+			ts.lock.Unlock()
+			return
+		}
+	}
+}
+
+// write appends audio to the ring buffer, overwriting the oldest audio.
+func (ts *timeshift) write(p []byte) error {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	if ts.closed {
+		return nil
+	}
+	for _, t := range ts.taps {
+		t.write(p)
+	}
+	for len(p) > 0 {
+		off := ts.written % ts.size
+		n := int64(len(p))
+		if n > ts.size-off {
+			n = ts.size - off
+		}
+		_, err := ts.storage.WriteAt(p[:n], off)
+		if err != nil {
+			return err
+		}
+		ts.written += n
+		p = p[n:]
+	}
+
+	// the last mark before the start of the buffer holds the title of the oldest audio
+	oldest := ts.oldest()
+	for len(ts.marks) > 1 && ts.marks[1].offset <= oldest {
+		ts.marks = ts.marks[1:]
+	}
+	ts.cond.Broadcast()
+	return nil
+}
+
+// oldest returns the position of the oldest audio in the buffer.
+func (ts *timeshift) oldest() int64 {
+	if ts.written < ts.size {
+		return 0
+	}
+	return ts.written - ts.size
+}
+
+// tap returns a tap of the live stream, nil when the stream has ended.
+func (ts *timeshift) tap(onTitle func(title string)) *StreamTap {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	if ts.done {
+		return nil
+	}
+	t := newStreamTap(ts.contentType, ts.metaint > 0, onTitle, ts.untap)
+	if len(ts.marks) > 0 {
+		t.title(ts.marks[len(ts.marks)-1].title)
+	}
+	ts.taps = append(ts.taps, t)
+	return t
+}
+
+// untap removes a tap that was closed.
+func (ts *timeshift) untap(t *StreamTap) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	for i, tap := range ts.taps {
+		if tap == t {
+			ts.taps = append(ts.taps[:i], ts.taps[i+1:]...)
+			return
+		}
+	}
+}
+
+// closeTaps ends the taps when the stream ends, the lock must be held.
+func (ts *timeshift) closeTaps() {
+	for _, t := range ts.taps {
+		t.streamClosed()
+	}
+	ts.taps = nil
+}
+
+// ServeHTTP sends the audio from the playhead to the backend.
+// A new connection takes over from the previous one, as the backend reconnects after a seek.
+func (ts *timeshift) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ts.lock.Lock()
+	ts.reader++
+	reader := ts.reader
+	ts.cond.Broadcast()
+	ts.lock.Unlock()
+
+	// wake up read when the backend disconnects
+	ctx := r.Context()
+	go func() {
+		<-ctx.Done()
+		ts.lock.Lock()
+		ts.cond.Broadcast()
+		ts.lock.Unlock()
+	}()
+
+	if ts.contentType != "" {
+		w.Header().Set("Content-Type", ts.contentType)
+	}
+	flusher, _ := w.(http.Flusher)
+	start := time.Now()
+	burst := int64(timeshiftBurst.Seconds() * float64(ts.byteRate))
+	var sent int64
+	buf := make([]byte, timeshiftReadSize)
+	for {
+		// don't send faster than the audio plays
+		allowed := burst + int64(time.Since(start).Seconds()*float64(ts.byteRate)) - sent
+		if allowed <= 0 {
+			select {
+			case <-time.After(ts.duration(1 - allowed)):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		if allowed > int64(len(buf)) {
+			allowed = int64(len(buf))
+		}
+
+		n, err := ts.read(ctx, reader, buf[:allowed])
+		if n > 0 {
+			_, werr := w.Write(buf[:n])
+			if werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			sent += int64(n)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// read reads audio at the playhead, it waits for the live stream when the playhead has caught up.
+// It returns io.EOF when the stream ended or another connection took over.
+func (ts *timeshift) read(ctx context.Context, reader int, p []byte) (int, error) {
+	ts.lock.Lock()
+	for ts.playhead >= ts.written && !ts.done && ts.reader == reader && ctx.Err() == nil {
+		ts.cond.Wait()
+	}
+	if ts.closed || ts.reader != reader || ctx.Err() != nil {
+		ts.lock.Unlock()
+		return 0, io.EOF
+	}
+	if ts.playhead < ts.oldest() {
+		// the backend was too slow, the audio at the playhead has been overwritten
+		ts.playhead = ts.oldest()
+	}
+	if ts.playhead >= ts.written {
+		ts.lock.Unlock()
+		return 0, io.EOF // done
+	}
+
+	off := ts.playhead % ts.size
+	n := ts.written - ts.playhead
+	if n > int64(len(p)) {
+		n = int64(len(p))
+	}
+	if n > ts.size-off {
+		n = ts.size - off
+	}
+	_, err := ts.storage.ReadAt(p[:n], off)
+	if err != nil {
+		ts.lock.Unlock()
+		return 0, errors.Wrap(err, "failed to read timeshift buffer")
+	}
+	ts.playhead += n
+	changed := ts.updateTitle()
+	ts.lock.Unlock()
+
+	if changed {
+		ts.signalTitle()
+	}
+	return int(n), nil
+}
+
+// updateTitle sets the title to that of the audio at the playhead, it returns true when it changed.
+func (ts *timeshift) updateTitle() bool {
+	title := ""
+	for _, mark := range ts.marks {
+		if mark.offset > ts.playhead {
+			break
+		}
+		title = mark.title
+	}
+	changed := title != ts.title
+	ts.title = title
+	return changed
+}
+
+func (ts *timeshift) signalTitle() {
+	select {
+	case ts.chTitle <- struct{}{}:
+	default:
+	}
+}
+
+// Title returns the stream title at the playhead.
+func (ts *timeshift) Title() string {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	return ts.title
+}
+
+// Behind returns how far the playhead is behind the live stream.
+func (ts *timeshift) Behind() time.Duration {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	return ts.duration(ts.written - ts.playhead)
+}
+
+// Seek moves the playhead by offset, negative offsets go back. The playhead stays within the buffer.
+// It returns how far the playhead is behind the live stream afterwards.
+func (ts *timeshift) Seek(offset time.Duration) time.Duration {
+	ts.lock.Lock()
+	ts.playhead += int64(offset.Seconds() * float64(ts.byteRate))
+	if ts.playhead < ts.oldest() {
+		ts.playhead = ts.oldest()
+	}
+	if ts.playhead > ts.written {
+		ts.playhead = ts.written
+	}
+	changed := ts.updateTitle()
+	behind := ts.duration(ts.written - ts.playhead)
+	ts.lock.Unlock()
+
+	if changed {
+		ts.signalTitle()
+	}
+	return behind
+}
+
+func (ts *timeshift) duration(bytes int64) time.Duration {
+	return time.Duration(float64(bytes) / float64(ts.byteRate) * float64(time.Second))
+}
+
+// Err returns why the stream ended, nil while it is running.
+func (ts *timeshift) Err() error {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	return ts.err
+}
+
+// Close disconnects from the stream and the backend, and removes the buffer.
+func (ts *timeshift) Close() error {
+	ts.cancel()
+	ts.server.Close()
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	ts.done = true
+	ts.closed = true
+	ts.closeTaps()
+	ts.cond.Broadcast()
+	return ts.storage.Close()
+}
@@ -0,0 +1,322 @@
+package player_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GeertJohan/tune/api"
+	"github.com/GeertJohan/tune/player"
+)
+
+// newStreamChannel returns a channel with one live stream, served by a test server with the headers and the chunks
+// of data that are sent on chunks. The stream stays open after chunks is closed, until the end of the test.
+func newStreamChannel(t *testing.T, header http.Header, chunks <-chan []byte) *api.Channel {
+	done := make(chan struct{})
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stream" {
+			fmt.Fprintf(w, "[%q]", srv.URL+"/stream")
+			return
+		}
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+		w.(http.Flusher).Flush()
+		chunks := chunks
+		for {
+			select {
+			case chunk, ok := <-chunks:
+				if !ok {
+					chunks = nil
+					continue
+				}
+				w.Write(chunk)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			case <-done:
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(done) })
+	return &api.Channel{
+		Network:    &api.Network{ListenURLBase: srv.URL},
+		Streamlist: &api.Streamlist{Key: "mp3"},
+		Key:        "live",
+	}
+}
+
+// chunks returns a closed channel with the chunks on it.
+func chunks(data ...[]byte) <-chan []byte {
+	ch := make(chan []byte, len(data))
+	for _, chunk := range data {
+		ch <- chunk
+	}
+	close(ch)
+	return ch
+}
+
+// nextTitle returns the title of the next title change.
+func (f *follower) nextTitle() string {
+	f.t.Helper()
+	return f.waitFor(player.EventTitleChanged).Title
+}
+
+// waitLive jumps to the live stream until the title there is title, so the stream was buffered up to its mark.
+func waitLive(t *testing.T, p *player.Player, events *follower, title string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		err := p.JumpToLive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case ev := <-events.sub.Events():
+			if ev.Type == player.EventTitleChanged && ev.Title == title {
+				return
+			}
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatalf("the stream wasn't buffered up to %q", title)
+}
+
+func seek(t *testing.T, p *player.Player, offset, wantBehind time.Duration) {
+	t.Helper()
+	behind, err := p.Seek(offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if behind != wantBehind {
+		t.Fatalf("%v behind after seeking %v, want %v", behind, offset, wantBehind)
+	}
+}
+
+func TestTimeshift(t *testing.T) {
+	t.Run("memory", func(t *testing.T) { testTimeshift(t, "") })
+	t.Run("file", func(t *testing.T) { testTimeshift(t, t.TempDir()) })
+}
+
+// streamHeader are the headers of a stream of 8kbps, which is 1000 bytes a second, with ICY metadata.
+func streamHeader(metaint int) http.Header {
+	return http.Header{
+		"Content-Type": {"audio/mpeg"},
+		"Icy-Br":       {"8"},
+		"Icy-Metaint":  {fmt.Sprint(metaint)},
+	}
+}
+
+// testTimeshift plays a stream of 5 seconds through a timeshift buffer of 2 seconds, so the ring buffer wraps.
+func testTimeshift(t *testing.T, dir string) {
+	p, backend, _, events := newTestPlayer(t)
+
+	// a title is marked in the blocks after 0.5, 2.5, 3.5 and 5 seconds
+	const metaint = 500
+	audio := testAudio(5000)
+	stream := icyStream(audio, metaint,
+		icyBlock("StreamTitle='One';"), icyBlock(""), icyBlock(""), icyBlock(""),
+		icyBlock("StreamTitle='Two';"), icyBlock(""),
+		icyBlock("StreamTitle='Three';"), icyBlock(""), icyBlock(""),
+		icyBlock("StreamTitle='Live';"),
+	)
+	p.SetTimeshift(2*time.Second, dir)
+	p.SetChannel(newStreamChannel(t, streamHeader(metaint), chunks(stream)))
+	events.waitState(player.StatePlaying)
+	if dir != "" {
+		files, _ := os.ReadDir(dir)
+		if len(files) != 1 {
+			t.Fatalf("%d files in the timeshift dir, want the buffer", len(files))
+		}
+	}
+
+	// paused, the playhead only moves by seeking
+	if !p.Pause() {
+		t.Fatal("no pause with timeshift")
+	}
+	events.waitState(player.StatePaused)
+	waitLive(t, p, events, "Live")
+
+	// the buffer holds the last 2 seconds, from 3 to 5, the title at 3 seconds is that of the mark before it
+	seek(t, p, -time.Hour, 2*time.Second)
+	if title := events.nextTitle(); title != "Two" {
+		t.Fatalf("title %q at the start of the buffer, want Two", title)
+	}
+	seek(t, p, 700*time.Millisecond, 1300*time.Millisecond)
+	if title := events.nextTitle(); title != "Three" {
+		t.Fatalf("title %q after seeking past its mark, want Three", title)
+	}
+	seek(t, p, -10*time.Second, 2*time.Second)
+	if title := events.nextTitle(); title != "Two" {
+		t.Fatalf("title %q after seeking back, want Two", title)
+	}
+
+	// the backend plays from the playhead, the wrapped buffer reads back in order and the titles follow
+	p.Play()
+	events.waitState(player.StatePlaying)
+	resp, err := http.Get(backend.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 2000)
+	_, err = io.ReadFull(resp.Body, got)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range got {
+		if got[i] != audio[3000+i] {
+			t.Fatalf("byte %d of the buffer is %d, want %d", i, got[i], audio[3000+i])
+		}
+	}
+	// the title changes are coalesced when the backend reads past several marks at once
+	for title := events.nextTitle(); title != "Live"; title = events.nextTitle() {
+		if title != "Three" {
+			t.Fatalf("title %q while playing, want Three or Live", title)
+		}
+	}
+	seek(t, p, 0, 0)
+
+	seek(t, p, -1500*time.Millisecond, 1500*time.Millisecond)
+	err = p.JumpToLive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seek(t, p, 0, 0)
+	seek(t, p, time.Hour, 0)
+
+	p.Stop()
+	events.waitState(player.StateStopped)
+	p.State() // the buffer is closed after the state changed, by the time the run loop answers
+	if dir != "" {
+		files, _ := os.ReadDir(dir)
+		if len(files) != 0 {
+			t.Fatalf("%d files in the timeshift dir after stop, want none", len(files))
+		}
+	}
+}
+
+func TestTimeshiftDisabled(t *testing.T) {
+	p, _, _, events := newTestPlayer(t)
+	p.SetChannel(newChannel(t, "ch", "_a"))
+	events.waitState(player.StatePlaying)
+	if _, err := p.Seek(-time.Second); !errors.Is(err, player.ErrNoTimeshift) {
+		t.Fatalf("seek error %v, want no timeshift", err)
+	}
+	if err := p.JumpToLive(); !errors.Is(err, player.ErrNoTimeshift) {
+		t.Fatalf("jump to live error %v, want no timeshift", err)
+	}
+}
+
+// tapLog records what is read from a tap: the titles with the number of audio bytes before them, and the audio.
+type tapLog struct {
+	titles []string
+	audio  []byte
+}
+
+func (l *tapLog) onTitle(title string) {
+	l.titles = append(l.titles, fmt.Sprintf("%d %s", len(l.audio), title))
+}
+
+// read reads n bytes of audio from the tap.
+func (l *tapLog) read(t *testing.T, tap *player.StreamTap, n int) {
+	t.Helper()
+	buf := make([]byte, 64)
+	for len(l.audio) < n {
+		m, err := tap.Read(buf)
+		if err != nil {
+			t.Fatalf("read %d bytes of %d: %v", len(l.audio), n, err)
+		}
+		l.audio = append(l.audio, buf[:m]...)
+	}
+}
+
+func TestPlayerTap(t *testing.T) {
+	p, _, _, events := newTestPlayer(t)
+
+	// the tap starts after the first 200 bytes of audio, in the title Before
+	const metaint = 100
+	audio := testAudio(400)
+	stream := icyStream(audio, metaint,
+		icyBlock("StreamTitle='Before';"), icyBlock(""), icyBlock("StreamTitle='After';"))
+	split := 2*metaint + len(icyBlock("StreamTitle='Before';"))
+	data := make(chan []byte, 1)
+	data <- stream[:split]
+	ch := newStreamChannel(t, streamHeader(metaint), data)
+
+	other := newChannel(t, "other", "_a")
+	if _, ok := p.Tap(ch, nil); ok {
+		t.Fatal("tap of a channel that isn't played")
+	}
+	p.SetTimeshift(time.Minute, "")
+	p.SetChannel(ch)
+	events.waitState(player.StatePlaying)
+	if _, ok := p.Tap(other, nil); ok {
+		t.Fatal("tap of another channel than the one that is played")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for behind, _ := p.Seek(-time.Hour); behind != 200*time.Millisecond; behind, _ = p.Seek(-time.Hour) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%v of the stream was buffered, want 200ms", behind)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var log tapLog
+	tap, ok := p.Tap(ch, log.onTitle)
+	if !ok {
+		t.Fatal("no tap of the channel that is played")
+	}
+	if tap.ContentType() != "audio/mpeg" || !tap.Metadata() {
+		t.Fatalf("tap of %q with metadata %v", tap.ContentType(), tap.Metadata())
+	}
+	data <- stream[split:]
+	log.read(t, tap, 200)
+	if !bytes.Equal(log.audio, audio[200:]) {
+		t.Fatalf("tapped audio % x, want % x", log.audio, audio[200:])
+	}
+	if want := []string{"0 Before", "100 After"}; !reflect.DeepEqual(log.titles, want) {
+		t.Fatalf("titles %q, want %q", log.titles, want)
+	}
+
+	// the tap ends when the player closes the stream
+	p.Stop()
+	events.waitState(player.StateStopped)
+	if _, err := tap.Read(make([]byte, 10)); err != player.ErrTapClosed {
+		t.Fatalf("read error %v after stop, want tap closed", err)
+	}
+}
+
+func TestStreamTapClose(t *testing.T) {
+	p, _, _, events := newTestPlayer(t)
+	ch := newStreamChannel(t, streamHeader(0), make(chan []byte))
+	p.SetTimeshift(time.Minute, "")
+	p.SetChannel(ch)
+	events.waitState(player.StatePlaying)
+	tap, ok := p.Tap(ch, nil)
+	if !ok {
+		t.Fatal("no tap")
+	}
+	if tap.Metadata() {
+		t.Fatal("metadata without metaint")
+	}
+
+	// a Read that waits for the stream returns when the tap is closed
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		tap.Close()
+	}()
+	if _, err := tap.Read(make([]byte, 10)); err != player.ErrTapClosed {
+		t.Fatalf("read error %v after close, want tap closed", err)
+	}
+}
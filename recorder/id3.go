@@ -0,0 +1,79 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Tag holds the metadata that is written to a recorded file.
+type Tag struct {
+	Title   string
+	Artist  string
+	Album   string
+	Comment string
+
+	// Art is the cover image, ArtMIME its type, e.g. image/jpeg.
+	Art     []byte
+	ArtMIME string
+}
+
+// id3 text encoding and picture type values, see https://id3.org/id3v2.4.0-frames
+const (
+	id3EncodingUTF8     = 3
+	id3PictureTypeCover = 3
+)
+
+// WriteID3 writes the tag as an ID3v2.4 tag, which goes at the start of the file.
+// Players read ID3 tags from mp3 files and from raw aac (ADTS) files, which is what the streams send.
+func (t *Tag) WriteID3(w io.Writer) error {
+	var frames bytes.Buffer
+	text := func(id, value string) {
+		if value == "" {
+			return
+		}
+		writeID3Frame(&frames, id, append([]byte{id3EncodingUTF8}, value...))
+	}
+	text("TIT2", t.Title)
+	text("TPE1", t.Artist)
+	text("TALB", t.Album)
+	if t.Comment != "" {
+		// encoding, language, empty description, text
+		comment := append([]byte{id3EncodingUTF8, 'e', 'n', 'g', 0}, t.Comment...)
+		writeID3Frame(&frames, "COMM", comment)
+	}
+	if len(t.Art) > 0 {
+		// encoding, mime type, picture type, empty description, picture data
+		var picture bytes.Buffer
+		picture.WriteByte(id3EncodingUTF8)
+		picture.WriteString(t.ArtMIME)
+		picture.WriteByte(0)
+		picture.WriteByte(id3PictureTypeCover)
+		picture.WriteByte(0)
+		picture.Write(t.Art)
+		writeID3Frame(&frames, "APIC", picture.Bytes())
+	}
+
+	header := []byte{'I', 'D', '3', 4, 0, 0}
+	header = append(header, syncsafe(frames.Len())...)
+	_, err := w.Write(header)
+	if err != nil {
+		return err
+	}
+	_, err = frames.WriteTo(w)
+	return err
+}
+
+func writeID3Frame(w *bytes.Buffer, id string, data []byte) {
+	w.WriteString(id)
+	w.Write(syncsafe(len(data)))
+	w.Write([]byte{0, 0}) // flags
+	w.Write(data)
+}
+
+// syncsafe encodes a size in 4 bytes of 7 bits each, as ID3v2.4 sizes are.
+func syncsafe(size int) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(size&0x7f|(size&0x3f80)<<1|(size&0x1fc000)<<2|(size&0xfe00000)<<3))
+	return b[:]
+}
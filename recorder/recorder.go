@@ -0,0 +1,564 @@
+// Package recorder records AudioAddict channels to disk, with a file per track.
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/GeertJohan/tune/api"
+	"github.com/GeertJohan/tune/player"
+)
+
+const (
+	// partExt is added to a file while it is being recorded, the tag is written when it's complete.
+	partExt = ".part"
+
+	// minTrackPoll is the minimum time between polls of the track history.
+	minTrackPoll = 5 * time.Second
+
+	// maxArtSize is the largest cover image that is embedded in a file.
+	maxArtSize = 5 << 20
+
+	// maxNameLength is the maximum number of characters in a file name, without extension.
+	maxNameLength = 200
+
+	// maxFinishing is the number of recorded files that wait to be tagged before the recording waits for them.
+	maxFinishing = 8
+)
+
+// ErrNoStreams ends the recording when the channel has no stream urls.
+var ErrNoStreams = errors.New("channel has no streams")
+
+// the track history, replaced in tests
+var (
+	currentTrack  = (*api.Channel).CurrentTrack
+	trackForTitle = (*api.Channel).TrackForTitle
+)
+
+// Options configure a Recorder.
+type Options struct {
+	// Dir is the folder the files are written to, it is created when needed.
+	Dir string
+
+	// MaxDuration stops the recording after this long, 0 means no limit.
+	MaxDuration time.Duration
+
+	// MaxSize stops the recording after this many bytes of audio, 0 means no limit.
+	MaxSize int64
+
+	// OnFile, when set, is called with the path of each file that was completed.
+	// It is called from the goroutine that tags the files, not from the one that records the stream.
+	OnFile func(path string)
+
+	// Player, when set, is tapped for the stream of the channel while it plays the channel with timeshift,
+	// so the stream isn't received twice.
+	Player *player.Player
+}
+
+// Recorder records a channel. It records the stream that the Player receives when it plays the channel, and
+// connects to the stream itself otherwise, or when the Player stops playing the channel.
+// The stream is split in files at track boundaries. These are taken from the ICY metadata in the stream, or from
+// the track history when the stream has no metadata. Files are named "Artist - Title" and tagged with ID3.
+// The first file starts in the middle of a track, so does the last file end.
+type Recorder struct {
+	account *api.Account
+	channel *api.Channel
+	opts    Options
+	client  *http.Client
+
+	cancel   context.CancelFunc
+	chDone   chan struct{}
+	chFinish chan *recording // recorded files, to be tagged by the finishing goroutine
+
+	lock  sync.Mutex
+	err   error
+	files []string
+
+	// owned by the recording goroutine
+	cur      *recording
+	size     int64
+	title    string
+	ext      string // of the stream that is recorded
+	splitErr error  // from a split at a stream title
+}
+
+// source is a stream that is recorded, the stream titles are passed to onTitle from Read.
+type source struct {
+	audio       io.Reader
+	close       func()
+	contentType string
+	metadata    bool // whether the stream has titles
+	tapped      bool // whether it is the stream of the Player
+}
+
+// recording is a file that is being recorded.
+type recording struct {
+	path  string // without partExt
+	file  *os.File
+	title string     // stream title
+	track *api.Track // nil when the track isn't known yet
+}
+
+// Start starts recording the channel in the background, it doesn't wait for the stream.
+// An error while connecting to the stream ends the recording, it is returned by Err.
+func Start(account *api.Account, channel *api.Channel, opts Options) (*Recorder, error) {
+	err := os.MkdirAll(opts.Dir, 0755)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create recordings folder")
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if opts.MaxDuration > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), opts.MaxDuration)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	r := &Recorder{
+		account:  account,
+		channel:  channel,
+		opts:     opts,
+		client:   &http.Client{},
+		cancel:   cancel,
+		chDone:   make(chan struct{}),
+		chFinish: make(chan *recording, maxFinishing),
+	}
+	go r.run(ctx)
+	return r, nil
+}
+
+// Stop stops the recording and waits until the last file is complete.
+// It returns the error that ended the recording, if any.
+func (r *Recorder) Stop() error {
+	r.cancel()
+	<-r.chDone
+	return r.Err()
+}
+
+// Done returns a channel that is closed when the recording has ended, by Stop, a limit or an error.
+func (r *Recorder) Done() <-chan struct{} {
+	return r.chDone
+}
+
+// Err returns the error that ended the recording. It is nil while recording, and when it was stopped or hit a limit.
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+// Files returns the paths of the completed files, in order.
+func (r *Recorder) Files() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.files...)
+}
+
+// Channel returns the channel that is recorded.
+func (r *Recorder) Channel() *api.Channel {
+	return r.channel
+}
+
+func (r *Recorder) run(ctx context.Context) {
+	defer close(r.chDone)
+	defer r.cancel()
+
+	chFinished := make(chan error, 1)
+	go func() {
+		chFinished <- r.finishAll()
+	}()
+
+	err := r.record(ctx)
+	if ctx.Err() != nil {
+		err = nil // stopped, the duration limit was reached, or finishing failed
+	}
+	if r.cur != nil {
+		r.chFinish <- r.cur
+		r.cur = nil
+	}
+	close(r.chFinish)
+	ferr := <-chFinished
+	if err == nil {
+		err = ferr
+	}
+	r.lock.Lock()
+	r.err = err
+	r.lock.Unlock()
+}
+
+// open returns the stream of the Player when it plays the channel, and connects to the stream otherwise.
+// The source is closed when ctx is done.
+func (r *Recorder) open(ctx context.Context, tap bool) (*source, error) {
+	if tap && r.opts.Player != nil {
+		if t, ok := r.opts.Player.Tap(r.channel, r.onTitle); ok {
+			done := make(chan struct{})
+			go func() {
+				select {
+				case <-ctx.Done():
+					t.Close()
+				case <-done:
+				}
+			}()
+			return &source{
+				audio:       t,
+				close:       func() { close(done); t.Close() },
+				contentType: t.ContentType(),
+				metadata:    t.Metadata(),
+				tapped:      true,
+			}, nil
+		}
+	}
+	return r.connect(ctx)
+}
+
+// connect connects to a stream of the channel.
+func (r *Recorder) connect(ctx context.Context) (*source, error) {
+	streamURLs, err := r.channel.StreamURLs(r.account)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get stream urls")
+	}
+	if len(streamURLs) == 0 {
+		return nil, ErrNoStreams
+	}
+	req, err := http.NewRequest("GET", streamURLs[0], nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create stream request")
+	}
+	player.RequestICYMetadata(req)
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to stream")
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("stream responded with status %s", resp.Status)
+	}
+	metaint := player.ICYMetaInt(resp.Header)
+	return &source{
+		audio:       player.NewICYReader(resp.Body, metaint, r.onTitle),
+		close:       func() { resp.Body.Close() },
+		contentType: resp.Header.Get("Content-Type"),
+		metadata:    metaint > 0,
+	}, nil
+}
+
+// onTitle splits the recording when the stream title changed.
+// In a stream with metadata the audio before the first title is left out, because its title isn't known.
+func (r *Recorder) onTitle(title string) {
+	if (title != r.title || r.cur == nil) && r.splitErr == nil {
+		r.splitErr = r.split(title, nil)
+	}
+}
+
+// record copies the stream to files, starting a new file when the track changes.
+// When the Player stops playing the channel, the recording continues with its own connection to the stream.
+func (r *Recorder) record(ctx context.Context) error {
+	src, err := r.open(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if src != nil {
+			src.close()
+		}
+	}()
+	r.ext = extension(src.contentType)
+
+	// without metadata the track history is polled, the first track is known before recording starts
+	var chTracks chan *api.Track
+	if !src.metadata {
+		chTracks = make(chan *api.Track, 1)
+		track, err := currentTrack(r.channel)
+		if err == nil {
+			err = r.split(track.Name, track)
+			if err != nil {
+				return err
+			}
+		}
+		go r.pollTracks(ctx, track, chTracks)
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.audio.Read(buf)
+		if r.splitErr != nil {
+			return r.splitErr
+		}
+		select {
+		case track := <-chTracks:
+			serr := r.split(track.Name, track)
+			if serr != nil {
+				return serr
+			}
+		default:
+		}
+
+		if n > 0 && r.cur == nil && chTracks != nil {
+			// the track history wasn't available, record without a title
+			serr := r.split("", nil)
+			if serr != nil {
+				return serr
+			}
+		}
+		if n > 0 && r.cur != nil {
+			data := buf[:n]
+			limited := r.opts.MaxSize > 0 && r.size+int64(n) >= r.opts.MaxSize
+			if limited {
+				data = data[:r.opts.MaxSize-r.size]
+			}
+			_, werr := r.cur.file.Write(data)
+			if werr != nil {
+				return errors.Wrap(werr, "failed to write recording")
+			}
+			r.size += int64(len(data))
+			if limited {
+				return nil
+			}
+		}
+		if src.tapped && err != nil && ctx.Err() == nil {
+			// the Player stopped playing the channel or fell behind, continue in the current file
+			src.close()
+			src, err = r.open(ctx, false)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err == io.EOF {
+			return errors.New("stream ended")
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read stream")
+		}
+	}
+}
+
+// pollTracks sends the current track from the track history on chTracks whenever it changed.
+func (r *Recorder) pollTracks(ctx context.Context, last *api.Track, chTracks chan *api.Track) {
+	wait := minTrackPoll
+	for {
+		if last != nil {
+			left := time.Unix(int64(last.Started+last.Duration), 0).Sub(time.Now())
+			if left > wait {
+				wait = left
+			}
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+		wait = minTrackPoll
+
+		track, err := currentTrack(r.channel)
+		if err != nil || (last != nil && track.TrackID == last.TrackID && track.Started == last.Started) {
+			continue
+		}
+		last = track
+		select {
+		case chTracks <- track:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// split hands the current file to the finishing goroutine and starts a new one for the track with given stream title.
+func (r *Recorder) split(title string, track *api.Track) error {
+	if r.cur != nil {
+		r.chFinish <- r.cur
+		r.cur = nil
+	}
+	r.title = title
+
+	name := title
+	if track != nil && track.Artist != "" && track.Title != "" {
+		name = track.Artist + " - " + track.Title
+	}
+	if name == "" {
+		name = r.channel.Name + " " + time.Now().Format("2006-01-02 15-04-05")
+	}
+	path, file, err := createUnique(r.opts.Dir, sanitizeName(name), r.ext)
+	if err != nil {
+		return errors.Wrap(err, "failed to create recording file")
+	}
+	r.cur = &recording{
+		path:  path,
+		file:  file,
+		title: title,
+		track: track,
+	}
+	return nil
+}
+
+// finishAll finishes the recorded files until chFinish is closed. The first error stops the recording,
+// the files that were recorded before are still finished.
+func (r *Recorder) finishAll() error {
+	var ferr error
+	for cur := range r.chFinish {
+		err := r.finish(cur)
+		if err != nil && ferr == nil {
+			ferr = err
+			r.cancel()
+		}
+	}
+	return ferr
+}
+
+// finish completes a recorded file: it writes the tag followed by the recorded audio.
+func (r *Recorder) finish(cur *recording) error {
+	partPath := cur.file.Name()
+	defer os.Remove(partPath)
+
+	_, err := cur.file.Seek(0, io.SeekStart)
+	if err != nil {
+		cur.file.Close()
+		return errors.Wrap(err, "failed to read recording")
+	}
+	defer cur.file.Close()
+
+	// the track history is updated a little later than the stream, by now it has the track
+	track := cur.track
+	if track == nil && cur.title != "" {
+		track, _ = trackForTitle(r.channel, cur.title)
+	}
+	tag := r.tag(cur.title, track)
+
+	file, err := os.OpenFile(cur.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to create recorded file")
+	}
+	err = tag.WriteID3(file)
+	if err == nil {
+		_, err = io.Copy(file, cur.file)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(cur.path)
+		return errors.Wrap(err, "failed to write recorded file")
+	}
+	err = file.Close()
+	if err != nil {
+		return errors.Wrap(err, "failed to write recorded file")
+	}
+
+	r.lock.Lock()
+	r.files = append(r.files, cur.path)
+	r.lock.Unlock()
+	if r.opts.OnFile != nil {
+		r.opts.OnFile(cur.path)
+	}
+	return nil
+}
+
+// tag creates the tag for a file, from the track when it is known and from the stream title otherwise.
+func (r *Recorder) tag(title string, track *api.Track) *Tag {
+	tag := &Tag{
+		Comment: fmt.Sprintf("Recorded from %s on %s", r.channel.Name, r.channel.Network.Name),
+	}
+	if track == nil {
+		// stream titles are "Artist - Title"
+		parts := strings.SplitN(title, " - ", 2)
+		if len(parts) == 2 {
+			tag.Artist, tag.Title = parts[0], parts[1]
+		} else {
+			tag.Title = title
+		}
+		return tag
+	}
+	tag.Title = track.Title
+	tag.Artist = track.Artist
+	tag.Album = track.Release
+	if track.ArtURL != "" {
+		tag.Art, tag.ArtMIME = r.fetchArt(track)
+	}
+	return tag
+}
+
+// fetchArt downloads the cover image of a track, a file is tagged without art when it can't be downloaded.
+func (r *Recorder) fetchArt(track *api.Track) ([]byte, string) {
+	url := track.ArtURL
+	if strings.HasPrefix(url, "//") {
+		url = track.ArtURLHTTPS()
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, ""
+	}
+	art, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxArtSize+1))
+	if err != nil || len(art) > maxArtSize {
+		return nil, ""
+	}
+	mime := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(mime, "image/") {
+		mime = http.DetectContentType(art)
+	}
+	return art, mime
+}
+
+// extension returns the file extension for the content type of a stream.
+func extension(contentType string) string {
+	switch strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]) {
+	case "audio/aac", "audio/aacp", "audio/x-aac":
+		return ".aac"
+	case "audio/ogg", "application/ogg":
+		return ".ogg"
+	default:
+		return ".mp3"
+	}
+}
+
+// sanitizeName makes a track name safe to use as a file name on all platforms.
+func sanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 32 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > maxNameLength {
+		name = string(runes[:maxNameLength])
+	}
+	name = strings.Trim(name, " .")
+	if name == "" {
+		name = "recording"
+	}
+	return name
+}
+
+// createUnique creates the part file for a new recording, numbering the name when a file with it exists.
+// It returns the path of the completed file and the open part file.
+func createUnique(dir, name, ext string) (string, *os.File, error) {
+	for i := 1; ; i++ {
+		path := filepath.Join(dir, name+ext)
+		if i > 1 {
+			path = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", name, i, ext))
+		}
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		file, err := os.OpenFile(path+partExt, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		return path, file, nil
+	}
+}
@@ -0,0 +1,541 @@
+package recorder
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GeertJohan/tune/api"
+	"github.com/GeertJohan/tune/player"
+	"github.com/GeertJohan/tune/player/playertest"
+)
+
+func TestSanitizeName(t *testing.T) {
+	long := string(bytes.Repeat([]byte("é"), maxNameLength+10))
+	tests := []struct {
+		name, want string
+	}{
+		{"Artist - Title", "Artist - Title"},
+		{`AC/DC - What? "Yes" <No> | a\b: c*`, `AC_DC - What_ _Yes_ _No_ _ a_b_ c_`},
+		{"tab\there\x00", "tab_here_"},
+		{" .hidden. ", "hidden"},
+		{"...", "recording"},
+		{"", "recording"},
+		{long, long[:2*maxNameLength]},
+	}
+	for _, test := range tests {
+		if got := sanitizeName(test.name); got != test.want {
+			t.Errorf("sanitizeName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCreateUnique(t *testing.T) {
+	dir := t.TempDir()
+	create := func() string {
+		t.Helper()
+		path, file, err := createUnique(dir, "name", ".mp3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+		if file.Name() != path+partExt {
+			t.Fatalf("part file %s for %s", file.Name(), path)
+		}
+		return filepath.Base(path)
+	}
+
+	if name := create(); name != "name.mp3" {
+		t.Fatalf("first file %s", name)
+	}
+	// the part file of a recording takes the name, so does a completed file
+	if name := create(); name != "name (2).mp3" {
+		t.Fatalf("second file %s", name)
+	}
+	os.Rename(filepath.Join(dir, "name (2).mp3.part"), filepath.Join(dir, "name (2).mp3"))
+	if name := create(); name != "name (3).mp3" {
+		t.Fatalf("third file %s", name)
+	}
+}
+
+func TestExtension(t *testing.T) {
+	tests := map[string]string{
+		"audio/mpeg":                ".mp3",
+		"audio/aacp":                ".aac",
+		"audio/aac; charset=binary": ".aac",
+		"audio/x-aac":               ".aac",
+		"application/ogg":           ".ogg",
+		"":                          ".mp3",
+	}
+	for contentType, want := range tests {
+		if got := extension(contentType); got != want {
+			t.Errorf("extension(%q) = %q, want %q", contentType, got, want)
+		}
+	}
+}
+
+func TestSyncsafe(t *testing.T) {
+	tests := map[int][]byte{
+		0:         {0, 0, 0, 0},
+		0x7f:      {0, 0, 0, 0x7f},
+		0x80:      {0, 0, 1, 0},
+		0x3fff:    {0, 0, 0x7f, 0x7f},
+		0x4000:    {0, 1, 0, 0},
+		0xfffffff: {0x7f, 0x7f, 0x7f, 0x7f},
+	}
+	for size, want := range tests {
+		if got := syncsafe(size); !bytes.Equal(got, want) {
+			t.Errorf("syncsafe(%#x) = % x, want % x", size, got, want)
+		}
+	}
+}
+
+// readID3 decodes the ID3v2.4 tag at the start of a file, it returns the frames by id and the data after the tag.
+func readID3(t *testing.T, data []byte) (map[string][]byte, []byte) {
+	t.Helper()
+	unsyncsafe := func(b []byte) int {
+		return int(b[0])<<21 | int(b[1])<<14 | int(b[2])<<7 | int(b[3])
+	}
+	if len(data) < 10 || string(data[:3]) != "ID3" || data[3] != 4 {
+		t.Fatalf("no ID3v2.4 tag at % x", data[:10])
+	}
+	size := unsyncsafe(data[6:10])
+	tag, rest := data[10:10+size], data[10+size:]
+	frames := make(map[string][]byte)
+	for len(tag) > 0 {
+		id, size := string(tag[:4]), unsyncsafe(tag[4:8])
+		frames[id] = tag[10 : 10+size]
+		tag = tag[10+size:]
+	}
+	return frames, rest
+}
+
+// frameText returns the text of a frame, which follows the encoding byte.
+func frameText(t *testing.T, frames map[string][]byte, id string) string {
+	t.Helper()
+	frame := frames[id]
+	if len(frame) == 0 {
+		return ""
+	}
+	if frame[0] != id3EncodingUTF8 {
+		t.Fatalf("%s frame with encoding %d", id, frame[0])
+	}
+	return string(frame[1:])
+}
+
+func TestWriteID3(t *testing.T) {
+	tag := &Tag{
+		Title:   "Tïtle",
+		Artist:  "Artist",
+		Comment: "Recorded",
+		Art:     bytes.Repeat([]byte{0xff, 0xd8}, 100), // larger than a syncsafe byte
+		ArtMIME: "image/jpeg",
+	}
+	var buf bytes.Buffer
+	err := tag.WriteID3(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, rest := readID3(t, buf.Bytes())
+	if len(rest) != 0 {
+		t.Fatalf("%d bytes after the tag", len(rest))
+	}
+
+	// frames without value are left out
+	ids := make([]string, 0, len(frames))
+	for id := range frames {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if want := []string{"APIC", "COMM", "TIT2", "TPE1"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("frames %q, want %q", ids, want)
+	}
+	if title := frameText(t, frames, "TIT2"); title != tag.Title {
+		t.Errorf("title %q", title)
+	}
+	if artist := frameText(t, frames, "TPE1"); artist != tag.Artist {
+		t.Errorf("artist %q", artist)
+	}
+	if comment := frameText(t, frames, "COMM"); comment != "eng\x00Recorded" {
+		t.Errorf("comment %q", comment)
+	}
+	wantPicture := append([]byte("\x03image/jpeg\x00\x03\x00"), tag.Art...)
+	if picture := frames["APIC"]; !bytes.Equal(picture, wantPicture) {
+		t.Errorf("picture % x, want % x", picture, wantPicture)
+	}
+}
+
+// icyBlock returns a metadata block with the title, an empty title gives an empty block.
+func icyBlock(title string) []byte {
+	content := ""
+	if title != "" {
+		content = fmt.Sprintf("StreamTitle='%s';", title)
+	}
+	length := (len(content) + 15) / 16
+	block := make([]byte, 1+length*16)
+	block[0] = byte(length)
+	copy(block[1:], content)
+	return block
+}
+
+// icyStream interleaves the audio with blocks of the titles, a block after every metaint bytes of audio.
+func icyStream(audio []byte, metaint int, titles ...string) []byte {
+	var stream []byte
+	for _, title := range titles {
+		stream = append(stream, audio[:metaint]...)
+		stream = append(stream, icyBlock(title)...)
+		audio = audio[metaint:]
+	}
+	return append(stream, audio...)
+}
+
+func testAudio(n int) []byte {
+	audio := make([]byte, n)
+	for i := range audio {
+		audio[i] = byte(i%251) + 1
+	}
+	return audio
+}
+
+// testStream is a channel with a live stream at 1000 bytes a second, with a metadata block every metaint bytes.
+type testStream struct {
+	channel     *api.Channel
+	url         string
+	connections int32 // to the stream
+}
+
+// newTestStream serves the stream of a channel. The data for the nth connection to the stream is sent on conns[n],
+// the stream stays open after it is closed. It serves a cover image at /art.jpg too.
+func newTestStream(t *testing.T, metaint int, conns ...<-chan []byte) *testStream {
+	s := &testStream{}
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/art.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write([]byte("jpeg"))
+			return
+		case "/stream":
+		default:
+			fmt.Fprintf(w, "[%q]", s.url+"/stream")
+			return
+		}
+		n := atomic.AddInt32(&s.connections, 1)
+		if int(n) > len(conns) {
+			t.Errorf("connection %d to the stream", n)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		chunks := conns[n-1]
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("Icy-Br", "8")
+		w.Header().Set("Icy-Metaint", fmt.Sprint(metaint))
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case chunk, ok := <-chunks:
+				if !ok {
+					chunks = nil
+					continue
+				}
+				w.Write(chunk)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			case <-done:
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(done) })
+	s.url = srv.URL
+	s.channel = &api.Channel{
+		Network:    &api.Network{Name: "Test FM", ListenURLBase: srv.URL},
+		Streamlist: &api.Streamlist{Key: "mp3"},
+		Key:        "live",
+		Name:       "Live",
+	}
+	return s
+}
+
+// chunks returns a closed channel with the chunks on it.
+func chunks(data ...[]byte) <-chan []byte {
+	ch := make(chan []byte, len(data))
+	for _, chunk := range data {
+		ch <- chunk
+	}
+	close(ch)
+	return ch
+}
+
+// stubTracks replaces the track history until the end of the test.
+func stubTracks(t *testing.T, forTitle func(title string) (*api.Track, error)) {
+	current, byTitle := currentTrack, trackForTitle
+	currentTrack = func(*api.Channel) (*api.Track, error) {
+		return nil, api.ErrNoTracklist
+	}
+	trackForTitle = func(_ *api.Channel, title string) (*api.Track, error) {
+		return forTitle(title)
+	}
+	t.Cleanup(func() { currentTrack, trackForTitle = current, byTitle })
+}
+
+func noTracks(string) (*api.Track, error) {
+	return nil, api.ErrNoTrackMatch
+}
+
+// waitUntil waits until cond is true.
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting until %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// fileSize returns the size of a file, -1 when it doesn't exist.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return -1
+	}
+	return info.Size()
+}
+
+// wait waits until the recording has ended by itself.
+func wait(t *testing.T, rec *Recorder) {
+	t.Helper()
+	select {
+	case <-rec.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("recording didn't end")
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readRecording returns the tag frames and the audio of a recorded file.
+func readRecording(t *testing.T, path string) (map[string][]byte, []byte) {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return readID3(t, data)
+}
+
+// checkDir checks that the completed files are in dir, and nothing else.
+func checkDir(t *testing.T, dir string, files []string, want ...string) {
+	t.Helper()
+	var names []string
+	for _, path := range files {
+		names = append(names, filepath.Base(path))
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("files %q, want %q", names, want)
+	}
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != len(want) {
+		t.Fatalf("%d files in the folder, want %d", len(entries), len(want))
+	}
+}
+
+func TestRecord(t *testing.T) {
+	// the audio before the first title isn't recorded, the empty block doesn't split
+	const metaint = 100
+	audio := testAudio(500)
+	stream := newTestStream(t, metaint, chunks(icyStream(audio, metaint, "A - One", "", "B - Two", "")))
+
+	// files are named after the stream title, finishing a file doesn't hold up the recording of the next one
+	dir := t.TempDir()
+	release := make(chan struct{})
+	stubTracks(t, func(title string) (*api.Track, error) {
+		if title != "A - One" {
+			return nil, api.ErrNoTrackMatch
+		}
+		<-release
+		return &api.Track{Artist: "Artist A", Title: "One", Release: "Album", ArtURL: stream.url + "/art.jpg"}, nil
+	})
+	var onFile []string
+	rec, err := Start(nil, stream.channel, Options{
+		Dir:     dir,
+		MaxSize: 400,
+		OnFile:  func(path string) { onFile = append(onFile, path) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, "the second track is recorded", func() bool {
+		return fileSize(filepath.Join(dir, "B - Two.mp3.part")) == 200
+	})
+	close(release)
+	wait(t, rec)
+
+	files := rec.Files()
+	checkDir(t, dir, files, "A - One.mp3", "B - Two.mp3")
+	if !reflect.DeepEqual(onFile, files) {
+		t.Fatalf("OnFile with %q, want %q", onFile, files)
+	}
+
+	frames, recorded := readRecording(t, files[0])
+	if !bytes.Equal(recorded, audio[100:300]) {
+		t.Errorf("first file has % x", recorded)
+	}
+	if title, artist, album := frameText(t, frames, "TIT2"), frameText(t, frames, "TPE1"), frameText(t, frames, "TALB"); title != "One" || artist != "Artist A" || album != "Album" {
+		t.Errorf("first file tagged %q by %q on %q", title, artist, album)
+	}
+	if comment := frameText(t, frames, "COMM"); comment != "eng\x00Recorded from Live on Test FM" {
+		t.Errorf("comment %q", comment)
+	}
+	if picture := frames["APIC"]; !bytes.HasSuffix(picture, []byte("image/jpeg\x00\x03\x00jpeg")) {
+		t.Errorf("picture % x", picture)
+	}
+
+	// without track the tag comes from the stream title
+	frames, recorded = readRecording(t, files[1])
+	if !bytes.Equal(recorded, audio[300:500]) {
+		t.Errorf("second file has % x", recorded)
+	}
+	if title, artist := frameText(t, frames, "TIT2"), frameText(t, frames, "TPE1"); title != "Two" || artist != "B" {
+		t.Errorf("second file tagged %q by %q", title, artist)
+	}
+	if _, ok := frames["APIC"]; ok {
+		t.Error("picture without track")
+	}
+}
+
+func TestRecordMaxSize(t *testing.T) {
+	const metaint = 100
+	audio := testAudio(500)
+	stream := newTestStream(t, metaint, chunks(icyStream(audio, metaint, "A - One", "", "B - Two", "")))
+	stubTracks(t, noTracks)
+
+	dir := t.TempDir()
+	rec, err := Start(nil, stream.channel, Options{Dir: dir, MaxSize: 250})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, rec)
+
+	files := rec.Files()
+	checkDir(t, dir, files, "A - One.mp3", "B - Two.mp3")
+	if _, recorded := readRecording(t, files[1]); !bytes.Equal(recorded, audio[300:350]) {
+		t.Errorf("last file has % x, want the audio up to the limit", recorded)
+	}
+}
+
+func TestRecordStop(t *testing.T) {
+	const metaint = 100
+	audio := testAudio(300)
+	stream := newTestStream(t, metaint, chunks(icyStream(audio, metaint, "A - One", "")))
+	stubTracks(t, noTracks)
+
+	dir := t.TempDir()
+	rec, err := Start(nil, stream.channel, Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, "the track is recorded", func() bool {
+		return fileSize(filepath.Join(dir, "A - One.mp3.part")) == 200
+	})
+	err = rec.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file that was being recorded is completed
+	files := rec.Files()
+	checkDir(t, dir, files, "A - One.mp3")
+	if _, recorded := readRecording(t, files[0]); !bytes.Equal(recorded, audio[100:]) {
+		t.Errorf("file has % x", recorded)
+	}
+}
+
+func TestRecordNoStreams(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "[]")
+	}))
+	defer srv.Close()
+	channel := &api.Channel{
+		Network:    &api.Network{ListenURLBase: srv.URL},
+		Streamlist: &api.Streamlist{Key: "mp3"},
+		Key:        "live",
+	}
+
+	// Start doesn't connect, the recording ends with the error
+	rec, err := Start(nil, channel, Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-rec.Done()
+	if err := rec.Err(); err != ErrNoStreams {
+		t.Fatalf("error %v, want ErrNoStreams", err)
+	}
+}
+
+func TestRecordTap(t *testing.T) {
+	// the player receives the first 200 bytes of audio before the recording starts, in track A,
+	// the recording takes the next 100 bytes from the player and then connects itself
+	const metaint = 100
+	audio := testAudio(600)
+	playerConn := make(chan []byte, 1)
+	playerConn <- icyStream(audio[:200], metaint, "A - One")
+	recorderConn := make(chan []byte, 1)
+	stream := newTestStream(t, metaint, playerConn, recorderConn)
+	stubTracks(t, noTracks)
+
+	p := player.NewPlayerWithBackend(nil, playertest.NewFake())
+	defer p.Close()
+	p.SetTimeshift(time.Minute, "")
+	p.SetChannel(stream.channel)
+	waitUntil(t, "the player received the stream", func() bool {
+		behind, _ := p.Seek(-time.Hour)
+		return behind == 200*time.Millisecond
+	})
+
+	dir := t.TempDir()
+	rec, err := Start(nil, stream.channel, Options{Dir: dir, MaxSize: 400, Player: p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rec.Stop()
+	part := filepath.Join(dir, "A - One.mp3.part")
+	waitUntil(t, "the recording started with the title of the player", func() bool {
+		return fileSize(part) == 0
+	})
+	playerConn <- append(icyBlock(""), audio[200:300]...)
+	waitUntil(t, "the audio of the player is recorded", func() bool {
+		return fileSize(part) == 100
+	})
+	if n := atomic.LoadInt32(&stream.connections); n != 1 {
+		t.Fatalf("%d connections to the stream while the player plays it, want 1", n)
+	}
+
+	// the stream of the recorder starts in track A too
+	p.Stop()
+	recorderConn <- icyStream(audio[300:600], metaint, "A - One", "B - Two")
+	wait(t, rec)
+
+	files := rec.Files()
+	checkDir(t, dir, files, "A - One.mp3", "B - Two.mp3")
+	if _, recorded := readRecording(t, files[0]); !bytes.Equal(recorded, audio[200:500]) {
+		t.Errorf("first file has % x", recorded)
+	}
+	if _, recorded := readRecording(t, files[1]); !bytes.Equal(recorded, audio[500:600]) {
+		t.Errorf("second file has % x", recorded)
+	}
+}
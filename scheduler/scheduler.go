@@ -0,0 +1,236 @@
+// Package scheduler runs a schedule of channel and volume changes, such as a different channel in the morning and in
+// the afternoon, or a wake-up alarm that raises the volume.
+package scheduler
+
+import (
+	"sort"
+	"time"
+
+	"github.com/GeertJohan/tune/clock"
+)
+
+const (
+	// missedRunGrace is how late an entry still runs when tune wasn't running at its time, e.g. after a restart.
+	missedRunGrace = 15 * time.Minute
+
+	// maxWait is the longest the Scheduler waits before it looks at the clock again, the wall clock can jump after a
+	// suspend or a daylight saving change.
+	maxWait = time.Minute
+
+	// rampInterval is the time between the volume steps of a ramp.
+	rampInterval = 2 * time.Second
+)
+
+// Entry is a rule of the schedule.
+type Entry struct {
+	Name string
+	Spec *Spec
+
+	// Channel is the key of the channel to play, empty keeps the channel.
+	Channel string
+
+	// Volume is the volume to set, 0 keeps the volume.
+	Volume int
+
+	// Ramp raises the volume from 1 to Volume over this time, like a wake-up alarm.
+	Ramp time.Duration
+
+	// LastRun is when the entry ran last, the zero time when it never ran.
+	// A run that was missed since then is made up for when it was less than 15 minutes ago.
+	LastRun time.Time
+}
+
+// Next returns the time the entry runs next after t.
+func (e *Entry) Next(t time.Time) time.Time {
+	return e.Spec.Next(t.In(time.Local))
+}
+
+// Action is what the schedule wants done: play Channel when it isn't empty, and set Volume when it isn't 0.
+// When an entry runs, an Action with Run set is sent. A volume ramp follows with Actions that only set the Volume.
+type Action struct {
+	// Entry is the name of the entry.
+	Entry string
+
+	// Run is when the entry ran, it is the zero time for the steps of a ramp. Store it as the LastRun of the entry.
+	Run time.Time
+
+	Channel string
+	Volume  int
+}
+
+// Scheduler runs the entries of a schedule at their time, and sends the Actions to carry out.
+type Scheduler struct {
+	clk clock.Interface
+
+	chActions  chan Action
+	chEntries  chan []*Entry
+	chStopRamp chan struct{}
+	chClose    chan struct{}
+	chClosed   chan struct{}
+}
+
+// ramp raises the volume of the entry to volume.
+type ramp struct {
+	entry  string
+	start  time.Time
+	length time.Duration
+	volume int
+	sent   int // the last volume that was sent
+}
+
+// volumeAt returns the volume of the ramp at now.
+func (r *ramp) volumeAt(now time.Time) int {
+	passed := now.Sub(r.start)
+	if passed >= r.length {
+		return r.volume
+	}
+	return 1 + int(float64(r.volume-1)*float64(passed)/float64(r.length))
+}
+
+// New creates a Scheduler that runs the entries, time is taken from clk.
+func New(clk clock.Interface, entries []*Entry) *Scheduler {
+	s := &Scheduler{
+		clk: clk,
+
+		chActions:  make(chan Action),
+		chEntries:  make(chan []*Entry),
+		chStopRamp: make(chan struct{}),
+		chClose:    make(chan struct{}),
+		chClosed:   make(chan struct{}),
+	}
+	go s.run(entries)
+	return s
+}
+
+// run waits for the entries to be due, and hands out their actions.
+func (s *Scheduler) run(entries []*Entry) {
+	defer close(s.chClosed)
+
+	nexts := s.plan(entries)
+	var pending []Action
+	var r *ramp
+	for {
+		now := s.clk.Now()
+		for _, i := range due(nexts, now) {
+			e := entries[i]
+			action := Action{
+				Entry:   e.Name,
+				Run:     now,
+				Channel: e.Channel,
+				Volume:  e.Volume,
+			}
+			switch {
+			case e.Ramp > 0 && e.Volume > 1:
+				action.Volume = 1
+				r = &ramp{entry: e.Name, start: now, length: e.Ramp, volume: e.Volume, sent: 1}
+			case e.Volume > 0:
+				r = nil // the volume of this entry ends the ramp of an earlier one
+				pending = dropRampSteps(pending)
+			}
+			pending = append(pending, action)
+			nexts[i] = e.Next(now)
+		}
+		if r != nil {
+			// a step that wasn't taken yet is replaced by the next one
+			if volume := r.volumeAt(now); volume != r.sent {
+				pending = append(dropRampSteps(pending), Action{Entry: r.entry, Volume: volume})
+				r.sent = volume
+			}
+			if r.sent >= r.volume {
+				r = nil
+			}
+		}
+
+		wait := maxWait
+		for _, next := range nexts {
+			if !next.IsZero() && next.Sub(now) < wait {
+				wait = next.Sub(now)
+			}
+		}
+		if r != nil && rampInterval < wait {
+			wait = rampInterval
+		}
+		var chActions chan Action
+		var action Action
+		if len(pending) > 0 {
+			chActions = s.chActions
+			action = pending[0]
+		}
+
+		select {
+		case chActions <- action:
+			pending = pending[1:]
+		case <-s.clk.After(wait):
+		case entries = <-s.chEntries:
+			nexts = s.plan(entries)
+		case <-s.chStopRamp:
+			r = nil
+			pending = dropRampSteps(pending)
+		case <-s.chClose:
+			return
+		}
+	}
+}
+
+// plan returns the next run of each entry, a run since LastRun that is missed by less than missedRunGrace is due now.
+func (s *Scheduler) plan(entries []*Entry) []time.Time {
+	now := s.clk.Now()
+	nexts := make([]time.Time, len(entries))
+	for i, e := range entries {
+		from := now
+		if !e.LastRun.IsZero() {
+			from = now.Add(-missedRunGrace)
+			if e.LastRun.After(from) {
+				from = e.LastRun
+			}
+		}
+		nexts[i] = e.Next(from)
+	}
+	return nexts
+}
+
+// due returns the indexes of the entries that are due at now, in order of their time.
+func due(nexts []time.Time, now time.Time) []int {
+	var indexes []int
+	for i, next := range nexts {
+		if !next.IsZero() && !next.After(now) {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		return nexts[indexes[a]].Before(nexts[indexes[b]])
+	})
+	return indexes
+}
+
+// dropRampSteps removes the steps of a ramp from the actions, the actions of entry runs stay.
+func dropRampSteps(actions []Action) []Action {
+	kept := actions[:0]
+	for _, action := range actions {
+		if !action.Run.IsZero() {
+			kept = append(kept, action)
+		}
+	}
+	return kept
+}
+
+// Actions returns the channel that receives the actions when they are due.
+func (s *Scheduler) Actions() <-chan Action {
+	return s.chActions
+}
+
+// SetEntries replaces the entries of the schedule.
+func (s *Scheduler) SetEntries(entries []*Entry) {
+	s.chEntries <- entries
+}
+
+// StopRamp stops raising the volume, e.g. because the volume was changed by hand.
+func (s *Scheduler) StopRamp() {
+	s.chStopRamp <- struct{}{}
+}
+
+// Close stops the Scheduler.
+func (s *Scheduler) Close() {
+	close(s.chClose)
+	<-s.chClosed
+}
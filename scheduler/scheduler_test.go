@@ -0,0 +1,151 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GeertJohan/tune/clock/clocktest"
+	"github.com/GeertJohan/tune/scheduler"
+)
+
+// start is a moment before 7:30 on a day without daylight saving change, the scheduler runs in local time.
+var start = time.Date(2026, 10, 19, 7, 29, 50, 0, time.Local)
+
+func entry(t *testing.T, name, spec string) *scheduler.Entry {
+	s, err := scheduler.ParseSpec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &scheduler.Entry{Name: name, Spec: s}
+}
+
+func newTestScheduler(t *testing.T, entries ...*scheduler.Entry) (*scheduler.Scheduler, *clocktest.Fake) {
+	clk := clocktest.NewFake(start)
+	s := scheduler.New(clk, entries)
+	t.Cleanup(s.Close)
+	return s, clk
+}
+
+// nextAction advances the clock in steps until the scheduler sends an action.
+func nextAction(t *testing.T, s *scheduler.Scheduler, clk *clocktest.Fake, step time.Duration) scheduler.Action {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case action := <-s.Actions():
+			return action
+		case <-time.After(time.Millisecond):
+			clk.Advance(step)
+		}
+	}
+	t.Fatalf("no action until %v", clk.Now())
+	return scheduler.Action{}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	wake := entry(t, "wake", "30 7 * * *")
+	wake.Channel = "chillout"
+	wake.Volume = 60
+	s, clk := newTestScheduler(t, wake)
+
+	due := time.Date(2026, 10, 19, 7, 30, 0, 0, time.Local)
+	action := nextAction(t, s, clk, time.Second)
+	if action.Entry != "wake" || action.Channel != "chillout" || action.Volume != 60 {
+		t.Fatalf("action %+v", action)
+	}
+	if action.Run.Before(due) || action.Run.Sub(due) > time.Minute {
+		t.Fatalf("ran at %v, want %v", action.Run, due)
+	}
+
+	// the next run is tomorrow
+	action = nextAction(t, s, clk, time.Hour)
+	if want := due.AddDate(0, 0, 1); action.Run.Before(want) {
+		t.Fatalf("ran again at %v, want after %v", action.Run, want)
+	}
+}
+
+func TestSchedulerMissedRuns(t *testing.T) {
+	// 7:20 was missed 10 minutes ago while tune wasn't running, it is made up for
+	missed := entry(t, "missed", "20 7 * * *")
+	missed.LastRun = start.AddDate(0, 0, -1).Add(-10 * time.Minute)
+	// 7:00 was missed too long ago
+	tooLate := entry(t, "too late", "0 7 * * *")
+	tooLate.LastRun = start.AddDate(0, 0, -1).Add(-30 * time.Minute)
+	// an entry that never ran doesn't make up for earlier times
+	never := entry(t, "never", "20 7 * * *")
+	// 7:25 already ran today
+	ran := entry(t, "ran", "25 7 * * *")
+	ran.LastRun = start.Add(-4 * time.Minute)
+	marker := entry(t, "marker", "30 7 * * *")
+	s, clk := newTestScheduler(t, missed, tooLate, never, ran, marker)
+
+	action := nextAction(t, s, clk, time.Second)
+	if action.Entry != "missed" || !action.Run.Equal(start) {
+		t.Fatalf("action %s at %v, want the missed run at %v", action.Entry, action.Run, start)
+	}
+	action = nextAction(t, s, clk, time.Second)
+	if action.Entry != "marker" {
+		t.Fatalf("action %s, want marker", action.Entry)
+	}
+}
+
+func TestSchedulerSetEntries(t *testing.T) {
+	s, clk := newTestScheduler(t, entry(t, "old", "30 7 * * *"))
+	s.SetEntries([]*scheduler.Entry{entry(t, "new", "31 7 * * *")})
+	action := nextAction(t, s, clk, time.Second)
+	if action.Entry != "new" {
+		t.Fatalf("action %s, want new", action.Entry)
+	}
+}
+
+func TestSchedulerRamp(t *testing.T) {
+	wake := entry(t, "wake", "30 7 * * *")
+	wake.Channel = "chillout"
+	wake.Volume = 11
+	wake.Ramp = 20 * time.Second
+	s, clk := newTestScheduler(t, wake)
+
+	// the entry starts at volume 1, the steps raise it to the volume of the entry over the ramp
+	action := nextAction(t, s, clk, time.Second)
+	if action.Run.IsZero() || action.Channel != "chillout" || action.Volume != 1 {
+		t.Fatalf("action %+v, want the run at volume 1", action)
+	}
+	volume := 1
+	for volume < 11 {
+		step := nextAction(t, s, clk, 500*time.Millisecond)
+		if !step.Run.IsZero() || step.Channel != "" || step.Entry != "wake" {
+			t.Fatalf("step %+v", step)
+		}
+		if step.Volume <= volume || step.Volume > 11 {
+			t.Fatalf("step to volume %d after %d", step.Volume, volume)
+		}
+		volume = step.Volume
+	}
+	if passed := clk.Now().Sub(action.Run); passed < wake.Ramp {
+		t.Fatalf("ramp ended after %v, want %v", passed, wake.Ramp)
+	}
+
+	// no steps follow the ramp
+	marker := entry(t, "marker", "31 7 * * *")
+	s.SetEntries([]*scheduler.Entry{marker})
+	if action := nextAction(t, s, clk, time.Second); action.Entry != "marker" {
+		t.Fatalf("action %+v after the ramp, want marker", action)
+	}
+}
+
+func TestSchedulerStopRamp(t *testing.T) {
+	wake := entry(t, "wake", "30 7 * * *")
+	wake.Volume = 50
+	wake.Ramp = 10 * time.Minute
+	marker := entry(t, "marker", "35 7 * * *")
+	s, clk := newTestScheduler(t, wake, marker)
+
+	nextAction(t, s, clk, time.Second)
+	nextAction(t, s, clk, 2*time.Second)
+
+	// the volume was changed by hand, the ramp doesn't override it
+	s.StopRamp()
+	if action := nextAction(t, s, clk, 2*time.Second); action.Entry != "marker" {
+		t.Fatalf("action %+v after StopRamp, want marker", action)
+	}
+}
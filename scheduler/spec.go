@@ -0,0 +1,178 @@
+package scheduler
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// specShortcuts are the cron shortcuts that can be used instead of the five fields.
+var specShortcuts = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * sun",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// specField describes one of the five fields of a Spec.
+type specField struct {
+	name     string
+	min, max int
+	names    []string // names for the values from min, e.g. jan for 1
+}
+
+var specFields = []specField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// specSearchLimit is how far ahead Next looks for a matching time, a Spec like "0 0 30 2 *" never matches.
+const specSearchLimit = 5 * 366 * 24 * time.Hour
+
+// Spec is a cron-like time specification with five fields: minute, hour, day of month, month and day of week.
+// A field is * for every value, a number, a range like 1-5 or mon-fri, a step like */15 or 8-18/2, or a comma
+// separated list of those. Day of week 0 and 7 are both Sunday. As in cron, when both day fields are restricted a
+// day matches either of them.
+type Spec struct {
+	spec   string
+	fields [5]uint64 // a bit for each value
+	anyDay [2]bool   // whether the day of month and day of week fields are *
+}
+
+// ParseSpec parses a Spec, e.g. "30 7 * * mon-fri" for 7:30 on weekdays, or one of @hourly, @daily, @weekly,
+// @monthly and @yearly.
+func ParseSpec(spec string) (*Spec, error) {
+	s := &Spec{spec: spec}
+	expanded := spec
+	if shortcut, ok := specShortcuts[strings.ToLower(spec)]; ok {
+		expanded = shortcut
+	}
+	parts := strings.Fields(expanded)
+	if len(parts) != len(specFields) {
+		return nil, errors.Errorf("invalid schedule %q: need %d fields, minute hour day-of-month month day-of-week", spec, len(specFields))
+	}
+	for i, part := range parts {
+		bits, err := specFields[i].parse(strings.ToLower(part))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid schedule %q", spec)
+		}
+		s.fields[i] = bits
+	}
+	s.anyDay = [2]bool{parts[2] == "*", parts[4] == "*"}
+	// Sunday is 0 for time.Weekday
+	if s.fields[4]&(1<<7) != 0 {
+		s.fields[4] |= 1
+	}
+	return s, nil
+}
+
+func (f specField) parse(part string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(part, ",") {
+		rng, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			rng = item[:i]
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step < 1 {
+				return 0, errors.Errorf("invalid step in %s %q", f.name, item)
+			}
+		}
+		first, last := f.min, f.max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			first, err = f.value(bounds[0])
+			if err != nil {
+				return 0, err
+			}
+			last = first
+			if len(bounds) == 2 {
+				last, err = f.value(bounds[1])
+				if err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				last = f.max // 5/15 is from 5 to the end
+			}
+			if last < first {
+				return 0, errors.Errorf("invalid range in %s %q", f.name, item)
+			}
+		}
+		for v := first; v <= last; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f specField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if s == name {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, errors.Errorf("invalid %s %q, must be %d-%d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// String returns the spec as it was parsed.
+func (s *Spec) String() string {
+	return s.spec
+}
+
+// Next returns the first time after t that matches the spec, in the location of t.
+// It returns the zero time when the spec never matches. The spec matches the wall clock: on a daylight saving change
+// a time that is skipped runs once at the time it moves to, and a time that occurs twice runs once.
+func (s *Spec) Next(t time.Time) time.Time {
+	loc := t.Location()
+	// walk the wall clock of loc as if it were UTC, which has no gaps or repeats
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC).Add(time.Minute)
+	limit := wall.Add(specSearchLimit)
+	for wall.Before(limit) {
+		switch {
+		case !s.match(3, int(wall.Month())):
+			wall = time.Date(wall.Year(), wall.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.matchDay(wall):
+			wall = time.Date(wall.Year(), wall.Month(), wall.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !s.match(1, wall.Hour()):
+			wall = time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour()+1, 0, 0, 0, time.UTC)
+		case !s.match(0, wall.Minute()):
+			wall = wall.Add(time.Minute)
+		default:
+			next := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, loc)
+			if next.After(t) {
+				return next
+			}
+			// the wall time fell back to before t, or a skipped time moved to t
+			wall = wall.Add(time.Minute)
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Spec) match(field, value int) bool {
+	return s.fields[field]&(1<<uint(value)) != 0
+}
+
+func (s *Spec) matchDay(t time.Time) bool {
+	dom, dow := s.match(2, t.Day()), s.match(4, int(t.Weekday()))
+	switch {
+	case s.anyDay[0] && s.anyDay[1]:
+		return true
+	case s.anyDay[0]:
+		return dow
+	case s.anyDay[1]:
+		return dom
+	}
+	return dom || dow
+}
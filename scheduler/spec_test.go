@@ -0,0 +1,117 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GeertJohan/tune/scheduler"
+)
+
+const nextFormat = "Mon 2006-01-02 15:04 MST"
+
+func TestParseSpec(t *testing.T) {
+	for _, spec := range []string{
+		"30 7 * * mon-fri",
+		"*/15 * * * *",
+		"0 8-18/2 * * *",
+		"1,2 3 * jan-mar *",
+		"5/20 * * * *",
+		"0 0 * * 7",
+		"@daily",
+		"@Weekly",
+	} {
+		s, err := scheduler.ParseSpec(spec)
+		if err != nil {
+			t.Errorf("ParseSpec(%q): %v", spec, err)
+			continue
+		}
+		if s.String() != spec {
+			t.Errorf("ParseSpec(%q).String() = %q", spec, s.String())
+		}
+	}
+
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"0 24 * * *",
+		"0 0 0 * *",
+		"0 0 * 13 *",
+		"0 0 * * 8",
+		"0 0 * * fri-mon",
+		"*/0 * * * *",
+		"x * * * *",
+		"@often",
+	} {
+		_, err := scheduler.ParseSpec(spec)
+		if err == nil {
+			t.Errorf("ParseSpec(%q) succeeded", spec)
+		}
+	}
+}
+
+// checkNext checks the times that the spec matches after from.
+func checkNext(t *testing.T, spec string, from time.Time, want ...string) {
+	t.Helper()
+	s, err := scheduler.ParseSpec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := from
+	for _, w := range want {
+		next = s.Next(next)
+		if got := next.Format(nextFormat); got != w {
+			t.Fatalf("%q after %s: %s, want %s", spec, from.Format(nextFormat), got, w)
+		}
+	}
+}
+
+func TestSpecNext(t *testing.T) {
+	monday := time.Date(2026, 10, 19, 7, 45, 30, 0, time.UTC)
+	checkNext(t, "30 7 * * mon-fri", monday,
+		"Tue 2026-10-20 07:30 UTC", "Wed 2026-10-21 07:30 UTC", "Thu 2026-10-22 07:30 UTC", "Fri 2026-10-23 07:30 UTC",
+		"Mon 2026-10-26 07:30 UTC")
+	checkNext(t, "*/15 * * * *", monday, "Mon 2026-10-19 08:00 UTC", "Mon 2026-10-19 08:15 UTC")
+	checkNext(t, "0 8-18/4 * * *", monday, "Mon 2026-10-19 08:00 UTC", "Mon 2026-10-19 12:00 UTC",
+		"Mon 2026-10-19 16:00 UTC", "Tue 2026-10-20 08:00 UTC")
+	checkNext(t, "@monthly", monday, "Sun 2026-11-01 00:00 UTC", "Tue 2026-12-01 00:00 UTC")
+	checkNext(t, "0 0 29 2 *", monday, "Tue 2028-02-29 00:00 UTC")
+
+	// a time that matches exactly is not after itself
+	checkNext(t, "45 7 * * *", monday.Truncate(time.Minute), "Tue 2026-10-20 07:45 UTC")
+
+	// when both days are restricted, either of them matches, as in cron
+	checkNext(t, "0 9 1 * sun", monday, "Sun 2026-10-25 09:00 UTC", "Sun 2026-11-01 09:00 UTC", "Sun 2026-11-08 09:00 UTC")
+	checkNext(t, "0 9 13 * fri", monday, "Fri 2026-10-23 09:00 UTC", "Fri 2026-10-30 09:00 UTC", "Fri 2026-11-06 09:00 UTC",
+		"Fri 2026-11-13 09:00 UTC", "Fri 2026-11-20 09:00 UTC")
+	checkNext(t, "0 0 * * 7", monday, "Sun 2026-10-25 00:00 UTC")
+
+	s, _ := scheduler.ParseSpec("0 0 30 2 *")
+	if next := s.Next(monday); !next.IsZero() {
+		t.Fatalf("February 30 matched %v", next)
+	}
+}
+
+func TestSpecNextDST(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+
+	// clocks go from 2:00 to 3:00, the skipped 2:30 runs once at 3:30
+	spring := time.Date(2026, 3, 28, 12, 0, 0, 0, amsterdam)
+	checkNext(t, "30 2 * * *", spring, "Sun 2026-03-29 03:30 CEST", "Mon 2026-03-30 02:30 CEST")
+	checkNext(t, "*/30 * * * *", spring.Add(13*time.Hour+15*time.Minute),
+		"Sun 2026-03-29 01:30 CET", "Sun 2026-03-29 03:00 CEST", "Sun 2026-03-29 03:30 CEST")
+	checkNext(t, "30 7 * * *", spring, "Sun 2026-03-29 07:30 CEST", "Mon 2026-03-30 07:30 CEST")
+
+	// clocks go from 3:00 back to 2:00, 2:30 runs once
+	autumn := time.Date(2026, 10, 24, 12, 0, 0, 0, amsterdam)
+	checkNext(t, "30 2 * * *", autumn, "Sun 2026-10-25 02:30 CET", "Mon 2026-10-26 02:30 CET")
+	checkNext(t, "30 7 * * *", autumn, "Sun 2026-10-25 07:30 CET", "Mon 2026-10-26 07:30 CET")
+
+	// the repeated hour runs once, in winter time
+	summer := time.Date(2026, 10, 25, 2, 15, 0, 0, amsterdam).Add(-time.Hour) // 2:15 CEST, before the clocks go back
+	checkNext(t, "*/30 * * * *", summer, "Sun 2026-10-25 02:30 CET", "Sun 2026-10-25 03:00 CET")
+}
@@ -0,0 +1,231 @@
+package settings
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Source describes where an effective configuration value came from.
+type Source string
+
+// Configuration sources, in increasing order of precedence.
+const (
+	SourceDefault         Source = "default"
+	SourceSettingsFile    Source = "settings file"
+	SourceCredentialStore Source = "credential store"
+	SourceEnvironment     Source = "environment"
+	SourceFlag            Source = "flag"
+)
+
+// Keys of the configuration values that can be overridden by environment variables and flags.
+// The key is also the flag name, the environment variable is given by EnvName.
+const (
+	KeyDir        = "dir"
+	KeyConfigPath = "config"
+	KeyAPIKey     = "api-key"
+	KeyNetwork    = "network"
+	KeyStreamlist = "streamlist"
+	KeyVolume     = "volume"
+)
+
+// overridable lists the keys that can be overridden, in the order they are reported.
+var overridable = []struct {
+	key   string
+	usage string
+}{
+	{KeyDir, "base folder for the config, cache, state and log folders, instead of the platform folders"},
+	{KeyConfigPath, "path of the settings file, instead of the one in the config folder"},
+	{KeyAPIKey, "AudioAddict api key, instead of the stored credentials"},
+	{KeyNetwork, "key of the network to listen to, such as di"},
+	{KeyStreamlist, "key of the stream quality, such as premium_high"},
+	{KeyVolume, "volume at start, 0 to 100"},
+}
+
+// EnvName returns the environment variable that overrides key, e.g. TUNE_API_KEY for api-key.
+func EnvName(key string) string {
+	return "TUNE_" + strings.ToUpper(strings.Replace(key, "-", "_", -1))
+}
+
+// Overrides holds configuration values from environment variables and command-line flags.
+// They take precedence over the settings file, and are never saved to it.
+type Overrides struct {
+	flags  *flag.FlagSet
+	values map[string]*string
+}
+
+// NewOverrides registers a flag for every overridable key on fs. The flags are read once fs has been parsed.
+func NewOverrides(fs *flag.FlagSet) *Overrides {
+	o := &Overrides{
+		flags:  fs,
+		values: make(map[string]*string),
+	}
+	for _, k := range overridable {
+		o.values[k.key] = fs.String(k.key, "", fmt.Sprintf("%s (env %s)", k.usage, EnvName(k.key)))
+	}
+	return o
+}
+
+// lookup returns the override for key, flags take precedence over environment variables.
+// Empty values don't override.
+func (o *Overrides) lookup(key string) (value string, source Source, ok bool) {
+	set := false
+	o.flags.Visit(func(f *flag.Flag) {
+		if f.Name == key {
+			set = true
+		}
+	})
+	if set && *o.values[key] != "" {
+		return *o.values[key], SourceFlag, true
+	}
+	if value := os.Getenv(EnvName(key)); value != "" {
+		return value, SourceEnvironment, true
+	}
+	return "", "", false
+}
+
+// Dirs returns the folders to use, and where they came from.
+func (o *Overrides) Dirs() (Dirs, Source) {
+	if base, source, ok := o.lookup(KeyDir); ok {
+		return BaseDirs(base), source
+	}
+	return DefaultDirs(), SourceDefault
+}
+
+// ConfigPath returns the path of the settings file to use, and where it came from.
+func (o *Overrides) ConfigPath() (string, Source) {
+	if path, source, ok := o.lookup(KeyConfigPath); ok {
+		return path, source
+	}
+	dirs, source := o.Dirs()
+	return filepath.Join(dirs.Config, settingsFileName), source
+}
+
+// Load loads the settings from the file given by ConfigPath.
+func (o *Overrides) Load() (*Settings, error) {
+	path, _ := o.ConfigPath()
+	return LoadFile(path)
+}
+
+// Config is the effective configuration for a profile, resolved from the defaults, the settings file,
+// the credential store, environment variables and flags, in increasing order of precedence.
+// Changing a Config doesn't change the settings.
+type Config struct {
+	Dirs          Dirs
+	ConfigPath    string
+	APIKey        string
+	NetworkKey    string
+	StreamlistKey string
+	Volume        int
+
+	sources map[string]Source
+}
+
+// Resolve resolves the effective configuration for the profile with given name.
+// The credentials provide the api key when it isn't overridden, creds may be nil.
+// The profile is not created when it doesn't exist yet.
+func (o *Overrides) Resolve(c *Settings, profile string, creds *Credentials) (*Config, error) {
+	cfg := &Config{
+		sources: make(map[string]Source),
+	}
+	cfg.Dirs, cfg.sources[KeyDir] = o.Dirs()
+	_, pathSource := o.ConfigPath()
+	cfg.ConfigPath = c.Path()
+	cfg.sources[KeyConfigPath] = pathSource
+
+	// defaults, replaced by the settings file when the profile is in there
+	p, ok := c.Profiles[profile]
+	fileSource := SourceSettingsFile
+	if !ok {
+		p = newDefaultProfile()
+		fileSource = SourceDefault
+	}
+	cfg.NetworkKey = p.NetworkKey
+	cfg.StreamlistKey = p.StreamlistKey
+	cfg.Volume = p.Volume
+	cfg.sources[KeyNetwork] = fileSource
+	cfg.sources[KeyStreamlist] = fileSource
+	cfg.sources[KeyVolume] = fileSource
+
+	cfg.sources[KeyAPIKey] = SourceDefault
+	if creds != nil && creds.APIKey != "" {
+		cfg.APIKey = creds.APIKey
+		cfg.sources[KeyAPIKey] = SourceCredentialStore
+	}
+
+	// environment and flags
+	if value, source, ok := o.lookup(KeyAPIKey); ok {
+		cfg.APIKey = value
+		cfg.sources[KeyAPIKey] = source
+	}
+	if value, source, ok := o.lookup(KeyNetwork); ok {
+		cfg.NetworkKey = value
+		cfg.sources[KeyNetwork] = source
+	}
+	if value, source, ok := o.lookup(KeyStreamlist); ok {
+		cfg.StreamlistKey = value
+		cfg.sources[KeyStreamlist] = source
+	}
+	if value, source, ok := o.lookup(KeyVolume); ok {
+		volume, err := strconv.Atoi(value)
+		if err != nil || volume < 0 || volume > 100 {
+			return nil, errors.Errorf("invalid volume %q from %s, must be 0 to 100", value, source)
+		}
+		cfg.Volume = volume
+		cfg.sources[KeyVolume] = source
+	}
+	return cfg, nil
+}
+
+// Source returns where the effective value for key came from.
+func (cfg *Config) Source(key string) Source {
+	return cfg.sources[key]
+}
+
+// Overridden returns true when the value for key came from an environment variable or flag.
+// Overridden values must not be saved to the settings file.
+func (cfg *Config) Overridden(key string) bool {
+	source := cfg.sources[key]
+	return source == SourceEnvironment || source == SourceFlag
+}
+
+// String lists the effective values and where they came from, one per line. The api key is masked.
+func (cfg *Config) String() string {
+	values := map[string]string{
+		KeyConfigPath: cfg.ConfigPath,
+		KeyAPIKey:     maskSecret(cfg.APIKey),
+		KeyNetwork:    cfg.NetworkKey,
+		KeyStreamlist: cfg.StreamlistKey,
+		KeyVolume:     strconv.Itoa(cfg.Volume),
+	}
+	var buf bytes.Buffer
+	for _, k := range overridable {
+		if k.key == KeyDir {
+			for _, dir := range []struct{ name, path string }{
+				{"config dir", cfg.Dirs.Config},
+				{"cache dir", cfg.Dirs.Cache},
+				{"state dir", cfg.Dirs.State},
+				{"log dir", cfg.Dirs.Log},
+			} {
+				fmt.Fprintf(&buf, "%-10s = %-40q (%s)\n", dir.name, dir.path, cfg.sources[KeyDir])
+			}
+			continue
+		}
+		fmt.Fprintf(&buf, "%-10s = %-40q (%s)\n", k.key, values[k.key], cfg.sources[k.key])
+	}
+	return buf.String()
+}
+
+// maskSecret hides all but the last four characters of a secret.
+func maskSecret(secret string) string {
+	if len(secret) <= 4 {
+		return strings.Repeat("*", len(secret))
+	}
+	return strings.Repeat("*", len(secret)-4) + secret[len(secret)-4:]
+}
@@ -0,0 +1,186 @@
+package settings
+
+import (
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNoCredentials is returned by (CredentialStore).Load() when no credentials are stored.
+	ErrNoCredentials = errors.New("no credentials stored")
+
+	// ErrStoreUnavailable is returned when a credential store can't be used on this machine.
+	ErrStoreUnavailable = errors.New("credential store unavailable")
+
+	// ErrUnknownStore is returned by (*Settings).OpenCredentialStore() when the configured store doesn't exist.
+	ErrUnknownStore = errors.New("unknown credential store")
+)
+
+// Credential store names, to be used for Settings.Settings.CredentialStore.
+const (
+	// StoreAuto uses the Secret Service when available, and falls back to a plaintext file.
+	StoreAuto = ""
+	// StoreSecretService keeps credentials in the desktop keyring over D-Bus.
+	StoreSecretService = "secretservice"
+	// StoreEncryptedFile keeps credentials in a file that is encrypted with a passphrase.
+	StoreEncryptedFile = "encrypted"
+	// StorePlaintextFile keeps credentials in a plaintext file that is only readable by the user.
+	StorePlaintextFile = "plaintext"
+)
+
+// Credentials holds the secrets that are used to authenticate with AudioAddict.
+type Credentials struct {
+	APIKey           string
+	ListenKey        string
+	WebSessionCookie string
+}
+
+// empty returns whether no credential is set.
+func (cr *Credentials) empty() bool {
+	return cr.APIKey == "" && cr.ListenKey == "" && cr.WebSessionCookie == ""
+}
+
+// CredentialStore stores Credentials separately from the other settings.
+type CredentialStore interface {
+	// Load returns the stored credentials, or ErrNoCredentials when nothing is stored.
+	Load() (*Credentials, error)
+
+	// Save stores the credentials, replacing previously stored credentials.
+	Save(cr *Credentials) error
+
+	// Delete wipes the stored credentials. It is not an error when nothing is stored.
+	Delete() error
+}
+
+// PassphraseFunc asks the user for the passphrase of the encrypted credentials file.
+type PassphraseFunc func() (string, error)
+
+// credentialsPath returns the path for the credentials file of a profile, next to the settings file.
+// The default profile uses the file name without profile name.
+func (c *Settings) credentialsPath(profile, ext string) string {
+	name := "credentials" + ext
+	if profile != DefaultProfileName {
+		name = "credentials-" + profile + ext
+	}
+	return filepath.Join(filepath.Dir(c.Path()), name)
+}
+
+// OpenCredentialStore opens the credential store for a profile, using the store that is selected in the settings.
+// The passphrase func is only called when the encrypted file store is used.
+// Credentials that are still in the settings file, written by older versions of tune, are moved to the store of
+// the default profile.
+func (c *Settings) OpenCredentialStore(profile string, passphrase PassphraseFunc) (CredentialStore, error) {
+	var store CredentialStore
+	var err error
+	switch c.Settings.CredentialStore {
+	case StoreAuto:
+		store, err = NewSecretServiceStore(profile)
+		if err != nil {
+			store, err = NewPlaintextFileStore(c.credentialsPath(profile, ".toml")), nil
+		}
+	case StoreSecretService:
+		store, err = NewSecretServiceStore(profile)
+	case StoreEncryptedFile:
+		store, err = NewEncryptedFileStore(c.credentialsPath(profile, ".enc"), passphrase), nil
+	case StorePlaintextFile:
+		store, err = NewPlaintextFileStore(c.credentialsPath(profile, ".toml")), nil
+	default:
+		return nil, ErrUnknownStore
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if profile != DefaultProfileName {
+		return store, nil
+	}
+	err = c.migrateCredentials(store)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to move credentials from settings file to credential store")
+	}
+	return store, nil
+}
+
+// migrateCredentials moves credentials from the settings file to the store.
+func (c *Settings) migrateCredentials(store CredentialStore) error {
+	legacy := &Credentials{
+		APIKey:           c.Account.APIKey,
+		ListenKey:        c.Account.ListenKey,
+		WebSessionCookie: c.Account.WebSessionCookie,
+	}
+	if legacy.empty() {
+		return nil
+	}
+	cr, err := store.Load()
+	if err == ErrNoCredentials {
+		cr, err = &Credentials{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	if legacy.APIKey != "" {
+		cr.APIKey = legacy.APIKey
+	}
+	if legacy.ListenKey != "" {
+		cr.ListenKey = legacy.ListenKey
+	}
+	if legacy.WebSessionCookie != "" {
+		cr.WebSessionCookie = legacy.WebSessionCookie
+	}
+	err = store.Save(cr)
+	if err != nil {
+		return err
+	}
+	c.Account.APIKey = ""
+	c.Account.ListenKey = ""
+	c.Account.WebSessionCookie = ""
+	return c.Save()
+}
+
+// DeleteCredentials wipes the credentials of a profile from every credential store, not only the selected one.
+// For the default profile they are also removed from the settings file, the backups of migrated settings files and
+// the legacy aacli config, where older versions of tune kept them.
+func (c *Settings) DeleteCredentials(profile string) error {
+	stores := []CredentialStore{
+		NewPlaintextFileStore(c.credentialsPath(profile, ".toml")),
+		NewEncryptedFileStore(c.credentialsPath(profile, ".enc"), nil),
+	}
+	secretService, err := NewSecretServiceStore(profile)
+	if err == nil {
+		stores = append(stores, secretService)
+	} else if c.Settings.CredentialStore == StoreSecretService {
+		return err
+	}
+	for _, store := range stores {
+		err = store.Delete()
+		if err != nil {
+			return err
+		}
+	}
+
+	if profile != DefaultProfileName {
+		return nil
+	}
+	c.Account.APIKey = ""
+	c.Account.ListenKey = ""
+	c.Account.WebSessionCookie = ""
+	err = c.Save()
+	if err != nil {
+		return err
+	}
+	backups, err := filepath.Glob(c.Path() + ".v*.bak")
+	if err != nil {
+		return err
+	}
+	if c.Path() == settingsPath() {
+		backups = append(backups, legacySettingsPath())
+	}
+	for _, path := range backups {
+		err = scrubCredentials(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to remove credentials from %s", path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package settings
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	// ErrWrongPassphrase is returned when the encrypted credentials file can't be decrypted with the passphrase.
+	ErrWrongPassphrase = errors.New("wrong passphrase for credentials file")
+)
+
+const (
+	encryptedMagic   = "tune-credentials-v1\n"
+	encryptedSaltLen = 16
+	encryptedKeyLen  = 32 // AES-256
+
+	// scrypt parameters, as recommended for interactive logins
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// EncryptedFileStore keeps credentials in a file that is encrypted with AES-GCM,
+// using a key that is derived from a passphrase with scrypt.
+// The file consists of a magic header, the salt, the nonce and the sealed credentials.
+type EncryptedFileStore struct {
+	path       string
+	passphrase PassphraseFunc
+
+	key  []byte // cached key, so the user is asked for the passphrase only once
+	salt []byte
+}
+
+// NewEncryptedFileStore creates an EncryptedFileStore for the file at path.
+// The passphrase func is called once, when the file is first read or written.
+func NewEncryptedFileStore(path string, passphrase PassphraseFunc) *EncryptedFileStore {
+	return &EncryptedFileStore{
+		path:       path,
+		passphrase: passphrase,
+	}
+}
+
+// deriveKey asks for the passphrase and derives the key for given salt.
+func (s *EncryptedFileStore) deriveKey(salt []byte) error {
+	if s.key != nil && bytes.Equal(s.salt, salt) {
+		return nil
+	}
+	if s.passphrase == nil {
+		return errors.New("no passphrase available for credentials file")
+	}
+	passphrase, err := s.passphrase()
+	if err != nil {
+		return err
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, encryptedKeyLen)
+	if err != nil {
+		return err
+	}
+	s.key = key
+	s.salt = salt
+	return nil
+}
+
+func (s *EncryptedFileStore) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Load implements CredentialStore.
+func (s *EncryptedFileStore) Load() (*Credentials, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(encryptedMagic)) || len(data) < len(encryptedMagic)+encryptedSaltLen {
+		return nil, errors.New("invalid credentials file")
+	}
+	data = data[len(encryptedMagic):]
+	salt, data := data[:encryptedSaltLen], data[encryptedSaltLen:]
+
+	err = s.deriveKey(salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := s.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("invalid credentials file")
+	}
+	nonce, sealed := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, sealed, []byte(encryptedMagic))
+	if err != nil {
+		s.key = nil // ask again next time
+		return nil, ErrWrongPassphrase
+	}
+
+	cr := &Credentials{}
+	err = toml.Unmarshal(plain, cr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode credentials")
+	}
+	return cr, nil
+}
+
+// Save implements CredentialStore.
+func (s *EncryptedFileStore) Save(cr *Credentials) error {
+	salt := s.salt
+	if salt == nil {
+		salt = make([]byte, encryptedSaltLen)
+		_, err := io.ReadFull(rand.Reader, salt)
+		if err != nil {
+			return err
+		}
+	}
+	err := s.deriveKey(salt)
+	if err != nil {
+		return err
+	}
+	aead, err := s.aead()
+	if err != nil {
+		return err
+	}
+
+	var plain bytes.Buffer
+	err = toml.NewEncoder(&plain).Encode(cr)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return err
+	}
+
+	var data bytes.Buffer
+	data.WriteString(encryptedMagic)
+	data.Write(salt)
+	data.Write(nonce)
+	data.Write(aead.Seal(nil, nonce, plain.Bytes(), []byte(encryptedMagic)))
+	return writeFileAtomic(s.path, data.Bytes())
+}
+
+// Delete implements CredentialStore.
+func (s *EncryptedFileStore) Delete() error {
+	s.key = nil
+	s.salt = nil
+	err := os.Remove(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package settings
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// PlaintextFileStore keeps credentials in a plaintext toml file that is only accessible by the user (0600).
+type PlaintextFileStore struct {
+	path string
+}
+
+// NewPlaintextFileStore creates a PlaintextFileStore for the file at path.
+func NewPlaintextFileStore(path string) *PlaintextFileStore {
+	return &PlaintextFileStore{path: path}
+}
+
+// Load implements CredentialStore.
+// The file permissions are tightened to 0600 when another user could read the file.
+func (s *PlaintextFileStore) Load() (*Credentials, error) {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		err = os.Chmod(s.path, 0600)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to restrict permissions of credentials file")
+		}
+	}
+	credentialsBytes, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	cr := &Credentials{}
+	err = toml.Unmarshal(credentialsBytes, cr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode credentials file")
+	}
+	return cr, nil
+}
+
+// Save implements CredentialStore.
+func (s *PlaintextFileStore) Save(cr *Credentials) error {
+	var buf bytes.Buffer
+	err := toml.NewEncoder(&buf).Encode(cr)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, buf.Bytes())
+}
+
+// Delete implements CredentialStore.
+func (s *PlaintextFileStore) Delete() error {
+	err := os.Remove(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file with mode 0600 and moves it over the file at path.
+func writeFileAtomic(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath) // no-op after successful rename
+	_, err = tmpFile.Write(data)
+	if err != nil {
+		tmpFile.Close()
+		return err
+	}
+	err = tmpFile.Sync()
+	if err != nil {
+		tmpFile.Close()
+		return err
+	}
+	err = tmpFile.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
@@ -0,0 +1,246 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package settings
+
+import (
+	"bytes"
+
+	"github.com/BurntSushi/toml"
+	"github.com/godbus/dbus/v5"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrPromptDismissed is returned when the user dismissed the keyring unlock prompt.
+	ErrPromptDismissed = errors.New("keyring prompt dismissed")
+)
+
+// https://specifications.freedesktop.org/secret-service/latest/
+const (
+	secretServiceName       = "org.freedesktop.secrets"
+	secretServicePath       = "/org/freedesktop/secrets"
+	secretServiceCollection = "/org/freedesktop/secrets/aliases/default"
+	secretServiceInterface  = "org.freedesktop.Secret.Service"
+	secretItemInterface     = "org.freedesktop.Secret.Item"
+	secretPromptInterface   = "org.freedesktop.Secret.Prompt"
+	secretNoPrompt          = dbus.ObjectPath("/")
+)
+
+// secret is the Secret struct from the Secret Service API.
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// SecretServiceStore keeps credentials in the desktop keyring (GNOME Keyring, KWallet, KeePassXC, ...),
+// using the freedesktop Secret Service API over D-Bus.
+type SecretServiceStore struct {
+	conn       *dbus.Conn
+	attributes map[string]string
+}
+
+// NewSecretServiceStore connects to the Secret Service on the session bus, for the credentials of given profile.
+// ErrStoreUnavailable is returned when there is no session bus or no Secret Service.
+func NewSecretServiceStore(profile string) (*SecretServiceStore, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, ErrStoreUnavailable
+	}
+	var activatable []string
+	err = conn.BusObject().Call("org.freedesktop.DBus.ListActivatableNames", 0).Store(&activatable)
+	if err != nil {
+		return nil, ErrStoreUnavailable
+	}
+	var hasOwner bool
+	err = conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, secretServiceName).Store(&hasOwner)
+	if err != nil {
+		return nil, ErrStoreUnavailable
+	}
+	if !hasOwner && !contains(activatable, secretServiceName) {
+		return nil, ErrStoreUnavailable
+	}
+	s := &SecretServiceStore{
+		conn: conn,
+		attributes: map[string]string{
+			"application": "tune",
+			"type":        "credentials",
+			"profile":     profile,
+		},
+	}
+	return s, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SecretServiceStore) service() dbus.BusObject {
+	return s.conn.Object(secretServiceName, secretServicePath)
+}
+
+// openSession opens a session for plain transfer of secrets, which is fine over the local session bus.
+func (s *SecretServiceStore) openSession() (dbus.ObjectPath, error) {
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err := s.service().Call(secretServiceInterface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &session)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to open secret service session")
+	}
+	return session, nil
+}
+
+func (s *SecretServiceStore) closeSession(session dbus.ObjectPath) {
+	s.conn.Object(secretServiceName, session).Call("org.freedesktop.Secret.Session.Close", 0)
+}
+
+// items searches for the tune credential items, locked items are unlocked.
+func (s *SecretServiceStore) items() ([]dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	err := s.service().Call(secretServiceInterface+".SearchItems", 0, s.attributes).Store(&unlocked, &locked)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search secret service")
+	}
+	if len(locked) == 0 {
+		return unlocked, nil
+	}
+	var justUnlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	err = s.service().Call(secretServiceInterface+".Unlock", 0, locked).Store(&justUnlocked, &prompt)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unlock secret service items")
+	}
+	if prompt != secretNoPrompt {
+		result, err := s.prompt(prompt)
+		if err != nil {
+			return nil, err
+		}
+		justUnlocked, _ = result.Value().([]dbus.ObjectPath)
+	}
+	return append(unlocked, justUnlocked...), nil
+}
+
+// prompt shows a prompt to the user (e.g. to unlock the keyring) and waits until it is completed.
+func (s *SecretServiceStore) prompt(path dbus.ObjectPath) (dbus.Variant, error) {
+	err := s.conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(path),
+		dbus.WithMatchInterface(secretPromptInterface),
+		dbus.WithMatchMember("Completed"),
+	)
+	if err != nil {
+		return dbus.Variant{}, err
+	}
+	signals := make(chan *dbus.Signal, 1)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+
+	err = s.conn.Object(secretServiceName, path).Call(secretPromptInterface+".Prompt", 0, "").Err
+	if err != nil {
+		return dbus.Variant{}, errors.Wrap(err, "failed to show secret service prompt")
+	}
+	for signal := range signals {
+		if signal.Path != path || signal.Name != secretPromptInterface+".Completed" || len(signal.Body) != 2 {
+			continue
+		}
+		if dismissed, _ := signal.Body[0].(bool); dismissed {
+			return dbus.Variant{}, ErrPromptDismissed
+		}
+		result, _ := signal.Body[1].(dbus.Variant)
+		return result, nil
+	}
+	return dbus.Variant{}, ErrPromptDismissed
+}
+
+// Load implements CredentialStore.
+func (s *SecretServiceStore) Load() (*Credentials, error) {
+	items, err := s.items()
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrNoCredentials
+	}
+	session, err := s.openSession()
+	if err != nil {
+		return nil, err
+	}
+	defer s.closeSession(session)
+
+	var sec secret
+	err = s.conn.Object(secretServiceName, items[0]).Call(secretItemInterface+".GetSecret", 0, session).Store(&sec)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get secret from secret service")
+	}
+	cr := &Credentials{}
+	err = toml.Unmarshal(sec.Value, cr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode credentials")
+	}
+	return cr, nil
+}
+
+// Save implements CredentialStore.
+func (s *SecretServiceStore) Save(cr *Credentials) error {
+	var buf bytes.Buffer
+	err := toml.NewEncoder(&buf).Encode(cr)
+	if err != nil {
+		return err
+	}
+	session, err := s.openSession()
+	if err != nil {
+		return err
+	}
+	defer s.closeSession(session)
+
+	properties := map[string]dbus.Variant{
+		secretItemInterface + ".Label":      dbus.MakeVariant("tune AudioAddict credentials (" + s.attributes["profile"] + ")"),
+		secretItemInterface + ".Attributes": dbus.MakeVariant(s.attributes),
+	}
+	sec := secret{
+		Session:     session,
+		Value:       buf.Bytes(),
+		ContentType: "text/plain",
+	}
+	collection := s.conn.Object(secretServiceName, secretServiceCollection)
+	var item, prompt dbus.ObjectPath
+	err = collection.Call("org.freedesktop.Secret.Collection.CreateItem", 0, properties, sec, true).Store(&item, &prompt)
+	if err != nil {
+		return errors.Wrap(err, "failed to store secret in secret service")
+	}
+	if prompt != secretNoPrompt {
+		_, err = s.prompt(prompt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete implements CredentialStore.
+func (s *SecretServiceStore) Delete() error {
+	items, err := s.items()
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		var prompt dbus.ObjectPath
+		err = s.conn.Object(secretServiceName, item).Call(secretItemInterface+".Delete", 0).Store(&prompt)
+		if err != nil {
+			return errors.Wrap(err, "failed to delete secret from secret service")
+		}
+		if prompt != secretNoPrompt {
+			_, err = s.prompt(prompt)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build windows || darwin
+// +build windows darwin
+
+package settings
+
+// SecretServiceStore is only available on systems with freedesktop D-Bus.
+type SecretServiceStore struct{}
+
+// NewSecretServiceStore always returns ErrStoreUnavailable, there is no Secret Service on this platform.
+func NewSecretServiceStore(profile string) (*SecretServiceStore, error) {
+	return nil, ErrStoreUnavailable
+}
+
+// Load implements CredentialStore.
+func (s *SecretServiceStore) Load() (*Credentials, error) { return nil, ErrStoreUnavailable }
+
+// Save implements CredentialStore.
+func (s *SecretServiceStore) Save(cr *Credentials) error { return ErrStoreUnavailable }
+
+// Delete implements CredentialStore.
+func (s *SecretServiceStore) Delete() error { return ErrStoreUnavailable }
@@ -0,0 +1,36 @@
+package settings
+
+import (
+	"path/filepath"
+)
+
+// Dirs holds the folders where tune keeps its files.
+type Dirs struct {
+	// Config holds the settings file and the credential files.
+	Config string
+
+	// Cache holds data that can be downloaded again, it may be removed at any time.
+	Cache string
+
+	// State holds data that should be kept, but isn't configuration, such as recordings and history.
+	State string
+
+	// Log holds log files and panic reports.
+	Log string
+}
+
+// DefaultDirs returns the folders for tune following the conventions of the platform:
+// the XDG base directories on Linux and other unixes, the user's Library on macOS, and AppData on Windows.
+func DefaultDirs() Dirs {
+	return platformDirs()
+}
+
+// BaseDirs returns folders for tune inside a single base folder, for portable installs and testing.
+func BaseDirs(base string) Dirs {
+	return Dirs{
+		Config: filepath.Join(base, "config"),
+		Cache:  filepath.Join(base, "cache"),
+		State:  filepath.Join(base, "state"),
+		Log:    filepath.Join(base, "log"),
+	}
+}
@@ -0,0 +1,39 @@
+package settings
+
+// Keybindings holds the keys for the actions in tune-cli.
+// Each field is a space separated list of key names: a single character, or one of
+// space, enter, tab, backspace, up, down, left, right, pgup, pgdn, home, end.
+type Keybindings struct {
+	Quit        string
+	PlayStop    string
+	Up          string
+	Down        string
+	VolumeUp    string
+	VolumeDown  string
+	NextProfile string
+	Record      string
+	SeekBack    string
+	SeekForward string
+	Live        string
+	Sleep       string
+	Schedule    string
+}
+
+// newDefaultKeybindings creates the keybindings that tune-cli always had
+func newDefaultKeybindings() Keybindings {
+	return Keybindings{
+		Quit:        "q",
+		PlayStop:    "space",
+		Up:          "up",
+		Down:        "down",
+		VolumeUp:    "+ =",
+		VolumeDown:  "- _",
+		NextProfile: "p",
+		Record:      "r",
+		SeekBack:    "left",
+		SeekForward: "right",
+		Live:        "end",
+		Sleep:       "s",
+		Schedule:    "t",
+	}
+}
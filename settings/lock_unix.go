@@ -0,0 +1,43 @@
+//go:build !windows
+// +build !windows
+
+package settings
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileLock is an advisory lock on a file, shared by all tune instances.
+type fileLock struct {
+	f *os.File
+}
+
+// lockFile creates the file at path when needed, and blocks until an exclusive lock on it is obtained.
+func lockFile(path string) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileLock{f: f}, nil
+}
+
+func (l *fileLock) unlock() {
+	syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+	l.f.Close()
+}
+
+// syncDir flushes the directory entry, so a rename survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
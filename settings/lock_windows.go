@@ -0,0 +1,36 @@
+package settings
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// fileLock is an advisory lock on a file, shared by all tune instances.
+type fileLock struct {
+	f *os.File
+}
+
+// lockFile creates the file at path when needed, and blocks until an exclusive lock on it is obtained.
+func lockFile(path string) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, &windows.Overlapped{})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileLock{f: f}, nil
+}
+
+func (l *fileLock) unlock() {
+	windows.UnlockFileEx(windows.Handle(l.f.Fd()), 0, 1, 0, &windows.Overlapped{})
+	l.f.Close()
+}
+
+// syncDir is a no-op, directories can't be synced on windows.
+func syncDir(dir string) error {
+	return nil
+}
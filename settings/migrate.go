@@ -0,0 +1,273 @@
+package settings
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// currentVersion is the settings schema version written by this version of tune.
+// Files without a version are version 1, the layout from before versioning was added.
+const currentVersion = 3
+
+// migrations upgrade a settings document one version at a time, migrations[i] upgrades from version i+1 to i+2.
+// A migration works on the generic document, so it can move and rename keys that Settings no longer has.
+var migrations = []func(doc document) error{
+	migrateV1ToV2,
+	migrateV2ToV3,
+}
+
+// migrateV1ToV2 sets the network, which was always di.fm before tune supported other networks.
+func migrateV1ToV2(doc document) error {
+	s := doc.table("Settings")
+	if key, _ := s["NetworkKey"].(string); key == "" {
+		s["NetworkKey"] = "di"
+	}
+	return nil
+}
+
+// migrateV2ToV3 moves the network, streamlist and player settings into the default profile.
+func migrateV2ToV3(doc document) error {
+	s := doc.table("Settings")
+	player := doc.table("Player")
+	profile := doc.table("Profiles").table(DefaultProfileName)
+	move := func(from document, fromKey, toKey string) {
+		if value, ok := from[fromKey]; ok {
+			profile[toKey] = value
+			delete(from, fromKey)
+		}
+	}
+	move(s, "NetworkKey", "NetworkKey")
+	move(s, "StreamlistKey", "StreamlistKey")
+	move(player, "Volume", "Volume")
+	move(player, "LastPlayedChannel", "LastPlayedChannel")
+	if len(player) == 0 {
+		delete(doc, "Player")
+	}
+	s["LastProfile"] = DefaultProfileName
+	return nil
+}
+
+// legacySettingsPath returns the location of the config file used by aacli and early versions of tune-gui.
+// It has the version 1 layout.
+func legacySettingsPath() string {
+	return filepath.Join(localSettingsFolder, "aacli", "config.toml")
+}
+
+// document is a settings file as a generic toml document.
+// Keys that are unknown to Settings are kept in the document, so they survive a load and save.
+type document map[string]interface{}
+
+// readDocument reads and decodes a settings file into a generic document.
+func readDocument(path string) (document, error) {
+	settingsBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc := make(document)
+	err = toml.Unmarshal(settingsBytes, &doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode settings file")
+	}
+	return doc, nil
+}
+
+// table returns the sub-table with given key, it is created when it doesn't exist.
+func (doc document) table(key string) document {
+	t, ok := doc[key].(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+		doc[key] = t
+	}
+	return document(t)
+}
+
+// version returns the schema version of the document.
+func (doc document) version() int {
+	v, ok := doc["Version"].(int64)
+	if !ok || v < 1 {
+		return 1
+	}
+	return int(v)
+}
+
+// migrate upgrades the document to currentVersion.
+// Documents from a newer version of tune are left as they are.
+func (doc document) migrate() error {
+	for v := doc.version(); v < currentVersion; v++ {
+		err := migrations[v-1](doc)
+		if err != nil {
+			return errors.Wrapf(err, "failed to migrate settings from version %d to %d", v, v+1)
+		}
+		doc["Version"] = int64(v + 1)
+	}
+	return nil
+}
+
+// decode decodes the document into Settings, the document is kept in Settings for the unknown keys.
+func (doc document) decode() (*Settings, error) {
+	var buf bytes.Buffer
+	err := toml.NewEncoder(&buf).Encode(doc)
+	if err != nil {
+		return nil, err
+	}
+	c := newDefault() // keys missing in the document keep their default
+	c.Profiles = nil  // but profiles are only those in the document
+	_, err = toml.Decode(buf.String(), c)
+	if err != nil {
+		return nil, err
+	}
+	c.doc = doc
+	return c, nil
+}
+
+// encode returns the settings as a document, with the unknown keys from the document it was read from.
+func (c *Settings) encode() (document, error) {
+	var buf bytes.Buffer
+	err := toml.NewEncoder(&buf).Encode(c)
+	if err != nil {
+		return nil, err
+	}
+	known := make(document)
+	_, err = toml.Decode(buf.String(), &known)
+	if err != nil {
+		return nil, err
+	}
+	doc := make(document)
+	overlay(doc, c.doc)
+	removeKnown(doc, reflect.ValueOf(c).Elem()) // fields that are omitted when empty must not be revived
+	overlay(doc, known)
+	return doc, nil
+}
+
+// removeKnown removes the keys for the fields of struct value v from the document, tables are walked recursively.
+// Maps of structs, such as the profiles, are walked per entry, entries that are no longer in the map are removed.
+func removeKnown(doc map[string]interface{}, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		key := field.Name
+		if tag := strings.Split(field.Tag.Get("toml"), ",")[0]; tag != "" {
+			key = tag
+		}
+		table, ok := doc[key].(map[string]interface{})
+		value := reflect.Indirect(v.Field(i))
+		switch {
+		case ok && value.Kind() == reflect.Struct:
+			removeKnown(table, value)
+			continue
+		case ok && value.Kind() == reflect.Map && value.Type().Key().Kind() == reflect.String && isStruct(value.Type().Elem()):
+			for name, entry := range table {
+				entryTable, ok := entry.(map[string]interface{})
+				entryValue := reflect.Indirect(value.MapIndex(reflect.ValueOf(name).Convert(value.Type().Key())))
+				if !ok || !entryValue.IsValid() {
+					delete(table, name)
+					continue
+				}
+				removeKnown(entryTable, entryValue)
+			}
+			if len(table) > 0 {
+				continue
+			}
+		}
+		delete(doc, key)
+	}
+}
+
+// isStruct returns whether t is a struct or a pointer to a struct.
+func isStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// overlay deep-copies all values from src into dst, tables are merged.
+func overlay(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcTable, ok := value.(map[string]interface{})
+		if !ok {
+			dst[key] = value
+			continue
+		}
+		dstTable, ok := dst[key].(map[string]interface{})
+		if !ok {
+			dstTable = make(map[string]interface{})
+			dst[key] = dstTable
+		}
+		overlay(dstTable, srcTable)
+	}
+}
+
+// backup copies the settings file before it is migrated.
+// Credentials are left out of the backup, the migrated settings move them to a credential store.
+func backup(path string, doc document) error {
+	settingsBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := doc["Account"]; ok {
+		scrubbed := make(document)
+		overlay(scrubbed, doc)
+		delete(scrubbed, "Account")
+		var buf bytes.Buffer
+		err = toml.NewEncoder(&buf).Encode(scrubbed)
+		if err != nil {
+			return err
+		}
+		settingsBytes = buf.Bytes()
+	}
+	backupPath := fmt.Sprintf("%s.v%d.bak", path, doc.version())
+	return ioutil.WriteFile(backupPath, settingsBytes, 0600)
+}
+
+// scrubCredentials removes the credentials from a settings file that isn't loaded, such as a backup or the legacy
+// aacli config. It is not an error when the file doesn't exist.
+func scrubCredentials(path string) error {
+	doc, err := readDocument(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := doc["Account"]; !ok {
+		return nil
+	}
+	delete(doc, "Account")
+	var buf bytes.Buffer
+	err = toml.NewEncoder(&buf).Encode(doc)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// importLegacy reads and migrates the legacy aacli config file.
+// When there is no legacy file, an os.IsNotExist error is returned.
+func importLegacy() (*Settings, error) {
+	doc, err := readDocument(legacySettingsPath())
+	if err != nil {
+		return nil, err
+	}
+	err = doc.migrate()
+	if err != nil {
+		return nil, err
+	}
+	return doc.decode()
+}
+
+// isNotExist is os.IsNotExist for errors that might be wrapped.
+func isNotExist(err error) bool {
+	return os.IsNotExist(errors.Cause(err))
+}
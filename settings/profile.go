@@ -0,0 +1,89 @@
+package settings
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultProfileName is the name of the profile that is created with new settings, and by migration of older settings.
+const DefaultProfileName = "default"
+
+// Profile holds the settings for one account on one network.
+// Multiple profiles allow a machine to be shared by several AudioAddict accounts.
+// The credentials for a profile are kept in the CredentialStore that is opened for it.
+type Profile struct {
+	NetworkKey        string
+	StreamlistKey     string
+	Volume            int
+	LastPlayedChannel string
+
+	// Schedule holds the schedule entries of the profile, by name.
+	Schedule map[string]*ScheduleEntry `toml:",omitempty"`
+}
+
+// ScheduleEntry is a rule of the schedule of a profile, it changes the channel or the volume at set times.
+type ScheduleEntry struct {
+	// When is a cron-like time specification: minute hour day-of-month month day-of-week, e.g. "30 7 * * mon-fri".
+	When string
+
+	// Channel is the key of the channel to play, empty keeps the channel.
+	Channel string
+
+	// Volume is the volume to set, 0 keeps the volume.
+	Volume int
+
+	// RampMinutes raises the volume from 1 to Volume over this many minutes, for a wake-up alarm.
+	RampMinutes int
+
+	// Disabled keeps the entry in the schedule without running it.
+	Disabled bool
+
+	// LastRun is when the entry ran last, a run that was missed while tune wasn't running is made up for shortly after.
+	LastRun time.Time `toml:",omitempty"`
+}
+
+// newDefaultProfile creates a new profile with safe defaults
+func newDefaultProfile() *Profile {
+	return &Profile{
+		NetworkKey: "di",
+		Volume:     50,
+	}
+}
+
+// Profile returns the profile with given name, it is created when it doesn't exist yet.
+func (c *Settings) Profile(name string) *Profile {
+	if c.Profiles == nil {
+		c.Profiles = make(map[string]*Profile)
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		p = newDefaultProfile()
+		c.Profiles[name] = p
+	}
+	return p
+}
+
+// ProfileNames returns the names of all profiles, sorted.
+func (c *Settings) ProfileNames() []string {
+	var names []string
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NextProfileName returns the name of the profile after given name, in sorted order.
+// It wraps around to the first profile.
+func (c *Settings) NextProfileName(name string) string {
+	names := c.ProfileNames()
+	if len(names) == 0 {
+		return name
+	}
+	for i, other := range names {
+		if other == name {
+			return names[(i+1)%len(names)]
+		}
+	}
+	return names[0]
+}
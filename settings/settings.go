@@ -1,9 +1,12 @@
 package settings
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/pkg/errors"
@@ -14,85 +17,409 @@ const (
 	settingsFileName           = "settings.toml"
 )
 
+// settingsPath returns the default location of the settings file.
 func settingsPath() string {
-	return filepath.Join(localSettingsFolder, "tune", "settings.toml")
+	return filepath.Join(DefaultDirs().Config, settingsFileName)
 }
 
 // Settings holds the settings variables that are persisted to disk
 type Settings struct {
+	// Version is the schema version of the settings file, older files are migrated on Load.
+	Version int
+
+	// Account holds credentials written by older versions of tune.
+	// Deprecated: credentials are kept in a CredentialStore, these fields are only read to move them there.
 	Account struct {
-		APIKey string
+		APIKey           string `toml:",omitempty"`
+		ListenKey        string `toml:",omitempty"`
+		WebSessionCookie string `toml:",omitempty"`
 	}
 
 	Settings struct {
-		StreamlistKey string
+		// CredentialStore selects where credentials are kept, see the Store* constants.
+		CredentialStore string
+
+		// LastProfile is the name of the profile that was used last, it is used when no profile is selected.
+		LastProfile string
 	}
 
+	// Player selects the audio backend that plays the streams.
 	Player struct {
-		Volume            int
-		LastPlayedChannel string
+		// Backend is one of the Backend* constants.
+		Backend string
+
+		// MPVPath is the mpv executable that is launched by the mpv backend, it is looked up in PATH when empty.
+		MPVPath string
+
+		// MPVSocket makes the mpv backend attach to a running mpv with this IPC socket, instead of launching mpv.
+		MPVSocket string
+
+		// MPVArgs are extra arguments for a launched mpv.
+		MPVArgs []string
+
+		// TimeshiftMinutes is how much of the stream is kept to pause and rewind, 0 disables timeshift. It is off by
+		// default, it runs a local proxy and keeps tens of megabytes of the stream.
+		TimeshiftMinutes int
+
+		// TimeshiftOnDisk keeps the timeshift buffer in the cache folder instead of in memory.
+		TimeshiftOnDisk bool
+
+		// FadeInMs and FadeOutMs are the milliseconds to fade in when playback starts and to fade out when it stops,
+		// 0 disables the fade.
+		FadeInMs  int
+		FadeOutMs int
+
+		// CrossfadeMs are the milliseconds to crossfade from one channel to the next, 0 fades out and in instead.
+		CrossfadeMs int
+
+		// SleepFadeMinutes are the last minutes of a sleep timer in which the volume is lowered gradually.
+		SleepFadeMinutes int
+	}
+
+	// Record configures recordings made with tune-cli.
+	Record struct {
+		// Dir is the folder recordings are written to, see RecordDir for the default.
+		Dir string
+
+		// MaxMinutes stops a recording after this many minutes, 0 means no limit.
+		MaxMinutes int
+
+		// MaxMegabytes stops a recording after this many megabytes, 0 means no limit.
+		MaxMegabytes int
 	}
+
+	// Profiles holds the settings per profile, by name.
+	Profiles map[string]*Profile
+
+	Keybindings Keybindings
+
+	// loaded is a copy of the settings as they were last loaded or saved, used to merge changes on Save.
+	loaded *Settings
+
+	// doc is the document the settings were read from, it holds keys that are unknown to this version of tune.
+	doc document
+
+	// path is the file the settings are loaded from and saved to.
+	path string
 }
 
+// Audio backends for the Player settings.
+const (
+	BackendVLC = "vlc"
+	BackendMPV = "mpv"
+	BackendGo  = "go"
+)
+
 // newDefault creates a new settings with safe defaults
 func newDefault() *Settings {
 	c := &Settings{}
-	c.Player.Volume = 50
+	c.Version = currentVersion
+	c.Settings.LastProfile = DefaultProfileName
+	c.Player.Backend = BackendVLC
+	c.Player.FadeInMs = 1000
+	c.Player.FadeOutMs = 1000
+	c.Player.SleepFadeMinutes = 5
+	c.Profiles = map[string]*Profile{
+		DefaultProfileName: newDefaultProfile(),
+	}
+	c.Keybindings = newDefaultKeybindings()
 	return c
 }
 
-// Load loads settings variables from disk
+// Load loads settings variables from disk.
+// Settings files from older versions of tune are migrated, a backup of the old file is written next to it.
+// When there is no settings file yet, the legacy aacli config is imported, or new default settings are created.
 func Load() (*Settings, error) {
-	settingsFile, err := os.Open(settingsPath())
+	return LoadFile(settingsPath())
+}
+
+// LoadFile loads settings from the file at path instead of the default location.
+// Credential files are kept next to it. The legacy aacli config is only imported for the default location.
+func LoadFile(path string) (*Settings, error) {
+	c, migrated, err := read(path)
+	if isNotExist(err) {
+		err = os.ErrNotExist
+		if path == settingsPath() {
+			c, err = importLegacy()
+		}
+		if isNotExist(err) {
+			c, err = newDefault(), nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to import legacy settings")
+		}
+		c.path = path
+		// make sure we can save to disk
+		err = c.Save()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create new settings file")
+		}
+		return c, nil
+	}
 	if err != nil {
-		if os.IsNotExist(err) {
-			// create new default settings and make sure we can save to disk
-			c := newDefault()
-			err = c.Save()
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to create new settings file")
-			}
-			return c, err
+		return nil, err
+	}
+	c.path = path
+	c.loaded = c.clone()
+	if migrated {
+		err = c.Save()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to save migrated settings")
 		}
 	}
-	defer settingsFile.Close()
+	return c, nil
+}
 
-	// read all bytes from file
-	settingsBytes, err := ioutil.ReadAll(settingsFile)
+// read reads, migrates and decodes a settings file.
+// When the file was migrated, it is backed up first and migrated is true.
+func read(path string) (c *Settings, migrated bool, err error) {
+	doc, err := readDocument(path)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to read from settings file")
+		return nil, false, err
 	}
-	c := &Settings{}
-	err = toml.Unmarshal(settingsBytes, c)
+	if doc.version() < currentVersion {
+		err = backup(path, doc)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "failed to backup settings file before migration")
+		}
+		err = doc.migrate()
+		if err != nil {
+			return nil, false, err
+		}
+		migrated = true
+	}
+	c, err = doc.decode()
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	return c, nil
+	return c, migrated, nil
+}
+
+// RecordDir returns the folder for recordings, it defaults to the Music folder in the home folder.
+func (c *Settings) RecordDir() string {
+	if c.Record.Dir != "" {
+		return c.Record.Dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(DefaultDirs().State, "recordings")
+	}
+	return filepath.Join(home, "Music", settingsDirApplicationName)
+}
+
+// Path returns the path of the settings file.
+func (c *Settings) Path() string {
+	if c.path == "" {
+		return settingsPath()
+	}
+	return c.path
+}
+
+// clone returns a deep copy of the settings, as they would be saved.
+func (c *Settings) clone() *Settings {
+	var buf bytes.Buffer
+	err := toml.NewEncoder(&buf).Encode(c)
+	if err != nil {
+		panic(errors.Wrap(err, "failed to encode settings for clone"))
+	}
+	clone := &Settings{}
+	_, err = toml.Decode(buf.String(), clone)
+	if err != nil {
+		panic(errors.Wrap(err, "failed to decode settings for clone"))
+	}
+	return clone
 }
 
-// Save saves the settings to disk in yaml format
+// Save saves the settings to disk in toml format.
+// Changes saved by another tune instance since Load are merged in, unless the same setting was changed here too.
+// The file is written to a temporary file and moved over the existing settings file, so it's never half-written.
 func (c *Settings) Save() error {
-	// TODO: This is not an atomic file write, instead file should be created with a random suffix and
-	// moved over existing settings file when completed.
+	path := c.Path()
 
 	// create parent path
-	err := os.MkdirAll(filepath.Dir(settingsPath()), 0775)
+	err := os.MkdirAll(filepath.Dir(path), 0700)
 	if err != nil {
 		return errors.Wrap(err, "failed to create directory for settings")
 	}
 
-	// create settings file
-	settingsFile, err := os.Create(settingsPath())
+	// make sure no other tune instance saves at the same time
+	lock, err := lockFile(path + ".lock")
 	if err != nil {
-		return err
+		return errors.Wrap(err, "failed to lock settings file")
+	}
+	defer lock.unlock()
+
+	// merge changes from disk
+	if c.loaded != nil {
+		disk, _, err := read(path)
+		if err != nil && !isNotExist(err) {
+			return errors.Wrap(err, "failed to reload settings file")
+		}
+		if disk != nil {
+			mergeChanges(reflect.ValueOf(c.loaded).Elem(), reflect.ValueOf(c).Elem(), reflect.ValueOf(disk).Elem())
+			c.doc = disk.doc
+		}
+	}
+	if c.Version < currentVersion {
+		c.Version = currentVersion
+	}
+	doc, err := c.encode()
+	if err != nil {
+		return errors.Wrap(err, "failed to encode settings")
 	}
-	defer settingsFile.Close()
 
-	// encode settings to file
-	err = toml.NewEncoder(settingsFile).Encode(c)
+	// encode settings to a temporary file
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), "."+settingsFileName+".")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary settings file")
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath) // no-op after successful rename
+	err = toml.NewEncoder(tmpFile).Encode(doc)
+	if err != nil {
+		tmpFile.Close()
+		return err
+	}
+	err = tmpFile.Sync()
+	if err != nil {
+		tmpFile.Close()
+		return errors.Wrap(err, "failed to sync temporary settings file")
+	}
+	err = tmpFile.Close()
 	if err != nil {
 		return err
 	}
 
+	// move it over the existing settings
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return errors.Wrap(err, "failed to replace settings file")
+	}
+	err = syncDir(filepath.Dir(path))
+	if err != nil {
+		return errors.Wrap(err, "failed to sync settings directory")
+	}
+
+	c.loaded = c.clone()
 	return nil
 }
+
+// mergeChanges copies the values from theirs into ours, for all fields that weren't changed in ours compared to base.
+// Maps are merged per key, so changes to different profiles don't conflict.
+func mergeChanges(base, ours, theirs reflect.Value) {
+	switch ours.Kind() {
+	case reflect.Struct:
+		if opaque(ours.Type()) {
+			mergeValue(base, ours, theirs)
+			return
+		}
+		for i := 0; i < ours.NumField(); i++ {
+			if ours.Type().Field(i).PkgPath != "" {
+				continue // unexported
+			}
+			mergeChanges(base.Field(i), ours.Field(i), theirs.Field(i))
+		}
+	case reflect.Ptr:
+		if ours.IsNil() || base.IsNil() || theirs.IsNil() || ours.Elem().Kind() != reflect.Struct {
+			mergeValue(base, ours, theirs)
+			return
+		}
+		mergeChanges(base.Elem(), ours.Elem(), theirs.Elem())
+	case reflect.Map:
+		if ours.IsNil() || base.IsNil() || theirs.IsNil() {
+			mergeValue(base, ours, theirs)
+			return
+		}
+		keys := make(map[interface{}]reflect.Value)
+		for _, m := range []reflect.Value{base, ours, theirs} {
+			for _, key := range m.MapKeys() {
+				keys[key.Interface()] = key
+			}
+		}
+		for _, key := range keys {
+			baseValue, oursValue, theirsValue := base.MapIndex(key), ours.MapIndex(key), theirs.MapIndex(key)
+			switch {
+			case baseValue.IsValid() && oursValue.IsValid() && theirsValue.IsValid():
+				mergeChanges(baseValue, oursValue, theirsValue)
+			case !oursValue.IsValid() && baseValue.IsValid():
+				// removed here, keep it removed
+			case !theirsValue.IsValid() && baseValue.IsValid():
+				// removed on disk, remove it here unless it was changed here
+				if equal(oursValue, baseValue) {
+					ours.SetMapIndex(key, reflect.Value{})
+				}
+			case !baseValue.IsValid() && !oursValue.IsValid():
+				// added on disk
+				ours.SetMapIndex(key, theirsValue)
+			}
+		}
+	default:
+		mergeValue(base, ours, theirs)
+	}
+}
+
+// mergeValue sets ours to theirs when ours wasn't changed compared to base.
+func mergeValue(base, ours, theirs reflect.Value) {
+	if equal(ours, base) {
+		ours.Set(theirs)
+	}
+}
+
+// opaque returns whether a struct type is a single value, such as time.Time, instead of a group of settings.
+func opaque(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			return false
+		}
+	}
+	return true
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// equal returns whether two settings values are the same, nil and empty maps and slices are equal. Times are compared
+// with time.Time.Equal, a decoded time has a location of its own.
+func equal(a, b reflect.Value) bool {
+	if a.Type() == timeType {
+		return a.Interface().(time.Time).Equal(b.Interface().(time.Time))
+	}
+	switch a.Kind() {
+	case reflect.Struct:
+		if opaque(a.Type()) {
+			break
+		}
+		for i := 0; i < a.NumField(); i++ {
+			if a.Type().Field(i).PkgPath == "" && !equal(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return equal(a.Elem(), b.Elem())
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for _, key := range a.MapKeys() {
+			bValue := b.MapIndex(key)
+			if !bValue.IsValid() || !equal(a.MapIndex(key), bValue) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equal(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
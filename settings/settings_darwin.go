@@ -5,4 +5,17 @@ import (
 	"path/filepath"
 )
 
+// localSettingsFolder is the folder that holds the config folders of applications.
 var localSettingsFolder = filepath.Join(os.Getenv("HOME"), "Library", "Application Support")
+
+// platformDirs returns the folders for tune in the user's Library.
+func platformDirs() Dirs {
+	library := filepath.Join(os.Getenv("HOME"), "Library")
+	config := filepath.Join(localSettingsFolder, settingsDirApplicationName)
+	return Dirs{
+		Config: config,
+		Cache:  filepath.Join(library, "Caches", settingsDirApplicationName),
+		State:  filepath.Join(config, "state"),
+		Log:    filepath.Join(library, "Logs", settingsDirApplicationName),
+	}
+}
@@ -0,0 +1,139 @@
+package settings
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scheduleProfile(lastRun time.Time) *Profile {
+	p := newDefaultProfile()
+	p.Schedule = map[string]*ScheduleEntry{
+		"wake": {When: "30 7 * * mon-fri", Volume: 60, LastRun: lastRun},
+	}
+	return p
+}
+
+func TestMergeChangesTime(t *testing.T) {
+	run := time.Date(2026, 3, 2, 7, 30, 0, 0, time.UTC)
+
+	// a run saved by another instance is merged in
+	base, ours, theirs := scheduleProfile(time.Time{}), scheduleProfile(time.Time{}), scheduleProfile(run)
+	mergeChanges(reflect.ValueOf(base).Elem(), reflect.ValueOf(ours).Elem(), reflect.ValueOf(theirs).Elem())
+	if got := ours.Schedule["wake"].LastRun; !got.Equal(run) {
+		t.Fatalf("LastRun %v, want %v", got, run)
+	}
+
+	// a run here is kept
+	later := run.Add(24 * time.Hour)
+	base, ours, theirs = scheduleProfile(time.Time{}), scheduleProfile(later), scheduleProfile(run)
+	mergeChanges(reflect.ValueOf(base).Elem(), reflect.ValueOf(ours).Elem(), reflect.ValueOf(theirs).Elem())
+	if got := ours.Schedule["wake"].LastRun; !got.Equal(later) {
+		t.Fatalf("LastRun %v, want %v", got, later)
+	}
+
+	// the same time in another location is no change, the entry removed on disk is removed here too
+	base, ours, theirs = scheduleProfile(run), scheduleProfile(run.In(time.FixedZone("CET", 3600))), newDefaultProfile()
+	mergeChanges(reflect.ValueOf(base).Elem(), reflect.ValueOf(ours).Elem(), reflect.ValueOf(theirs).Elem())
+	if _, ok := ours.Schedule["wake"]; ok {
+		t.Fatal("entry removed on disk was kept")
+	}
+}
+
+func TestChangedKeysTime(t *testing.T) {
+	run := time.Date(2026, 3, 2, 7, 30, 0, 0, time.UTC)
+
+	var keys []string
+	changedKeys("", reflect.ValueOf(scheduleProfile(time.Time{})).Elem(), reflect.ValueOf(scheduleProfile(run)).Elem(), &keys)
+	if want := []string{"Schedule.wake.LastRun"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("changed keys %q, want %q", keys, want)
+	}
+
+	keys = nil
+	changedKeys("", reflect.ValueOf(scheduleProfile(run)).Elem(), reflect.ValueOf(scheduleProfile(run.In(time.FixedZone("CET", 3600)))).Elem(), &keys)
+	if len(keys) != 0 {
+		t.Fatalf("changed keys %q for the same time, want none", keys)
+	}
+}
+
+func TestEncodeKeepsUnknownProfileKeys(t *testing.T) {
+	c := newDefault()
+	c.Profiles["work"] = newDefaultProfile()
+	c.doc = document{
+		"Profiles": map[string]interface{}{
+			DefaultProfileName: map[string]interface{}{"Volume": int64(20), "Future": "kept"},
+			"work": map[string]interface{}{
+				"Schedule": map[string]interface{}{
+					"wake": map[string]interface{}{"When": "@daily", "Snooze": int64(5)},
+				},
+			},
+			"removed": map[string]interface{}{"Future": "gone"},
+		},
+	}
+	doc, err := c.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	profiles := doc["Profiles"].(map[string]interface{})
+	def := profiles[DefaultProfileName].(map[string]interface{})
+	if def["Future"] != "kept" {
+		t.Errorf("unknown key in profile was removed: %v", def)
+	}
+	if def["Volume"] != int64(c.Profiles[DefaultProfileName].Volume) {
+		t.Errorf("volume %v, want %d", def["Volume"], c.Profiles[DefaultProfileName].Volume)
+	}
+	if _, ok := profiles["work"].(map[string]interface{})["Schedule"]; ok {
+		t.Errorf("removed schedule was revived: %v", profiles["work"])
+	}
+	if _, ok := profiles["removed"]; ok {
+		t.Errorf("removed profile was revived: %v", profiles["removed"])
+	}
+}
+
+func TestMigrationBackupWithoutCredentials(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.toml")
+	v1 := "[Account]\nAPIKey = \"secret\"\n\n[Player]\nVolume = 40\n"
+	err := ioutil.WriteFile(path, []byte(v1), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Account.APIKey != "secret" || c.Profiles[DefaultProfileName].Volume != 40 {
+		t.Fatalf("migrated settings lost values: %+v %+v", c.Account, c.Profiles[DefaultProfileName])
+	}
+	backup, err := ioutil.ReadFile(path + ".v1.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(backup), "secret") || !strings.Contains(string(backup), "Volume = 40") {
+		t.Fatalf("backup:\n%s", backup)
+	}
+
+	// a backup written by an older version is scrubbed
+	err = ioutil.WriteFile(path+".v2.bak", []byte(v1), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = scrubCredentials(path + ".v2.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err = ioutil.ReadFile(path + ".v2.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(backup), "secret") || !strings.Contains(string(backup), "Volume = 40") {
+		t.Fatalf("scrubbed backup:\n%s", backup)
+	}
+	err = scrubCredentials(filepath.Join(dir, "missing.toml"))
+	if err != nil {
+		t.Fatalf("scrubbing missing file: %v", err)
+	}
+}
@@ -1,5 +1,22 @@
 package settings
 
-import "os"
+import (
+	"os"
+	"path/filepath"
+)
 
-var localSettingsFolder = []string{os.Getenv("PROGRAMDATA")}
+// localSettingsFolder is the folder that holds the config folders of applications.
+// Settings roam with the user, so they're in the roaming AppData folder.
+var localSettingsFolder = os.Getenv("APPDATA")
+
+// platformDirs returns the folders for tune in the user's AppData.
+// Cache, state and logs are specific to the machine, so they're in the local AppData folder.
+func platformDirs() Dirs {
+	local := filepath.Join(os.Getenv("LOCALAPPDATA"), settingsDirApplicationName)
+	return Dirs{
+		Config: filepath.Join(localSettingsFolder, settingsDirApplicationName),
+		Cache:  filepath.Join(local, "cache"),
+		State:  filepath.Join(local, "state"),
+		Log:    filepath.Join(local, "logs"),
+	}
+}
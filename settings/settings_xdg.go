@@ -1,3 +1,4 @@
+//go:build !windows && !darwin
 // +build !windows,!darwin
 
 package settings
@@ -7,13 +8,27 @@ import (
 	"path/filepath"
 )
 
-var localSettingsFolder string
+// localSettingsFolder is the folder that holds the config folders of applications.
+var localSettingsFolder = xdgDir("XDG_CONFIG_HOME", ".config")
 
-func init() {
-	// https://specifications.freedesktop.org/basedir-spec/basedir-spec-latest.html
-	if os.Getenv("XDG_CONFIG_HOME") != "" {
-		localSettingsFolder = os.Getenv("XDG_CONFIG_HOME")
-	} else {
-		localSettingsFolder = filepath.Join(os.Getenv("HOME"), ".config")
+// platformDirs returns the folders for tune following the XDG base directory specification.
+// https://specifications.freedesktop.org/basedir-spec/basedir-spec-latest.html
+// XDG has no folder for logs, they are kept with the state.
+func platformDirs() Dirs {
+	state := filepath.Join(xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state")), settingsDirApplicationName)
+	return Dirs{
+		Config: filepath.Join(localSettingsFolder, settingsDirApplicationName),
+		Cache:  filepath.Join(xdgDir("XDG_CACHE_HOME", ".cache"), settingsDirApplicationName),
+		State:  state,
+		Log:    filepath.Join(state, "log"),
 	}
 }
+
+// xdgDir returns the folder from the environment variable, or the fallback in the home folder when it isn't set.
+// Relative paths are invalid according to the specification and ignored.
+func xdgDir(env, fallback string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(os.Getenv("HOME"), fallback)
+}
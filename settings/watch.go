@@ -0,0 +1,164 @@
+package settings
+
+import (
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// watchDelay is how long the Watcher waits for more changes before it sends an event.
+// Editors and Save write a file in several steps.
+const watchDelay = 100 * time.Millisecond
+
+// Watcher watches the settings file for changes that are saved by other programs, such as an editor or another
+// tune instance. The changes are applied with (*Settings).Reload when an event is received.
+type Watcher struct {
+	watcher *fsnotify.Watcher
+	path    string
+
+	chEvents chan struct{}
+	chErrors chan error
+	chClose  chan struct{}
+}
+
+// Watch starts watching the settings file.
+// The folder is watched instead of the file, because Save replaces the file.
+func (c *Settings) Watch() (*Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create file watcher")
+	}
+	path := filepath.Clean(c.Path())
+	err = fw.Add(filepath.Dir(path))
+	if err != nil {
+		fw.Close()
+		return nil, errors.Wrap(err, "failed to watch settings folder")
+	}
+	w := &Watcher{
+		watcher: fw,
+		path:    path,
+
+		chEvents: make(chan struct{}, 1),
+		chErrors: make(chan error, 1),
+		chClose:  make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// run forwards the changes to the settings file until the watcher is closed.
+func (w *Watcher) run() {
+	var chDelay <-chan time.Time
+	for {
+		select {
+		case <-w.chClose:
+			return
+		case ev, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) != w.path || ev.Op == fsnotify.Chmod {
+				continue
+			}
+			chDelay = time.After(watchDelay)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			select {
+			case w.chErrors <- err:
+			default: // an error is pending already
+			}
+		case <-chDelay:
+			chDelay = nil
+			select {
+			case w.chEvents <- struct{}{}:
+			default: // an event is pending already
+			}
+		}
+	}
+}
+
+// Events returns the channel that receives a value when the settings file changed.
+// Changes in quick succession are sent as one event.
+func (w *Watcher) Events() <-chan struct{} {
+	return w.chEvents
+}
+
+// Errors returns the channel that receives errors from watching the file.
+func (w *Watcher) Errors() <-chan error {
+	return w.chErrors
+}
+
+// Close stops watching the settings file.
+func (w *Watcher) Close() error {
+	close(w.chClose)
+	return w.watcher.Close()
+}
+
+// Reload merges the changes that were saved to disk since the settings were loaded or saved.
+// Settings that were changed here are kept, and saved on the next Save.
+// It returns the keys of the settings that changed, as dotted paths such as "Profiles.default.Volume".
+func (c *Settings) Reload() ([]string, error) {
+	disk, _, err := read(c.Path())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to reload settings file")
+	}
+	before := c.clone()
+	if c.loaded != nil {
+		mergeChanges(reflect.ValueOf(c.loaded).Elem(), reflect.ValueOf(c).Elem(), reflect.ValueOf(disk).Elem())
+	}
+	c.doc = disk.doc
+	c.loaded = disk.clone()
+
+	var changed []string
+	changedKeys("", reflect.ValueOf(before).Elem(), reflect.ValueOf(c).Elem(), &changed)
+	return changed, nil
+}
+
+// changedKeys appends the dotted paths of the fields and map entries that differ between a and b to keys.
+func changedKeys(prefix string, a, b reflect.Value, keys *[]string) {
+	switch a.Kind() {
+	case reflect.Struct:
+		if opaque(a.Type()) {
+			break // a single value, such as a time
+		}
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			if field.PkgPath != "" {
+				continue // unexported
+			}
+			changedKeys(prefix+field.Name+".", a.Field(i), b.Field(i), keys)
+		}
+		return
+	case reflect.Ptr:
+		if !a.IsNil() && !b.IsNil() {
+			changedKeys(prefix, a.Elem(), b.Elem(), keys)
+			return
+		}
+	case reflect.Map:
+		seen := make(map[interface{}]bool)
+		for _, m := range []reflect.Value{a, b} {
+			for _, key := range m.MapKeys() {
+				if seen[key.Interface()] {
+					continue
+				}
+				seen[key.Interface()] = true
+				aValue, bValue := a.MapIndex(key), b.MapIndex(key)
+				keyPrefix := prefix + key.String() + "."
+				if !aValue.IsValid() || !bValue.IsValid() {
+					*keys = append(*keys, keyPrefix[:len(keyPrefix)-1])
+					continue
+				}
+				changedKeys(keyPrefix, aValue, bValue, keys)
+			}
+		}
+		return
+	}
+	if !equal(a, b) {
+		*keys = append(*keys, prefix[:len(prefix)-1])
+	}
+}